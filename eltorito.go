@@ -0,0 +1,728 @@
+package iso9660
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// El Torito Bootable CD-ROM Format Specification Version 1.0
+// https://pdos.csail.mit.edu/6.828/2014/readings/boot-cdrom.pdf
+
+const (
+	elToritoBootSystemIdentifier = "EL TORITO SPECIFICATION"
+
+	bootCatalogEntrySize = 32
+
+	// header IDs and indicators of the boot catalog entries, see El Torito 2.1-2.5
+	bootCatalogValidationEntry   = 0x01
+	bootCatalogSectionHeader     = 0x90
+	bootCatalogFinalHeader       = 0x91
+	bootCatalogEntryExtension    = 0x44
+	bootCatalogBootable          = 0x88
+	bootCatalogNotBootable       = 0x00
+	bootCatalogExtensionFollows  = 1 << 5 // in the boot media type of section entries and in extension flags
+	bootCatalogEmulationTypeMask = 0x0F
+
+	// El Torito boot images are loaded in units of emulated 512-byte sectors
+	virtualSectorSize = 512
+
+	// defaultBootCatalogPath is where the boot catalog is recorded unless set with WithBootCatalog
+	defaultBootCatalogPath = "boot.cat"
+
+	// the boot info table occupies bytes 8-63 of a boot image, see mkisofs -boot-info-table
+	bootInfoTableOffset = 8
+	bootInfoTableEnd    = 64
+)
+
+// BootPlatform identifies the system a boot catalog section is meant for
+type BootPlatform byte
+
+const (
+	BootPlatformX86     BootPlatform = 0x00
+	BootPlatformPowerPC BootPlatform = 0x01
+	BootPlatformMac     BootPlatform = 0x02
+	BootPlatformEFI     BootPlatform = 0xEF
+)
+
+func (p BootPlatform) String() string {
+	switch p {
+	case BootPlatformX86:
+		return "x86"
+	case BootPlatformPowerPC:
+		return "PowerPC"
+	case BootPlatformMac:
+		return "Mac"
+	case BootPlatformEFI:
+		return "EFI"
+	}
+	return fmt.Sprintf("BootPlatform(0x%02X)", byte(p))
+}
+
+// BootEmulation is the kind of media a boot image is presented as by the BIOS
+type BootEmulation byte
+
+const (
+	BootEmulationNone      BootEmulation = 0
+	BootEmulationFloppy12  BootEmulation = 1 // 1.2 MB diskette
+	BootEmulationFloppy144 BootEmulation = 2 // 1.44 MB diskette
+	BootEmulationFloppy288 BootEmulation = 3 // 2.88 MB diskette
+	BootEmulationHardDisk  BootEmulation = 4
+)
+
+func (e BootEmulation) String() string {
+	switch e {
+	case BootEmulationNone:
+		return "no emulation"
+	case BootEmulationFloppy12:
+		return "1.2 MB floppy"
+	case BootEmulationFloppy144:
+		return "1.44 MB floppy"
+	case BootEmulationFloppy288:
+		return "2.88 MB floppy"
+	case BootEmulationHardDisk:
+		return "hard disk"
+	}
+	return fmt.Sprintf("BootEmulation(%d)", byte(e))
+}
+
+// floppySize returns the size of the emulated diskette or 0 for other kinds of emulation
+func (e BootEmulation) floppySize() int64 {
+	switch e {
+	case BootEmulationFloppy12:
+		return 1200 * 1024
+	case BootEmulationFloppy144:
+		return 1440 * 1024
+	case BootEmulationFloppy288:
+		return 2880 * 1024
+	}
+	return 0
+}
+
+// BootCatalog contains the El Torito boot catalog of an image
+type BootCatalog struct {
+	// Platform and ID come from the validation entry
+	Platform BootPlatform
+	ID       string
+
+	// Default is the initial/default entry, which applies to the Platform of the catalog
+	Default *BootEntry
+
+	Sections []*BootSection
+}
+
+// BootSection is a group of boot entries following a section header of the boot catalog
+type BootSection struct {
+	Platform BootPlatform
+	ID       string
+	Entries  []*BootEntry
+}
+
+// BootEntry describes a boot image
+type BootEntry struct {
+	Bootable    bool
+	Emulation   BootEmulation
+	LoadSegment uint16 // 0 stands for the traditional segment 0x7C0
+	SystemType  byte   // the partition type of the boot image in case of hard disk emulation
+	SectorCount uint16 // number of emulated 512-byte sectors loaded by the BIOS
+	LoadRBA     uint32 // logical block of the boot image
+
+	// SelectionCriteriaType and SelectionCriteria are only recorded in section entries
+	SelectionCriteriaType byte
+	SelectionCriteria     []byte
+
+	ra   io.ReaderAt
+	size int64
+}
+
+// Size returns the size of the boot image in bytes. If the image is present in the
+// directory tree, it is the size of that file. Otherwise the size is derived from the
+// type of emulation or, lacking any better source, the number of sectors loaded by the BIOS.
+func (be *BootEntry) Size() int64 {
+	return be.size
+}
+
+// Reader returns a reader of the boot image
+func (be *BootEntry) Reader() io.Reader {
+	return io.NewSectionReader(be.ra, int64(be.LoadRBA)*int64(sectorSize), be.size)
+}
+
+// BootCatalog returns the El Torito boot catalog referenced by the first boot record of the image.
+// It returns os.ErrNotExist if there is no such boot record.
+func (i *Image) BootCatalog() (*BootCatalog, error) {
+	location, err := i.bootCatalogLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := readBootCatalog(i.ra, location)
+	if err != nil {
+		return nil, fmt.Errorf("reading El Torito boot catalog: %w", err)
+	}
+
+	extents, err := i.fileExtents()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*BootEntry{catalog.Default}
+	for _, section := range catalog.Sections {
+		entries = append(entries, section.Entries...)
+	}
+	for _, entry := range entries {
+		entry.ra = i.ra
+		entry.size = entry.bootImageSize(extents)
+	}
+
+	return catalog, nil
+}
+
+func (i *Image) bootCatalogLocation() (uint32, error) {
+	for _, vd := range i.volumeDescriptors {
+		if vd.Type() != volumeTypeBoot || strings.TrimRight(vd.Boot.BootSystemIdentifier, "\x00") != elToritoBootSystemIdentifier {
+			continue
+		}
+
+		// El Torito 2.0: the absolute pointer to the first sector of the boot catalog
+		return binary.LittleEndian.Uint32(vd.Boot.BootSystemUse[0:4]), nil
+	}
+
+	return 0, os.ErrNotExist
+}
+
+// fileExtents maps the extent locations of all files in the primary directory tree to their sizes
+func (i *Image) fileExtents() (map[uint32]int64, error) {
+	root, err := i.RootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	extents := make(map[uint32]int64)
+	var walk func(dir *File) error
+	walk = func(dir *File) error {
+		children, err := dir.GetChildren()
+		if err != nil {
+			return err
+		}
+
+		for _, c := range children {
+			if c.IsDir() {
+				if err := walk(c); err != nil {
+					return err
+				}
+				continue
+			}
+			extents[uint32(c.de.ExtentLocation)] = int64(c.de.ExtentLength)
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return extents, nil
+}
+
+func (be *BootEntry) bootImageSize(extents map[uint32]int64) int64 {
+	if size, ok := extents[be.LoadRBA]; ok {
+		return size
+	}
+
+	if size := be.Emulation.floppySize(); size != 0 {
+		return size
+	}
+
+	if be.SectorCount == 0 {
+		return int64(sectorSize)
+	}
+	return int64(be.SectorCount) * virtualSectorSize
+}
+
+func readBootCatalog(ra io.ReaderAt, location uint32) (*BootCatalog, error) {
+	offset := int64(location) * int64(sectorSize)
+	readEntry := func() ([]byte, error) {
+		entry := make([]byte, bootCatalogEntrySize)
+		if _, err := ra.ReadAt(entry, offset); err != nil {
+			return nil, err
+		}
+		offset += bootCatalogEntrySize
+		return entry, nil
+	}
+
+	validation, err := readEntry()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBootCatalogValidationEntry(validation); err != nil {
+		return nil, err
+	}
+
+	catalog := &BootCatalog{
+		Platform: BootPlatform(validation[1]),
+		ID:       strings.TrimRight(string(validation[4:28]), "\x00 "),
+	}
+
+	initial, err := readEntry()
+	if err != nil {
+		return nil, err
+	}
+	if catalog.Default, err = unmarshalBootEntry(initial); err != nil {
+		return nil, err
+	}
+
+	for {
+		header, err := readEntry()
+		if err != nil {
+			return nil, err
+		}
+		if header[0] != bootCatalogSectionHeader && header[0] != bootCatalogFinalHeader {
+			// catalogs without sections end right after the default entry
+			break
+		}
+
+		section := &BootSection{
+			Platform: BootPlatform(header[1]),
+			ID:       strings.TrimRight(string(header[4:32]), "\x00 "),
+		}
+
+		for n := binary.LittleEndian.Uint16(header[2:4]); n > 0; n-- {
+			data, err := readEntry()
+			if err != nil {
+				return nil, err
+			}
+			entry, err := unmarshalBootEntry(data)
+			if err != nil {
+				return nil, err
+			}
+			entry.SelectionCriteriaType = data[12]
+			entry.SelectionCriteria = append([]byte{}, data[13:32]...)
+
+			// El Torito 2.5: the vendor unique selection criteria may continue in extension entries
+			for more := data[1]&bootCatalogExtensionFollows != 0; more; {
+				extension, err := readEntry()
+				if err != nil {
+					return nil, err
+				}
+				if extension[0] != bootCatalogEntryExtension {
+					return nil, fmt.Errorf("invalid section entry extension indicator 0x%02X", extension[0])
+				}
+				entry.SelectionCriteria = append(entry.SelectionCriteria, extension[2:32]...)
+				more = extension[1]&bootCatalogExtensionFollows != 0
+			}
+
+			section.Entries = append(section.Entries, entry)
+		}
+
+		catalog.Sections = append(catalog.Sections, section)
+		if header[0] == bootCatalogFinalHeader {
+			break
+		}
+	}
+
+	return catalog, nil
+}
+
+// checkBootCatalogValidationEntry verifies the header ID, key bytes and checksum of the validation entry, see El Torito 2.1
+func checkBootCatalogValidationEntry(data []byte) error {
+	if data[0] != bootCatalogValidationEntry {
+		return fmt.Errorf("invalid validation entry header ID 0x%02X", data[0])
+	}
+	if data[30] != 0x55 || data[31] != 0xAA {
+		return fmt.Errorf("invalid validation entry key bytes 0x%02X 0x%02X", data[30], data[31])
+	}
+
+	// the 16-bit words of the entry, including the checksum, sum up to zero
+	var sum uint16
+	for i := 0; i < bootCatalogEntrySize; i += 2 {
+		sum += binary.LittleEndian.Uint16(data[i : i+2])
+	}
+	if sum != 0 {
+		return fmt.Errorf("invalid validation entry checksum")
+	}
+
+	return nil
+}
+
+// unmarshalBootEntry decodes the fields shared by the initial/default entry and section entries
+func unmarshalBootEntry(data []byte) (*BootEntry, error) {
+	if data[0] != bootCatalogBootable && data[0] != bootCatalogNotBootable {
+		return nil, fmt.Errorf("invalid boot indicator 0x%02X", data[0])
+	}
+
+	return &BootEntry{
+		Bootable:    data[0] == bootCatalogBootable,
+		Emulation:   BootEmulation(data[1] & bootCatalogEmulationTypeMask),
+		LoadSegment: binary.LittleEndian.Uint16(data[2:4]),
+		SystemType:  data[4],
+		SectorCount: binary.LittleEndian.Uint16(data[6:8]),
+		LoadRBA:     binary.LittleEndian.Uint32(data[8:12]),
+	}, nil
+}
+
+// MarshalBinary encodes the boot catalog, see El Torito 2.0
+func (bc *BootCatalog) MarshalBinary() ([]byte, error) {
+	if bc.Default == nil {
+		return nil, fmt.Errorf("the boot catalog has no default entry")
+	}
+	if len(bc.ID) > 24 {
+		return nil, fmt.Errorf("boot catalog ID %q is longer than 24 bytes", bc.ID)
+	}
+
+	validation := make([]byte, bootCatalogEntrySize)
+	validation[0] = bootCatalogValidationEntry
+	validation[1] = byte(bc.Platform)
+	copy(validation[4:28], bc.ID)
+	validation[30], validation[31] = 0x55, 0xAA
+
+	var sum uint16
+	for i := 0; i < bootCatalogEntrySize; i += 2 {
+		sum += binary.LittleEndian.Uint16(validation[i : i+2])
+	}
+	binary.LittleEndian.PutUint16(validation[28:30], -sum)
+
+	output := append(validation, bc.Default.marshal()...)
+
+	for i, section := range bc.Sections {
+		if len(section.ID) > 28 {
+			return nil, fmt.Errorf("boot catalog section ID %q is longer than 28 bytes", section.ID)
+		}
+		if len(section.Entries) > 0xFFFF {
+			return nil, fmt.Errorf("boot catalog section %q has too many entries", section.ID)
+		}
+
+		header := make([]byte, bootCatalogEntrySize)
+		header[0] = bootCatalogSectionHeader
+		if i == len(bc.Sections)-1 {
+			header[0] = bootCatalogFinalHeader
+		}
+		header[1] = byte(section.Platform)
+		binary.LittleEndian.PutUint16(header[2:4], uint16(len(section.Entries)))
+		copy(header[4:32], section.ID)
+		output = append(output, header...)
+
+		for _, entry := range section.Entries {
+			output = append(output, entry.marshalSectionEntry()...)
+		}
+	}
+
+	return output, nil
+}
+
+// marshal encodes the fields shared by the initial/default entry and section entries
+func (be *BootEntry) marshal() []byte {
+	data := make([]byte, bootCatalogEntrySize)
+	data[0] = bootCatalogNotBootable
+	if be.Bootable {
+		data[0] = bootCatalogBootable
+	}
+	data[1] = byte(be.Emulation)
+	binary.LittleEndian.PutUint16(data[2:4], be.LoadSegment)
+	data[4] = be.SystemType
+	binary.LittleEndian.PutUint16(data[6:8], be.SectorCount)
+	binary.LittleEndian.PutUint32(data[8:12], be.LoadRBA)
+	return data
+}
+
+// marshalSectionEntry encodes a section entry followed by the extensions
+// needed to hold its selection criteria, see El Torito 2.4 and 2.5
+func (be *BootEntry) marshalSectionEntry() []byte {
+	data := be.marshal()
+	data[12] = be.SelectionCriteriaType
+	criteria := be.SelectionCriteria[copy(data[13:32], be.SelectionCriteria):]
+	if len(criteria) > 0 {
+		data[1] |= bootCatalogExtensionFollows
+	}
+
+	for len(criteria) > 0 {
+		extension := make([]byte, bootCatalogEntrySize)
+		extension[0] = bootCatalogEntryExtension
+		criteria = criteria[copy(extension[2:32], criteria):]
+		if len(criteria) > 0 {
+			extension[1] = bootCatalogExtensionFollows
+		}
+		data = append(data, extension...)
+	}
+
+	return data
+}
+
+// BootImageOptions describes how a boot image is recorded in the El Torito boot catalog
+type BootImageOptions struct {
+	// Emulation is the kind of media the BIOS presents the boot image as. Images for floppy
+	// emulation have to be exactly as large as the diskette and images for hard disk emulation
+	// have to start with a master boot record describing a single partition.
+	Emulation BootEmulation
+
+	// LoadSegment is the segment the image is loaded to. 0 stands for the traditional segment 0x7C0.
+	LoadSegment uint16
+
+	// SectorCount is the number of emulated 512-byte sectors the BIOS loads in no emulation mode.
+	// If it is 0, the whole image gets loaded.
+	SectorCount uint16
+
+	// BootInfoTable makes the writer patch a boot info table into bytes 8-63 of the recorded image,
+	// like mkisofs -boot-info-table. Boot loaders such as isolinux rely on it to find themselves.
+	BootInfoTable bool
+
+	// Platform is the system the image boots on. The platform of the first boot image is recorded
+	// in the validation entry, subsequent images are grouped into sections by platform and SectionID.
+	// UEFI firmware looks for an image of a FAT EFI System Partition in a BootPlatformEFI section.
+	Platform BootPlatform
+
+	// SectionID identifies the section of the boot catalog the image is recorded in.
+	// Consecutive images with the same Platform and SectionID share a section.
+	SectionID string
+
+	// NotBootable clears the boot indicator of the entry.
+	NotBootable bool
+
+	// SelectionCriteriaType and SelectionCriteria are vendor unique selection criteria of the entry.
+	// They are only recorded in section entries, so the first boot image cannot have them.
+	SelectionCriteriaType byte
+	SelectionCriteria     []byte
+}
+
+// bootImage is a staged file to be recorded as a boot image
+type bootImage struct {
+	target  string
+	options BootImageOptions
+}
+
+// WithBootCatalog sets the path under which the El Torito boot catalog is recorded.
+// By default it is recorded as boot.cat in the root directory.
+func WithBootCatalog(catalogPath string) WriterOption {
+	return func(iw *ImageWriter) {
+		iw.bootCatalogPath = catalogPath
+	}
+}
+
+// AddBootImage makes the file added to the staging area under the given path an El Torito boot image.
+// The first boot image becomes the initial/default entry of the boot catalog,
+// the following ones are recorded in sections of the catalog.
+// The file itself can be added before or after calling AddBootImage.
+func (iw *ImageWriter) AddBootImage(target string, options BootImageOptions) error {
+	if options.BootInfoTable && options.Emulation != BootEmulationNone {
+		return fmt.Errorf("a boot info table can only be patched into images booted without emulation")
+	}
+	if options.Emulation > BootEmulationHardDisk {
+		return fmt.Errorf("unknown boot emulation %d", options.Emulation)
+	}
+	if len(options.SectionID) > 28 {
+		return fmt.Errorf("boot catalog section ID %q is longer than 28 bytes", options.SectionID)
+	}
+	if len(iw.bootImages) == 0 && (options.SelectionCriteriaType != 0 || len(options.SelectionCriteria) > 0 || options.SectionID != "") {
+		return fmt.Errorf("the first boot image becomes the default entry, which has no section ID or selection criteria")
+	}
+
+	iw.bootImages = append(iw.bootImages, bootImage{target: target, options: options})
+	return iw.stageBootCatalog()
+}
+
+func (iw *ImageWriter) bootCatalogTarget() string {
+	if iw.bootCatalogPath == "" {
+		return defaultBootCatalogPath
+	}
+	return iw.bootCatalogPath
+}
+
+// stageBootCatalog stages a placeholder as large as the boot catalog,
+// whose contents can only be generated once all files are placed.
+func (iw *ImageWriter) stageBootCatalog() error {
+	catalog, err := iw.bootCatalog(func(*bootImage) (*BootEntry, error) { return &BootEntry{}, nil })
+	if err != nil {
+		return err
+	}
+
+	data, err := catalog.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return iw.AddFile(strings.NewReader(string(make([]byte, fileLengthToSectors(uint32(len(data)))*sectorSize))), iw.bootCatalogTarget())
+}
+
+// bootCatalog assembles the boot catalog from the entries created for each boot image
+func (iw *ImageWriter) bootCatalog(createEntry func(*bootImage) (*BootEntry, error)) (*BootCatalog, error) {
+	catalog := &BootCatalog{}
+
+	for i := range iw.bootImages {
+		bi := &iw.bootImages[i]
+		entry, err := createEntry(bi)
+		if err != nil {
+			return nil, err
+		}
+		entry.Bootable = !bi.options.NotBootable
+
+		if i == 0 {
+			catalog.Platform = bi.options.Platform
+			catalog.Default = entry
+			continue
+		}
+
+		// section entries always hold 19 bytes of selection criteria, see El Torito 2.4
+		entry.SelectionCriteriaType = bi.options.SelectionCriteriaType
+		entry.SelectionCriteria = append([]byte{}, bi.options.SelectionCriteria...)
+		if len(entry.SelectionCriteria) < 19 {
+			entry.SelectionCriteria = append(entry.SelectionCriteria, make([]byte, 19-len(entry.SelectionCriteria))...)
+		}
+
+		last := len(catalog.Sections) - 1
+		if last < 0 || catalog.Sections[last].Platform != bi.options.Platform || catalog.Sections[last].ID != bi.options.SectionID {
+			catalog.Sections = append(catalog.Sections, &BootSection{Platform: bi.options.Platform, ID: bi.options.SectionID})
+			last++
+		}
+		catalog.Sections[last].Entries = append(catalog.Sections[last].Entries, entry)
+	}
+
+	return catalog, nil
+}
+
+// stagedPath returns where a file added under the given path is placed in the staging directory
+func (wc *writeContext) stagedPath(target string) string {
+	directoryPath, fileName := manglePath(target)
+	return path.Join(wc.stagingDir, directoryPath, fileName)
+}
+
+// prepareBootCatalog generates the contents of the boot catalog and patches the boot images
+// once their locations are known. It returns the location of the boot catalog.
+func (wc *writeContext) prepareBootCatalog(iw *ImageWriter) (uint32, error) {
+	catalog, err := iw.bootCatalog(wc.bootEntry)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := catalog.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	catalogPath := wc.stagedPath(iw.bootCatalogTarget())
+	catalogEntry, ok := wc.fileEntries[catalogPath]
+	if !ok {
+		return 0, fmt.Errorf("the boot catalog %q has been removed from the staging area", iw.bootCatalogTarget())
+	}
+
+	wc.generatedFiles[catalogPath] = data
+	return uint32(catalogEntry.ExtentLocation), nil
+}
+
+// bootEntry creates the boot catalog entry of a boot image already placed in the image
+func (wc *writeContext) bootEntry(bi *bootImage) (*BootEntry, error) {
+	stagedPath := wc.stagedPath(bi.target)
+	de, ok := wc.fileEntries[stagedPath]
+	if !ok {
+		return nil, fmt.Errorf("boot image %q has not been added", bi.target)
+	}
+	if _, previous := wc.previousFiles[strings.TrimPrefix(stagedPath, wc.stagingDir+"/")]; previous && (bi.options.BootInfoTable || bi.options.Emulation == BootEmulationHardDisk) {
+		// only the placeholder of the file is staged
+		return nil, fmt.Errorf("boot image %q has been recorded by the previous session and has to be added again", bi.target)
+	}
+
+	entry := &BootEntry{
+		Emulation:   bi.options.Emulation,
+		LoadSegment: bi.options.LoadSegment,
+		SectorCount: bi.options.SectorCount,
+		LoadRBA:     uint32(de.ExtentLocation),
+	}
+
+	switch bi.options.Emulation {
+	case BootEmulationNone:
+		if entry.SectorCount == 0 {
+			sectors := (int64(de.ExtentLength) + virtualSectorSize - 1) / virtualSectorSize
+			if sectors > 0xFFFF {
+				sectors = 0xFFFF
+			}
+			entry.SectorCount = uint16(sectors)
+		}
+
+		if bi.options.BootInfoTable {
+			data, err := os.ReadFile(stagedPath)
+			if err != nil {
+				return nil, err
+			}
+			if err := patchBootInfoTable(data, wc.sessionStart+systemAreaSectors, entry.LoadRBA); err != nil {
+				return nil, fmt.Errorf("boot image %q: %w", bi.target, err)
+			}
+			wc.generatedFiles[stagedPath] = data
+		}
+	case BootEmulationHardDisk:
+		systemType, err := hardDiskImageSystemType(stagedPath)
+		if err != nil {
+			return nil, fmt.Errorf("boot image %q: %w", bi.target, err)
+		}
+		entry.SystemType = systemType
+		entry.SectorCount = 1
+	default:
+		if size := bi.options.Emulation.floppySize(); int64(de.ExtentLength) != size {
+			return nil, fmt.Errorf("boot image %q has %d bytes instead of the %d bytes of a %s", bi.target, de.ExtentLength, size, bi.options.Emulation)
+		}
+		entry.SectorCount = 1
+	}
+
+	return entry, nil
+}
+
+// patchBootInfoTable records the location of the primary volume descriptor, the location and length
+// of the boot image and a checksum of its remaining data within the image, like mkisofs -boot-info-table.
+func patchBootInfoTable(data []byte, pvdLocation uint32, location uint32) error {
+	if len(data) < bootInfoTableEnd {
+		return fmt.Errorf("the image is too small to hold a boot info table")
+	}
+
+	// the checksum is the sum of all 32-bit words following the table
+	var checksum uint32
+	for i := bootInfoTableEnd; i < len(data); i += 4 {
+		word := make([]byte, 4)
+		copy(word, data[i:])
+		checksum += binary.LittleEndian.Uint32(word)
+	}
+
+	table := data[bootInfoTableOffset:bootInfoTableEnd]
+	for i := range table {
+		table[i] = 0
+	}
+	binary.LittleEndian.PutUint32(table[0:4], pvdLocation)
+	binary.LittleEndian.PutUint32(table[4:8], location)
+	binary.LittleEndian.PutUint32(table[8:12], uint32(len(data)))
+	binary.LittleEndian.PutUint32(table[12:16], checksum)
+
+	return nil
+}
+
+// hardDiskImageSystemType returns the type of the only partition of a hard disk image, which El Torito
+// records in the boot catalog. See El Torito 2.2.
+func hardDiskImageSystemType(stagedPath string) (byte, error) {
+	f, err := os.Open(stagedPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	mbr := make([]byte, 512)
+	if _, err := io.ReadFull(f, mbr); err != nil {
+		return 0, fmt.Errorf("reading the master boot record: %w", err)
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xAA {
+		return 0, fmt.Errorf("the image does not start with a master boot record")
+	}
+
+	var systemType byte
+	for i := 0; i < 4; i++ {
+		partitionType := mbr[446+16*i+4]
+		if partitionType == 0 {
+			continue
+		}
+		if systemType != 0 {
+			return 0, fmt.Errorf("hard disk images must contain a single partition")
+		}
+		systemType = partitionType
+	}
+
+	if systemType == 0 {
+		return 0, fmt.Errorf("the master boot record contains no partition")
+	}
+	return systemType, nil
+}
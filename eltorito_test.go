@@ -0,0 +1,384 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bootCatalogEntry(fields ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		_ = binary.Write(&buf, binary.LittleEndian, f)
+	}
+	entry := make([]byte, bootCatalogEntrySize)
+	copy(entry, buf.Bytes())
+	return entry
+}
+
+func TestImageBootCatalog(t *testing.T) {
+	isolinux := bytes.Repeat([]byte{0xAA}, 3000)
+	efiboot := bytes.Repeat([]byte{0xEF}, 4096)
+
+	rootDot := &DirectoryEntry{ExtentLocation: 19, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00"}
+	rootDotDot := &DirectoryEntry{ExtentLocation: 19, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+	efibootDE := &DirectoryEntry{ExtentLocation: 23, ExtentLength: uint32(len(efiboot)), Identifier: "EFIBOOT.IMG;1"}
+	isolinuxDE := &DirectoryEntry{ExtentLocation: 21, ExtentLength: uint32(len(isolinux)), Identifier: "ISOLINUX.BIN;1"}
+
+	bootRecord := make([]byte, sectorSize)
+	copy(bootRecord, []byte{volumeTypeBoot, 'C', 'D', '0', '0', '1', 1})
+	copy(bootRecord[7:], elToritoBootSystemIdentifier)
+	binary.LittleEndian.PutUint32(bootRecord[71:], 20)
+
+	validation := bootCatalogEntry(byte(1), byte(BootPlatformX86), uint16(0), [24]byte{'T', 'E', 'S', 'T'}, uint16(0), byte(0x55), byte(0xAA))
+	var sum uint16
+	for i := 0; i < len(validation); i += 2 {
+		sum += binary.LittleEndian.Uint16(validation[i:])
+	}
+	binary.LittleEndian.PutUint16(validation[28:], -sum)
+
+	var catalog bytes.Buffer
+	catalog.Write(validation)
+	catalog.Write(bootCatalogEntry(byte(0x88), byte(BootEmulationNone), uint16(0), byte(0), byte(0), uint16(4), uint32(21)))
+	catalog.Write(bootCatalogEntry(byte(0x90), byte(BootPlatformEFI), uint16(1), [28]byte{'U', 'E', 'F', 'I'}))
+	catalog.Write(bootCatalogEntry(byte(0x88), byte(BootEmulationNone)|0x20, uint16(0), byte(0), byte(0), uint16(0), uint32(23), byte(1), [19]byte{'a'}))
+	catalog.Write(bootCatalogEntry(byte(0x44), byte(0), [30]byte{'b'}))
+	catalog.Write(bootCatalogEntry(byte(0x91), byte(BootPlatformPowerPC), uint16(1)))
+	catalog.Write(bootCatalogEntry(byte(0x00), byte(BootEmulationFloppy144), uint16(0x1000), byte(0), byte(0), uint16(1), uint32(25)))
+
+	var image bytes.Buffer
+	image.Write(make([]byte, systemAreaSize))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: 26, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: rootDotDot},
+	}))
+	image.Write(bootRecord)
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	image.Write(marshalDirectory(t, rootDot, rootDotDot, efibootDE, isolinuxDE))
+	catalogSector := make([]byte, sectorSize)
+	copy(catalogSector, catalog.Bytes())
+	image.Write(catalogSector)
+	image.Write(isolinux)
+	image.Write(make([]byte, 2*sectorSize-uint32(len(isolinux))))
+	image.Write(efiboot)
+	image.Write(make([]byte, sectorSize))
+
+	img, err := OpenImage(bytes.NewReader(image.Bytes()))
+	assert.NoError(t, err)
+
+	bc, err := img.BootCatalog()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, BootPlatformX86, bc.Platform)
+	assert.Equal(t, "TEST", bc.ID)
+
+	assert.True(t, bc.Default.Bootable)
+	assert.Equal(t, BootEmulationNone, bc.Default.Emulation)
+	assert.Equal(t, uint16(4), bc.Default.SectorCount)
+	assert.Equal(t, uint32(21), bc.Default.LoadRBA)
+	data, err := io.ReadAll(bc.Default.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, isolinux, data)
+
+	if !assert.Len(t, bc.Sections, 2) {
+		return
+	}
+
+	efi := bc.Sections[0]
+	assert.Equal(t, BootPlatformEFI, efi.Platform)
+	assert.Equal(t, "UEFI", efi.ID)
+	if assert.Len(t, efi.Entries, 1) {
+		assert.Equal(t, byte(1), efi.Entries[0].SelectionCriteriaType)
+		assert.Len(t, efi.Entries[0].SelectionCriteria, 19+30)
+		assert.Equal(t, byte('b'), efi.Entries[0].SelectionCriteria[19])
+
+		data, err := io.ReadAll(efi.Entries[0].Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, efiboot, data)
+	}
+
+	ppc := bc.Sections[1]
+	assert.Equal(t, BootPlatformPowerPC, ppc.Platform)
+	if assert.Len(t, ppc.Entries, 1) {
+		assert.False(t, ppc.Entries[0].Bootable)
+		assert.Equal(t, uint16(0x1000), ppc.Entries[0].LoadSegment)
+		assert.Equal(t, BootEmulationFloppy144, ppc.Entries[0].Emulation)
+		assert.Equal(t, int64(1440*1024), ppc.Entries[0].Size())
+	}
+}
+
+func TestImageBootCatalogMissing(t *testing.T) {
+	f, err := os.Open("fixtures/test.iso")
+	assert.NoError(t, err)
+	defer f.Close() // nolint: errcheck
+
+	img, err := OpenImage(f)
+	assert.NoError(t, err)
+
+	_, err = img.BootCatalog()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBootCatalogValidationEntry(t *testing.T) {
+	entry := bootCatalogEntry(byte(1), byte(0), uint16(0), [24]byte{}, uint16(0x55AA), byte(0x55), byte(0xAA))
+	assert.NoError(t, checkBootCatalogValidationEntry(entry))
+
+	entry[4] = 'X'
+	assert.EqualError(t, checkBootCatalogValidationEntry(entry), "invalid validation entry checksum")
+
+	entry[30] = 0
+	assert.Error(t, checkBootCatalogValidationEntry(entry))
+}
+
+// writeBootableImage writes an image containing the given files, the first one of which is the boot image
+func writeBootableImage(t *testing.T, options BootImageOptions, files map[string][]byte, bootImage string) (*Image, error) {
+	w, err := NewWriter()
+	assert.NoError(t, err)
+	defer func() {
+		if cleanupErr := w.Cleanup(); cleanupErr != nil {
+			t.Fatalf("failed to cleanup writer: %v", cleanupErr)
+		}
+	}()
+
+	for name, data := range files {
+		assert.NoError(t, w.AddFile(bytes.NewReader(data), name))
+	}
+	if err := w.AddBootImage(bootImage, options); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := w.WriteTo(&buf, "bootable"); err != nil {
+		return nil, err
+	}
+
+	return OpenImage(bytes.NewReader(buf.Bytes()))
+}
+
+func TestWriterBootInfoTable(t *testing.T) {
+	isolinux := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(isolinux)
+
+	img, err := writeBootableImage(t, BootImageOptions{SectorCount: 4, BootInfoTable: true}, map[string][]byte{
+		"isolinux/isolinux.bin": isolinux,
+		"readme.txt":            []byte(loremIpsum),
+	}, "isolinux/isolinux.bin")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the boot record directly follows the primary volume descriptor
+	if assert.Len(t, img.volumeDescriptors, 3) {
+		assert.Equal(t, volumeTypeBoot, img.volumeDescriptors[1].Type())
+	}
+
+	bc, err := img.BootCatalog()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, BootPlatformX86, bc.Platform)
+	assert.Len(t, bc.Sections, 0)
+	assert.True(t, bc.Default.Bootable)
+	assert.Equal(t, BootEmulationNone, bc.Default.Emulation)
+	assert.Equal(t, uint16(4), bc.Default.SectorCount)
+	assert.Equal(t, int64(len(isolinux)), bc.Default.Size())
+
+	patched, err := io.ReadAll(bc.Default.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, isolinux[:8], patched[:8])
+	assert.Equal(t, isolinux[64:], patched[64:])
+
+	var checksum uint32
+	for i := 64; i < len(isolinux); i += 4 {
+		checksum += binary.LittleEndian.Uint32(isolinux[i:])
+	}
+	assert.Equal(t, uint32(16), binary.LittleEndian.Uint32(patched[8:]))
+	assert.Equal(t, bc.Default.LoadRBA, binary.LittleEndian.Uint32(patched[12:]))
+	assert.Equal(t, uint32(len(isolinux)), binary.LittleEndian.Uint32(patched[16:]))
+	assert.Equal(t, checksum, binary.LittleEndian.Uint32(patched[20:]))
+	assert.Equal(t, make([]byte, 40), patched[24:64])
+
+	// the boot catalog is a regular file
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	children, err := root.GetChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, children, 3) {
+		assert.Equal(t, "boot.cat", children[0].Name())
+		assert.Equal(t, int64(sectorSize), children[0].Size())
+	}
+}
+
+func TestWriterBootEmulation(t *testing.T) {
+	mbr := make([]byte, 1024*1024)
+	mbr[446+4] = 0x0C // FAT32 LBA
+	mbr[510], mbr[511] = 0x55, 0xAA
+
+	for _, tc := range []struct {
+		emulation          BootEmulation
+		image              []byte
+		loadSegment        uint16
+		expectedSystemType byte
+		expectedError      string
+	}{
+		{emulation: BootEmulationFloppy12, image: make([]byte, 1200*1024)},
+		{emulation: BootEmulationFloppy144, image: make([]byte, 1440*1024), loadSegment: 0x1000},
+		{emulation: BootEmulationFloppy288, image: make([]byte, 2880*1024)},
+		{emulation: BootEmulationFloppy144, image: make([]byte, 1200*1024), expectedError: "has 1228800 bytes instead of the 1474560 bytes of a 1.44 MB floppy"},
+		{emulation: BootEmulationHardDisk, image: mbr, expectedSystemType: 0x0C},
+		{emulation: BootEmulationHardDisk, image: make([]byte, 1024), expectedError: "the image does not start with a master boot record"},
+	} {
+		t.Run(tc.emulation.String(), func(t *testing.T) {
+			img, err := writeBootableImage(t, BootImageOptions{Emulation: tc.emulation, LoadSegment: tc.loadSegment}, map[string][]byte{"boot/disk.img": tc.image}, "boot/disk.img")
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			bc, err := img.BootCatalog()
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.emulation, bc.Default.Emulation)
+			assert.Equal(t, tc.loadSegment, bc.Default.LoadSegment)
+			assert.Equal(t, uint16(1), bc.Default.SectorCount)
+			assert.Equal(t, tc.expectedSystemType, bc.Default.SystemType)
+			assert.Equal(t, int64(len(tc.image)), bc.Default.Size())
+		})
+	}
+}
+
+func TestWriterBootImageErrors(t *testing.T) {
+	_, err := writeBootableImage(t, BootImageOptions{}, map[string][]byte{"readme.txt": []byte(loremIpsum)}, "isolinux.bin")
+	assert.ErrorContains(t, err, `boot image "isolinux.bin" has not been added`)
+
+	_, err = writeBootableImage(t, BootImageOptions{Emulation: BootEmulationFloppy144, BootInfoTable: true}, nil, "floppy.img")
+	assert.ErrorContains(t, err, "a boot info table can only be patched into images booted without emulation")
+}
+
+func TestBootCatalogRoundTrip(t *testing.T) {
+	catalog := &BootCatalog{
+		Platform: BootPlatformX86,
+		ID:       "ROUND TRIP",
+		Default:  &BootEntry{Bootable: true, SectorCount: 4, LoadRBA: 30},
+		Sections: []*BootSection{
+			{Platform: BootPlatformEFI, ID: "UEFI", Entries: []*BootEntry{
+				{Bootable: true, LoadRBA: 40, SelectionCriteriaType: 1, SelectionCriteria: bytes.Repeat([]byte{'x'}, 19+3*30)},
+				{LoadRBA: 50, Emulation: BootEmulationHardDisk, SystemType: 0xEF, SelectionCriteria: make([]byte, 19)},
+			}},
+			{Platform: BootPlatformMac, Entries: []*BootEntry{{Bootable: true, LoadRBA: 60, SelectionCriteria: make([]byte, 19)}}},
+		},
+	}
+
+	data, err := catalog.MarshalBinary()
+	assert.NoError(t, err)
+	// validation, default, 2 headers, 3 entries and 3 extensions holding the rest of the selection criteria
+	assert.Len(t, data, 10*bootCatalogEntrySize)
+
+	sector := make([]byte, sectorSize)
+	copy(sector, data)
+	decoded, err := readBootCatalog(bytes.NewReader(sector), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, catalog, decoded)
+}
+
+func TestWriterBootSections(t *testing.T) {
+	w, err := NewWriter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	isolinux := make([]byte, 4096)
+	esp := make([]byte, 64*1024)
+	for name, data := range map[string][]byte{
+		"isolinux/isolinux.bin": isolinux,
+		"efi/efiboot.img":       esp,
+		"efi/other.img":         esp,
+		"ppc/boot.img":          isolinux,
+	} {
+		assert.NoError(t, w.AddFile(bytes.NewReader(data), name))
+	}
+
+	assert.NoError(t, w.AddBootImage("isolinux/isolinux.bin", BootImageOptions{BootInfoTable: true}))
+	assert.NoError(t, w.AddBootImage("efi/efiboot.img", BootImageOptions{Platform: BootPlatformEFI}))
+	assert.NoError(t, w.AddBootImage("efi/other.img", BootImageOptions{Platform: BootPlatformEFI, NotBootable: true, SelectionCriteriaType: 1, SelectionCriteria: bytes.Repeat([]byte{'c'}, 40)}))
+	assert.NoError(t, w.AddBootImage("ppc/boot.img", BootImageOptions{Platform: BootPlatformPowerPC, SectionID: "POWER"}))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "sections")) {
+		return
+	}
+
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	bc, err := img.BootCatalog()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, BootPlatformX86, bc.Platform)
+	assert.True(t, bc.Default.Bootable)
+	assert.Equal(t, int64(len(isolinux)), bc.Default.Size())
+
+	if !assert.Len(t, bc.Sections, 2) {
+		return
+	}
+
+	efi := bc.Sections[0]
+	assert.Equal(t, BootPlatformEFI, efi.Platform)
+	if assert.Len(t, efi.Entries, 2) {
+		assert.True(t, efi.Entries[0].Bootable)
+		assert.Equal(t, BootEmulationNone, efi.Entries[0].Emulation)
+		assert.Equal(t, uint16(len(esp)/virtualSectorSize), efi.Entries[0].SectorCount)
+		assert.Equal(t, int64(len(esp)), efi.Entries[0].Size())
+		assert.Equal(t, make([]byte, 19), efi.Entries[0].SelectionCriteria)
+
+		assert.False(t, efi.Entries[1].Bootable)
+		assert.Equal(t, byte(1), efi.Entries[1].SelectionCriteriaType)
+		// the criteria continue in an extension entry padded to 30 bytes
+		assert.Equal(t, append(bytes.Repeat([]byte{'c'}, 40), make([]byte, 19+30-40)...), efi.Entries[1].SelectionCriteria)
+		assert.NotEqual(t, efi.Entries[0].LoadRBA, efi.Entries[1].LoadRBA)
+	}
+
+	ppc := bc.Sections[1]
+	assert.Equal(t, BootPlatformPowerPC, ppc.Platform)
+	assert.Equal(t, "POWER", ppc.ID)
+	assert.Len(t, ppc.Entries, 1)
+}
+
+func TestWriterBootSectionErrors(t *testing.T) {
+	w, err := NewWriter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	assert.ErrorContains(t, w.AddBootImage("efi.img", BootImageOptions{Platform: BootPlatformEFI, SelectionCriteria: []byte{1}}), "the first boot image becomes the default entry")
+	assert.NoError(t, w.AddBootImage("isolinux.bin", BootImageOptions{}))
+	assert.ErrorContains(t, w.AddBootImage("efi.img", BootImageOptions{SectionID: strings.Repeat("x", 29)}), "longer than 28 bytes")
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package iso9660
+
+import "os"
+
+// fileOwner returns the user and group owning a local file.
+// Files are owned by root on platforms without POSIX ownership.
+func fileOwner(info os.FileInfo) (uint32, uint32) {
+	return 0, 0
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package iso9660
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the user and group owning a local file
+func fileOwner(info os.FileInfo) (uint32, uint32) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Uid, stat.Gid
+	}
+
+	return 0, 0
+}
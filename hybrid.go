@@ -0,0 +1,238 @@
+package iso9660
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"unicode/utf16"
+)
+
+// UEFI Specification 2.10, chapter 5: GUID Partition Table (GPT) Disk Layout
+// https://uefi.org/specs/UEFI/2.10/05_GUID_Partition_Table_Format.html
+
+const (
+	// hybrid images are partitioned in 512-byte logical blocks, as seen when the image is written to a USB stick
+	diskBlockSize  = 512
+	blocksInSector = 2048 / diskBlockSize
+
+	mbrBootCodeLength      = 432 // the rest of the 440 bytes of boot code holds the boot image location
+	mbrBootImageOffset     = 432
+	mbrDiskSignatureOffset = 440
+	mbrPartitionOffset     = 446
+	mbrPartitionEntrySize  = 16
+	mbrTypeProtective      = 0xEE
+	mbrActive              = 0x80
+
+	gptSignature          = "EFI PART"
+	gptRevision           = 0x00010000
+	gptHeaderSize         = 92
+	gptPartitionEntries   = 128
+	gptPartitionEntrySize = 128
+	gptEntryBlocks        = gptPartitionEntries * gptPartitionEntrySize / diskBlockSize
+
+	// the backup partition entries and header fill the last 33 blocks of the image,
+	// which are appended to it in whole sectors
+	gptBackupSectors = (gptEntryBlocks + 1 + blocksInSector - 1) / blocksInSector
+)
+
+var (
+	gptTypeBasicData = guid{0xA2, 0xA0, 0xD0, 0xEB, 0xE5, 0xB9, 0x33, 0x44, 0x87, 0xC0, 0x68, 0xB6, 0xB7, 0x26, 0x99, 0xC7} // EBD0A0A2-B9E5-4433-87C0-68B6B72699C7
+	gptTypeEFISystem = guid{0x28, 0x73, 0x2A, 0xC1, 0x1F, 0xF8, 0xD2, 0x11, 0xBA, 0x4B, 0x00, 0xA0, 0xC9, 0x3E, 0xC9, 0x3B} // C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+)
+
+// guid is a GUID in its on-disk mixed-endian encoding
+type guid [16]byte
+
+// randomGUID generates a version 4 GUID
+func randomGUID() (guid, error) {
+	var g guid
+	if _, err := rand.Read(g[:]); err != nil {
+		return g, err
+	}
+	g[7] = g[7]&0x0F | 0x40 // the version is in the most significant bits of the little-endian third field
+	g[8] = g[8]&0x3F | 0x80
+	return g, nil
+}
+
+// gptPartition is a partition of a hybrid image in logical blocks of 512 bytes
+type gptPartition struct {
+	typeGUID   guid
+	firstBlock uint64
+	lastBlock  uint64
+	name       string
+}
+
+// WithIsohybrid makes the ImageWriter partition the image, so that it can be booted after being copied
+// to a USB stick as well as from an optical disc. The system area receives a protective master boot record
+// and a GUID Partition Table with a partition covering the ISO9660 data and, if there is a boot image for
+// BootPlatformEFI, another one for the EFI System Partition image. As partitions must not overlap, the
+// ISO9660 data is then covered by one partition before and one after the EFI System Partition.
+// The backup GPT is appended to the image.
+//
+// mbrCode is placed at the start of the master boot record to boot BIOS systems, e.g. isohdpfx.bin of isolinux.
+// Like isohybrid, the writer records the location of the default boot image right after the code.
+// It may be nil for images which only boot UEFI systems from USB media.
+func WithIsohybrid(mbrCode []byte) WriterOption {
+	return func(iw *ImageWriter) {
+		iw.isohybrid = true
+		iw.mbrCode = mbrCode
+	}
+}
+
+// WithIsohybridActive marks the partition of the protective master boot record of an isohybrid image
+// as active. Some BIOSes refuse to boot from disks without an active partition, although UEFI 5.2.3
+// requires the protective partition to be inactive, which strict UEFI firmware may insist on.
+// It requires WithIsohybrid.
+func WithIsohybridActive() WriterOption {
+	return func(iw *ImageWriter) {
+		iw.mbrActive = true
+	}
+}
+
+// hybridPartitions returns the partitions of a hybrid image of the given number of sectors
+func (wc *writeContext) hybridPartitions(iw *ImageWriter, imageSectors uint32) ([]gptPartition, error) {
+	data := gptPartition{
+		typeGUID:   gptTypeBasicData,
+		firstBlock: systemAreaSectors * blocksInSector,
+		lastBlock:  uint64(imageSectors-gptBackupSectors)*blocksInSector - 1,
+		name:       "ISO9660",
+	}
+
+	for _, bi := range iw.bootImages {
+		if bi.options.Platform != BootPlatformEFI {
+			continue
+		}
+
+		de, ok := wc.fileEntries[wc.stagedPath(bi.target)]
+		if !ok {
+			return nil, fmt.Errorf("boot image %q has not been added", bi.target)
+		}
+		if de.ExtentLength == 0 {
+			return nil, fmt.Errorf("the EFI System Partition image %q is empty", bi.target)
+		}
+
+		// the ISO9660 data around the ESP is split into two partitions instead of one containing it
+		first := uint64(de.ExtentLocation) * blocksInSector
+		esp := gptPartition{
+			typeGUID:   gptTypeEFISystem,
+			firstBlock: first,
+			lastBlock:  first + (uint64(de.ExtentLength)+diskBlockSize-1)/diskBlockSize - 1,
+			name:       "EFI System Partition",
+		}
+
+		before, after := data, data
+		before.lastBlock = esp.firstBlock - 1
+		after.firstBlock = esp.lastBlock + 1
+
+		partitions := []gptPartition{before, esp}
+		if after.firstBlock <= after.lastBlock {
+			partitions = append(partitions, after)
+		}
+		return partitions, nil
+	}
+
+	return []gptPartition{data}, nil
+}
+
+// hybridSystemArea creates the system area of a hybrid image and the backup GPT written at its end
+func (wc *writeContext) hybridSystemArea(iw *ImageWriter, imageSectors uint32) ([]byte, []byte, error) {
+	if len(iw.mbrCode) > mbrBootCodeLength {
+		return nil, nil, fmt.Errorf("the MBR boot code has %d bytes, more than the %d bytes available", len(iw.mbrCode), mbrBootCodeLength)
+	}
+
+	partitions, err := wc.hybridPartitions(iw, imageSectors)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	diskGUID, err := randomGUID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]byte, gptEntryBlocks*diskBlockSize)
+	for i, p := range partitions {
+		uniqueGUID, err := randomGUID()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entry := entries[i*gptPartitionEntrySize : (i+1)*gptPartitionEntrySize]
+		copy(entry[0:16], p.typeGUID[:])
+		copy(entry[16:32], uniqueGUID[:])
+		binary.LittleEndian.PutUint64(entry[32:40], p.firstBlock)
+		binary.LittleEndian.PutUint64(entry[40:48], p.lastBlock)
+		for j, c := range utf16.Encode([]rune(p.name)) {
+			binary.LittleEndian.PutUint16(entry[56+2*j:], c)
+		}
+	}
+
+	totalBlocks := uint64(imageSectors) * blocksInSector
+	backupHeaderBlock := totalBlocks - 1
+	backupEntriesBlock := backupHeaderBlock - gptEntryBlocks
+
+	header := func(myBlock, alternateBlock, entriesBlock uint64) []byte {
+		h := make([]byte, diskBlockSize)
+		copy(h[0:8], gptSignature)
+		binary.LittleEndian.PutUint32(h[8:12], gptRevision)
+		binary.LittleEndian.PutUint32(h[12:16], gptHeaderSize)
+		binary.LittleEndian.PutUint64(h[24:32], myBlock)
+		binary.LittleEndian.PutUint64(h[32:40], alternateBlock)
+		binary.LittleEndian.PutUint64(h[40:48], 2+gptEntryBlocks) // first usable block
+		binary.LittleEndian.PutUint64(h[48:56], backupEntriesBlock-1)
+		copy(h[56:72], diskGUID[:])
+		binary.LittleEndian.PutUint64(h[72:80], entriesBlock)
+		binary.LittleEndian.PutUint32(h[80:84], gptPartitionEntries)
+		binary.LittleEndian.PutUint32(h[84:88], gptPartitionEntrySize)
+		binary.LittleEndian.PutUint32(h[88:92], crc32.ChecksumIEEE(entries))
+		binary.LittleEndian.PutUint32(h[16:20], crc32.ChecksumIEEE(h[:gptHeaderSize]))
+		return h
+	}
+
+	systemArea := make([]byte, systemAreaSectors*int(sectorSize))
+	copy(systemArea, wc.protectiveMBR(iw, totalBlocks, binary.LittleEndian.Uint32(diskGUID[0:4])))
+	copy(systemArea[diskBlockSize:], header(1, backupHeaderBlock, 2))
+	copy(systemArea[2*diskBlockSize:], entries)
+
+	tail := make([]byte, gptBackupSectors*int(sectorSize))
+	backup := tail[len(tail)-(gptEntryBlocks+1)*diskBlockSize:]
+	copy(backup, entries)
+	copy(backup[gptEntryBlocks*diskBlockSize:], header(backupHeaderBlock, 1, backupEntriesBlock))
+
+	return systemArea, tail, nil
+}
+
+// protectiveMBR creates a master boot record whose only partition protects the GPT, see UEFI 5.2.3
+func (wc *writeContext) protectiveMBR(iw *ImageWriter, totalBlocks uint64, diskSignature uint32) []byte {
+	mbr := make([]byte, diskBlockSize)
+	copy(mbr, iw.mbrCode)
+
+	if len(iw.mbrCode) > 0 {
+		// isohybrid MBR code loads the default boot image from the block recorded after it
+		if len(iw.bootImages) > 0 {
+			if de, ok := wc.fileEntries[wc.stagedPath(iw.bootImages[0].target)]; ok {
+				binary.LittleEndian.PutUint64(mbr[mbrBootImageOffset:], uint64(de.ExtentLocation)*blocksInSector)
+			}
+		}
+		binary.LittleEndian.PutUint32(mbr[mbrDiskSignatureOffset:], diskSignature)
+	}
+
+	partitionBlocks := totalBlocks - 1
+	if partitionBlocks > 0xFFFFFFFF {
+		partitionBlocks = 0xFFFFFFFF
+	}
+
+	partition := mbr[mbrPartitionOffset : mbrPartitionOffset+mbrPartitionEntrySize]
+	if iw.mbrActive {
+		partition[0] = mbrActive
+	}
+	copy(partition[1:4], []byte{0x00, 0x02, 0x00}) // CHS of block 1
+	partition[4] = mbrTypeProtective
+	copy(partition[5:8], []byte{0xFF, 0xFF, 0xFF}) // CHS beyond the addressable range
+	binary.LittleEndian.PutUint32(partition[8:12], 1)
+	binary.LittleEndian.PutUint32(partition[12:16], uint32(partitionBlocks))
+
+	mbr[510], mbr[511] = 0x55, 0xAA
+	return mbr
+}
@@ -0,0 +1,246 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type parsedGPTHeader struct {
+	myBlock, alternateBlock      uint64
+	firstUsable, lastUsable      uint64
+	diskGUID                     guid
+	entriesBlock                 uint64
+	entryCount, entrySize        uint32
+	entriesChecksum, ownChecksum uint32
+	computedHeaderChecksum       uint32
+	computedEntriesChecksum      uint32
+	partitions                   []gptPartition
+}
+
+// parseGPTHeader decodes the GPT header at the given block along with its partition entries
+func parseGPTHeader(t *testing.T, image []byte, block uint64) *parsedGPTHeader {
+	data := image[block*diskBlockSize : (block+1)*diskBlockSize]
+	if !assert.Equal(t, gptSignature, string(data[0:8])) {
+		t.FailNow()
+	}
+	assert.Equal(t, uint32(gptRevision), binary.LittleEndian.Uint32(data[8:12]))
+	assert.Equal(t, uint32(gptHeaderSize), binary.LittleEndian.Uint32(data[12:16]))
+
+	h := &parsedGPTHeader{
+		ownChecksum:     binary.LittleEndian.Uint32(data[16:20]),
+		myBlock:         binary.LittleEndian.Uint64(data[24:32]),
+		alternateBlock:  binary.LittleEndian.Uint64(data[32:40]),
+		firstUsable:     binary.LittleEndian.Uint64(data[40:48]),
+		lastUsable:      binary.LittleEndian.Uint64(data[48:56]),
+		entriesBlock:    binary.LittleEndian.Uint64(data[72:80]),
+		entryCount:      binary.LittleEndian.Uint32(data[80:84]),
+		entrySize:       binary.LittleEndian.Uint32(data[84:88]),
+		entriesChecksum: binary.LittleEndian.Uint32(data[88:92]),
+	}
+	copy(h.diskGUID[:], data[56:72])
+
+	withoutChecksum := append([]byte{}, data[:gptHeaderSize]...)
+	copy(withoutChecksum[16:20], []byte{0, 0, 0, 0})
+	h.computedHeaderChecksum = crc32.ChecksumIEEE(withoutChecksum)
+
+	entries := image[h.entriesBlock*diskBlockSize : h.entriesBlock*diskBlockSize+uint64(h.entryCount*h.entrySize)]
+	h.computedEntriesChecksum = crc32.ChecksumIEEE(entries)
+
+	for i := uint32(0); i < h.entryCount; i++ {
+		entry := entries[i*h.entrySize : (i+1)*h.entrySize]
+		var p gptPartition
+		copy(p.typeGUID[:], entry[0:16])
+		if p.typeGUID == (guid{}) {
+			continue
+		}
+		p.firstBlock = binary.LittleEndian.Uint64(entry[32:40])
+		p.lastBlock = binary.LittleEndian.Uint64(entry[40:48])
+
+		var name []uint16
+		for j := 56; j < 128; j += 2 {
+			if c := binary.LittleEndian.Uint16(entry[j:]); c != 0 {
+				name = append(name, c)
+			}
+		}
+		p.name = string(utf16.Decode(name))
+		h.partitions = append(h.partitions, p)
+	}
+
+	return h
+}
+
+func TestWriterIsohybrid(t *testing.T) {
+	mbrCode := bytes.Repeat([]byte{0x90}, mbrBootCodeLength)
+	isolinux := make([]byte, 4096)
+	esp := bytes.Repeat([]byte{0xEF}, 100*1024+100)
+
+	w, err := NewWriter(WithIsohybrid(mbrCode))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	assert.NoError(t, w.AddFile(bytes.NewReader(isolinux), "isolinux/isolinux.bin"))
+	assert.NoError(t, w.AddFile(bytes.NewReader(esp), "efi/efiboot.img"))
+	assert.NoError(t, w.AddFile(bytes.NewReader([]byte(loremIpsum)), "readme.txt"))
+	assert.NoError(t, w.AddBootImage("isolinux/isolinux.bin", BootImageOptions{BootInfoTable: true}))
+	assert.NoError(t, w.AddBootImage("efi/efiboot.img", BootImageOptions{Platform: BootPlatformEFI}))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "hybrid")) {
+		return
+	}
+	image := buf.Bytes()
+	totalBlocks := uint64(len(image)) / diskBlockSize
+
+	// the image is still a valid ISO9660 image spanning the whole file
+	img, err := OpenImage(bytes.NewReader(image))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(len(image)/int(sectorSize)), img.volumeDescriptors[0].Primary.VolumeSpaceSize)
+	bc, err := img.BootCatalog()
+	if !assert.NoError(t, err) || !assert.Len(t, bc.Sections, 1) {
+		return
+	}
+	espEntry := bc.Sections[0].Entries[0]
+
+	// protective MBR
+	mbr := image[:diskBlockSize]
+	assert.Equal(t, mbrCode, mbr[:mbrBootCodeLength])
+	assert.Equal(t, uint64(bc.Default.LoadRBA)*blocksInSector, binary.LittleEndian.Uint64(mbr[mbrBootImageOffset:]))
+	assert.Equal(t, []byte{0x55, 0xAA}, mbr[510:512])
+	partition := mbr[mbrPartitionOffset : mbrPartitionOffset+mbrPartitionEntrySize]
+	assert.Equal(t, byte(0), partition[0], "UEFI requires the protective partition to be inactive")
+	assert.Equal(t, byte(mbrTypeProtective), partition[4])
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(partition[8:12]))
+	assert.Equal(t, uint32(totalBlocks-1), binary.LittleEndian.Uint32(partition[12:16]))
+	assert.Equal(t, make([]byte, 3*mbrPartitionEntrySize), mbr[mbrPartitionOffset+mbrPartitionEntrySize:510])
+
+	primary := parseGPTHeader(t, image, 1)
+	backup := parseGPTHeader(t, image, totalBlocks-1)
+
+	for _, h := range []*parsedGPTHeader{primary, backup} {
+		assert.Equal(t, h.computedHeaderChecksum, h.ownChecksum)
+		assert.Equal(t, h.computedEntriesChecksum, h.entriesChecksum)
+		assert.Equal(t, uint32(gptPartitionEntries), h.entryCount)
+		assert.Equal(t, uint32(gptPartitionEntrySize), h.entrySize)
+		assert.Equal(t, uint64(34), h.firstUsable)
+		assert.Equal(t, totalBlocks-34, h.lastUsable)
+		assert.Equal(t, primary.diskGUID, h.diskGUID)
+		assert.Equal(t, primary.partitions, h.partitions)
+	}
+	assert.Equal(t, uint64(1), primary.myBlock)
+	assert.Equal(t, totalBlocks-1, primary.alternateBlock)
+	assert.Equal(t, uint64(2), primary.entriesBlock)
+	assert.Equal(t, totalBlocks-1, backup.myBlock)
+	assert.Equal(t, uint64(1), backup.alternateBlock)
+	assert.Equal(t, totalBlocks-33, backup.entriesBlock)
+
+	if !assert.Len(t, primary.partitions, 3) {
+		return
+	}
+
+	// the partitions lie within the usable blocks without overlapping each other
+	for i, p := range primary.partitions {
+		assert.LessOrEqual(t, primary.firstUsable, p.firstBlock)
+		assert.LessOrEqual(t, p.firstBlock, p.lastBlock)
+		assert.LessOrEqual(t, p.lastBlock, primary.lastUsable)
+		for _, other := range primary.partitions[i+1:] {
+			assert.True(t, p.lastBlock < other.firstBlock || other.lastBlock < p.firstBlock, "%s overlaps %s", p.name, other.name)
+		}
+	}
+
+	espPartition := primary.partitions[1]
+	assert.Equal(t, gptTypeEFISystem, espPartition.typeGUID)
+	assert.Equal(t, "EFI System Partition", espPartition.name)
+	assert.Equal(t, uint64(espEntry.LoadRBA)*blocksInSector, espPartition.firstBlock)
+	assert.Equal(t, espPartition.firstBlock+uint64(len(esp)+diskBlockSize-1)/diskBlockSize-1, espPartition.lastBlock)
+
+	// the ISO9660 data is covered up to the ESP and from there to the backup GPT
+	before, after := primary.partitions[0], primary.partitions[2]
+	for _, p := range []gptPartition{before, after} {
+		assert.Equal(t, gptTypeBasicData, p.typeGUID)
+		assert.Equal(t, "ISO9660", p.name)
+	}
+	assert.Equal(t, uint64(64), before.firstBlock)
+	assert.Equal(t, espPartition.firstBlock-1, before.lastBlock)
+	assert.Equal(t, espPartition.lastBlock+1, after.firstBlock)
+	assert.Equal(t, totalBlocks-gptBackupSectors*blocksInSector-1, after.lastBlock)
+
+	data, err := io.ReadAll(espEntry.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, esp, data)
+	assert.Equal(t, esp, image[espPartition.firstBlock*diskBlockSize:espPartition.firstBlock*diskBlockSize+uint64(len(esp))])
+}
+
+func TestWriterIsohybridWithoutBootCode(t *testing.T) {
+	w, err := NewWriter(WithIsohybrid(nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	assert.NoError(t, w.AddFile(bytes.NewReader([]byte(loremIpsum)), "readme.txt"))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "hybrid")) {
+		return
+	}
+	image := buf.Bytes()
+
+	assert.Equal(t, make([]byte, mbrPartitionOffset), image[:mbrPartitionOffset])
+	assert.Equal(t, byte(0), image[mbrPartitionOffset])
+	assert.Equal(t, byte(mbrTypeProtective), image[mbrPartitionOffset+4])
+
+	h := parseGPTHeader(t, image, 1)
+	assert.Equal(t, h.computedHeaderChecksum, h.ownChecksum)
+	if assert.Len(t, h.partitions, 1) {
+		assert.Equal(t, uint64(len(image)/diskBlockSize-gptBackupSectors*blocksInSector-1), h.partitions[0].lastBlock)
+	}
+
+	w2, err := NewWriter(WithIsohybrid(make([]byte, 440)))
+	assert.NoError(t, err)
+	defer w2.Cleanup()
+	assert.ErrorContains(t, w2.WriteTo(io.Discard, "hybrid"), "the MBR boot code has 440 bytes")
+}
+
+func TestWriterIsohybridActive(t *testing.T) {
+	_, err := NewWriter(WithIsohybridActive())
+	assert.Error(t, err)
+
+	w, err := NewWriter(WithIsohybrid(bytes.Repeat([]byte{0x90}, mbrBootCodeLength)), WithIsohybridActive())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	assert.NoError(t, w.AddFile(bytes.NewReader([]byte(loremIpsum)), "readme.txt"))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "hybrid")) {
+		return
+	}
+	assert.Equal(t, byte(mbrActive), buf.Bytes()[mbrPartitionOffset])
+	assert.Equal(t, byte(mbrTypeProtective), buf.Bytes()[mbrPartitionOffset+4])
+}
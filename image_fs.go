@@ -0,0 +1,248 @@
+package iso9660
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+var (
+	_ fs.FS         = &imageFS{}
+	_ fs.ReadDirFS  = &imageFS{}
+	_ fs.ReadFileFS = &imageFS{}
+	_ fs.StatFS     = &imageFS{}
+
+	_ fs.File        = &fsFile{}
+	_ io.ReadSeeker  = &fsFile{}
+	_ io.ReaderAt    = &fsFile{}
+	_ fs.ReadDirFile = &fsDir{}
+)
+
+// FS returns a read-only view of the first primary volume of the image,
+// which implements fs.FS, fs.ReadDirFS, fs.ReadFileFS and fs.StatFS.
+func (i *Image) FS() fs.FS {
+	return &imageFS{image: i}
+}
+
+// imageFS resolves every name anew through Image.lookup, so the Files it hands out
+// are never shared between calls and need no locking.
+type imageFS struct {
+	image *Image
+}
+
+// lookup resolves a slash-separated, fs.ValidPath-compliant name to a File like Image.Lookup.
+func (ifs *imageFS) lookup(op, name string) (*File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return ifs.image.lookup(op, name)
+}
+
+// fileInfo returns the fs.FileInfo of f as it should be seen under the given name.
+// The root directory has no name of its own, so it is reported as ".".
+func fileInfo(f *File, name string) fs.FileInfo {
+	if name == "." {
+		return &rootFileInfo{File: f}
+	}
+	return f
+}
+
+var _ fs.FileInfo = &rootFileInfo{}
+
+type rootFileInfo struct {
+	*File
+}
+
+func (rfi *rootFileInfo) Name() string {
+	return "."
+}
+
+// Open opens the named file or directory
+func (ifs *imageFS) Open(name string) (fs.File, error) {
+	f, err := ifs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ifs.openFile(f, name)
+}
+
+// openFile creates the fs.File handle of a file or directory found under the given name
+func (ifs *imageFS) openFile(f *File, name string) (fs.File, error) {
+	if f.IsDir() {
+		return &fsDir{fsys: ifs, file: f, info: fileInfo(f, name), path: name}, nil
+	}
+
+	sr, err := f.sectionReader()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &fsFile{file: f, info: fileInfo(f, name), sr: sr}, nil
+}
+
+// Stat returns the fs.FileInfo of the named file or directory
+func (ifs *imageFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := ifs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfo(f, name), nil
+}
+
+// ReadDir returns the entries of the named directory sorted by filename
+func (ifs *imageFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := ifs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ifs.readDirEntries(f, name)
+}
+
+// ReadFile returns the contents of the named file
+func (ifs *imageFS) ReadFile(name string) ([]byte, error) {
+	f, err := ifs.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrIsDirectory}
+	}
+
+	return io.ReadAll(f.Reader())
+}
+
+func (ifs *imageFS) readDirEntries(f *File, name string) ([]fs.DirEntry, error) {
+	if !f.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	children, err := f.GetChildren()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, c := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(c))
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Name() < entries[b].Name()
+	})
+
+	return entries, nil
+}
+
+// fsFile is an fs.File handle for a regular file
+type fsFile struct {
+	file   *File
+	info   fs.FileInfo
+	sr     *io.SectionReader
+	closed bool
+}
+
+func (ff *fsFile) Stat() (fs.FileInfo, error) {
+	if ff.closed {
+		return nil, &fs.PathError{Op: "stat", Path: ff.info.Name(), Err: fs.ErrClosed}
+	}
+	return ff.info, nil
+}
+
+func (ff *fsFile) Read(p []byte) (int, error) {
+	if ff.closed {
+		return 0, &fs.PathError{Op: "read", Path: ff.info.Name(), Err: fs.ErrClosed}
+	}
+	return ff.sr.Read(p)
+}
+
+func (ff *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if ff.closed {
+		return 0, &fs.PathError{Op: "read", Path: ff.info.Name(), Err: fs.ErrClosed}
+	}
+	return ff.sr.ReadAt(p, off)
+}
+
+func (ff *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if ff.closed {
+		return 0, &fs.PathError{Op: "seek", Path: ff.info.Name(), Err: fs.ErrClosed}
+	}
+	return ff.sr.Seek(offset, whence)
+}
+
+func (ff *fsFile) Close() error {
+	if ff.closed {
+		return &fs.PathError{Op: "close", Path: ff.info.Name(), Err: fs.ErrClosed}
+	}
+	ff.closed = true
+	return nil
+}
+
+// fsDir is an fs.ReadDirFile handle for a directory
+type fsDir struct {
+	fsys    *imageFS
+	file    *File
+	info    fs.FileInfo
+	path    string
+	entries []fs.DirEntry
+	offset  int
+	closed  bool
+}
+
+func (fd *fsDir) Stat() (fs.FileInfo, error) {
+	if fd.closed {
+		return nil, &fs.PathError{Op: "stat", Path: fd.path, Err: fs.ErrClosed}
+	}
+	return fd.info, nil
+}
+
+func (fd *fsDir) Read([]byte) (int, error) {
+	if fd.closed {
+		return 0, &fs.PathError{Op: "read", Path: fd.path, Err: fs.ErrClosed}
+	}
+	return 0, &fs.PathError{Op: "read", Path: fd.path, Err: ErrIsDirectory}
+}
+
+// ReadDir behaves as described in the documentation of fs.ReadDirFile
+func (fd *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if fd.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: fd.path, Err: fs.ErrClosed}
+	}
+
+	if fd.entries == nil {
+		entries, err := fd.fsys.readDirEntries(fd.file, fd.path)
+		if err != nil {
+			return nil, err
+		}
+		fd.entries = entries
+	}
+
+	remaining := fd.entries[fd.offset:]
+	if n <= 0 {
+		fd.offset = len(fd.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	fd.offset += n
+	return remaining[:n], nil
+}
+
+func (fd *fsDir) Close() error {
+	if fd.closed {
+		return &fs.PathError{Op: "close", Path: fd.path, Err: fs.ErrClosed}
+	}
+	fd.closed = true
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageFS(t *testing.T) {
+	f, err := os.Open("fixtures/test.iso")
+	assert.NoError(t, err)
+	defer f.Close() // nolint: errcheck
+
+	image, err := OpenImage(f)
+	assert.NoError(t, err)
+
+	fsys := image.FS()
+	assert.NoError(t, fstest.TestFS(fsys, "CICERO.TXT", "DIR1/LOREM_IP.TXT", "DIR2/DIR3/DATA.BIN", "DIR4/FILE1012"))
+
+	data, err := fs.ReadFile(fsys, "DIR1/LOREM_IP.TXT")
+	assert.NoError(t, err)
+	assert.Equal(t, loremIpsum, string(data))
+
+	entries, err := fs.ReadDir(fsys, "DIR2")
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "DIR3", entries[0].Name())
+		assert.True(t, entries[0].IsDir())
+		assert.Equal(t, "LARGE.TXT", entries[1].Name())
+	}
+
+	_, err = fs.Stat(fsys, "DIR1/NONEXISTENT")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	_, err = fs.Stat(fsys, "CICERO.TXT/FOO")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	_, err = fsys.Open("/DIR1")
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+}
+
+func TestImageFSFileHandle(t *testing.T) {
+	f, err := os.Open("fixtures/test_rockridge.iso")
+	assert.NoError(t, err)
+	defer f.Close() // nolint: errcheck
+
+	image, err := OpenImage(f)
+	assert.NoError(t, err)
+
+	fsys := image.FS()
+	assert.NoError(t, fstest.TestFS(fsys, "cicero.txt", "dir1/lorem_ipsum.txt", "dir2/dir3/data.bin"))
+
+	file, err := fsys.Open("dir1/lorem_ipsum.txt")
+	assert.NoError(t, err)
+
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, "lorem_ipsum.txt", info.Name())
+	assert.Equal(t, fs.FileMode(0640), info.Mode().Perm())
+
+	seeker := file.(io.ReadSeeker)
+	_, err = seeker.Seek(6, io.SeekStart)
+	assert.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(seeker, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "ipsum", string(buf))
+
+	_, err = file.(io.ReaderAt).ReadAt(buf, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, "dolor", string(buf))
+
+	assert.NoError(t, file.Close())
+	_, err = file.Read(buf)
+	assert.True(t, errors.Is(err, fs.ErrClosed))
+
+	dir, err := fsys.Open(".")
+	assert.NoError(t, err)
+	defer dir.Close() // nolint: errcheck
+
+	_, err = dir.Read(buf)
+	assert.Error(t, err)
+
+	dirEntries, err := dir.(fs.ReadDirFile).ReadDir(2)
+	assert.NoError(t, err)
+	assert.Len(t, dirEntries, 2)
+}
@@ -1,10 +1,12 @@
 package iso9660
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -12,43 +14,93 @@ import (
 type Image struct {
 	ra                io.ReaderAt
 	volumeDescriptors []volumeDescriptor
+
+	// pathTableMutex guards the path table of the primary volume and the SUSP metadata
+	// of its root directory, which are read on first use
+	pathTableMutex sync.Mutex
+	pathTableRead  bool
+	pathTable      []pathTableRecord
+	pathTableErr   error
+	rootSUSPRead   bool
+	rootSUSP       *SUSPMetadata
+	rootSUSPErr    error
+
+	caseInsensitive bool
+
+	sessionStart uint32
+	lastSession  bool
+}
+
+// ImageOption configures how an Image is read
+type ImageOption func(*Image)
+
+// WithCaseInsensitiveLookup makes Lookup, Stat and Open match names regardless of their case.
+// Exact matches are still preferred.
+func WithCaseInsensitiveLookup() ImageOption {
+	return func(i *Image) {
+		i.caseInsensitive = true
+	}
 }
 
 // OpenImage returns an Image reader reating from a given file
-func OpenImage(ra io.ReaderAt) (*Image, error) {
+func OpenImage(ra io.ReaderAt, opts ...ImageOption) (*Image, error) {
 	i := &Image{ra: ra}
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	if i.lastSession {
+		sessions, err := scanSessions(ra)
+		if err != nil {
+			return nil, err
+		}
+		i.sessionStart = sessions[len(sessions)-1].Start
+	}
 
-	if err := i.readVolumes(); err != nil {
+	vds, err := readVolumeDescriptors(ra, i.sessionStart)
+	if err != nil {
 		return nil, err
 	}
+	i.volumeDescriptors = vds
 
 	return i, nil
 }
 
-func (i *Image) readVolumes() error {
+// readVolumeDescriptors reads the volume descriptor set of the session starting at the given sector
+func readVolumeDescriptors(ra io.ReaderAt, sessionStart uint32) ([]volumeDescriptor, error) {
+	var volumeDescriptors []volumeDescriptor
 	buffer := make([]byte, sectorSize)
 	// skip the 16 sectors of system area
-	for sector := 16; ; sector++ {
-		if _, err := i.ra.ReadAt(buffer, int64(sector)*int64(sectorSize)); err != nil {
-			return err
+	for sector := int64(sessionStart) + 16; ; sector++ {
+		if _, err := ra.ReadAt(buffer, sector*int64(sectorSize)); err != nil {
+			return nil, err
+		}
+
+		// the volume recognition sequence of UDF is recorded along with the volume descriptors
+		if identifier := string(buffer[1:6]); volumeRecognitionIdentifiers[identifier] {
+			if identifier == "TEA01" && len(volumeDescriptors) == 0 {
+				// the image only holds a UDF file system
+				break
+			}
+			continue
 		}
 
 		var vd volumeDescriptor
 		if err := vd.UnmarshalBinary(buffer); err != nil {
-			return err
+			return nil, err
 		}
 
 		// NOTE: the instance of the root Directory Record that appears
 		// in the Primary Volume Descriptor cannot contain a System Use
 		// field. See the SUSP standard.
 
-		i.volumeDescriptors = append(i.volumeDescriptors, vd)
+		volumeDescriptors = append(volumeDescriptors, vd)
 		if vd.Header.Type == volumeTypeTerminator {
 			break
 		}
 	}
 
-	return nil
+	return volumeDescriptors, nil
 }
 
 // RootDir returns the File structure corresponding to the root directory
@@ -62,6 +114,18 @@ func (i *Image) RootDir() (*File, error) {
 	return nil, os.ErrNotExist
 }
 
+// JolietRootDir returns the File structure corresponding to the root directory
+// of the first Joliet Supplementary Volume. Names of the files within that tree
+// are decoded from UCS-2 and are not subject to the ISO9660 length limitations.
+func (i *Image) JolietRootDir() (*File, error) {
+	for _, vd := range i.volumeDescriptors {
+		if vd.Type() == volumeTypeSupplementary && vd.Primary.IsJoliet() {
+			return &File{de: vd.Primary.RootDirectoryEntry, ra: i.ra, children: nil, isRootDir: true, joliet: true}, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
 // RootDir returns the label of the first Primary Volume
 func (i *Image) Label() (string, error) {
 	for _, vd := range i.volumeDescriptors {
@@ -78,7 +142,15 @@ type File struct {
 	de        *DirectoryEntry
 	children  []*File
 	isRootDir bool
+	joliet    bool
 	susp      *SUSPMetadata
+
+	// extents holds the records of the following extents of a multi-extent file
+	extents []*DirectoryEntry
+
+	// lengthFromDot is set for directories found through the path table,
+	// whose extent length is only known once their "." record is read
+	lengthFromDot bool
 }
 
 var _ os.FileInfo = &File{}
@@ -98,11 +170,28 @@ func (f *File) IsDir() bool {
 	return f.de.FileFlags&dirFlagDir != 0
 }
 
-// ModTime returns the entry's recording time
+// ModTime returns the modification time recorded by Rock Ridge
+// or the entry's recording time otherwise
 func (f *File) ModTime() time.Time {
+	if f.hasRockRidge() {
+		if ts, err := f.de.SystemUseEntries.GetRockRidgeTimestamps(); err == nil && !ts.Modify.IsZero() {
+			return ts.Modify
+		}
+	}
+
 	return time.Time(f.de.RecordingDateTime)
 }
 
+// Timestamps returns all time stamps recorded for the entry by Rock Ridge.
+// It returns an error if there are none.
+func (f *File) Timestamps() (*RockRidgeTimestamps, error) {
+	if !f.hasRockRidge() {
+		return nil, fmt.Errorf("%s has no Rock Ridge time stamps", f.Name())
+	}
+
+	return f.de.SystemUseEntries.GetRockRidgeTimestamps()
+}
+
 // Mode returns file mode when available.
 // Otherwise it returns os.FileMode flag set with the os.ModeDir flag enabled in case of directories.
 func (f *File) Mode() os.FileMode {
@@ -119,6 +208,23 @@ func (f *File) Mode() os.FileMode {
 	return mode
 }
 
+// Readlink returns the target of a symbolic link, as recorded by Rock Ridge SL entries
+func (f *File) Readlink() (string, error) {
+	if !f.hasRockRidge() || f.Mode()&os.ModeSymlink == 0 {
+		return "", fmt.Errorf("%s is not a symbolic link", f.Name())
+	}
+
+	target, found, err := f.de.SystemUseEntries.GetRockRidgeSymlink()
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("%s is missing the SL entry", f.Name())
+	}
+
+	return target, nil
+}
+
 // Name returns the base name of the given entry
 func (f *File) Name() string {
 	if f.hasRockRidge() {
@@ -127,6 +233,10 @@ func (f *File) Name() string {
 		}
 	}
 
+	if f.joliet {
+		return jolietName(f.de.Identifier, f.IsDir())
+	}
+
 	if f.IsDir() {
 		return f.de.Identifier
 	}
@@ -153,13 +263,75 @@ func (f *File) Name() string {
 	return fileIdentifier
 }
 
-// Size returns the size in bytes of the extent occupied by the file or directory
+// Size returns the size in bytes of the extents occupied by the file or directory.
+// For sparse files it returns the virtual size of the file instead,
+// for compressed files the size of the uncompressed contents.
 func (f *File) Size() int64 {
-	return int64(f.de.ExtentLength)
+	if sf := f.sparse(); sf != nil {
+		return int64(sf.VirtualSize)
+	}
+	if zf := f.zisofs(); zf != nil {
+		return int64(zf.UncompressedSize)
+	}
+
+	return f.recordedSize()
+}
+
+// recordedSize returns the size in bytes of the extents occupied by the file or directory
+func (f *File) recordedSize() int64 {
+	size := int64(f.de.ExtentLength)
+	for _, de := range f.extents {
+		size += int64(de.ExtentLength)
+	}
+	return size
+}
+
+// sparse returns the SF entry of a file recorded in the Rock Ridge sparse format or nil
+func (f *File) sparse() *RockRidgeSparseEntry {
+	if !f.hasRockRidge() {
+		return nil
+	}
+
+	sf, err := f.de.SystemUseEntries.GetRockRidgeSparse()
+	if err != nil {
+		return nil
+	}
+	return sf
+}
+
+// IsSparse returns true if the file is recorded in the Rock Ridge sparse format,
+// in which case the holes of the file do not occupy any space in the image.
+func (f *File) IsSparse() bool {
+	return f.sparse() != nil
 }
 
-// Sys returns nil
+// zisofs returns the ZF entry of a file compressed in the zisofs format or nil
+func (f *File) zisofs() *RockRidgeZisofsEntry {
+	if !f.hasRockRidge() || f.IsDir() {
+		return nil
+	}
+
+	zf, err := f.de.SystemUseEntries.GetRockRidgeZisofs()
+	if err != nil {
+		return nil
+	}
+	return zf
+}
+
+// IsCompressed returns true if the file is recorded in the zisofs format,
+// in which case its contents are decompressed when read.
+func (f *File) IsCompressed() bool {
+	return f.zisofs() != nil
+}
+
+// Sys returns the *PosixAttributes recorded by Rock Ridge or nil if there are none
 func (f *File) Sys() interface{} {
+	if f.hasRockRidge() {
+		if attrs, err := f.de.SystemUseEntries.GetPosixAttributes(); err == nil {
+			return attrs
+		}
+	}
+
 	return nil
 }
 
@@ -174,12 +346,14 @@ func (f *File) GetAllChildren() ([]*File, error) {
 		return f.children, nil
 	}
 
-	baseOffset := uint32(f.de.ExtentLocation) * sectorSize
+	// directories of images with files larger than 4GB may lie beyond the range of 32-bit offsets
+	baseOffset := int64(f.de.ExtentLocation) * int64(sectorSize)
 
-	buffer := make([]byte, sectorSize)
 	for bytesProcessed := uint32(0); bytesProcessed < uint32(f.de.ExtentLength); bytesProcessed += sectorSize {
-		if _, err := f.ra.ReadAt(buffer, int64(baseOffset+bytesProcessed)); err != nil {
-			return nil, nil
+		// The decoded entries keep referencing their System Use bytes, so every sector needs its own buffer.
+		buffer := make([]byte, sectorSize)
+		if _, err := f.ra.ReadAt(buffer, baseOffset+int64(bytesProcessed)); err != nil {
+			return nil, err
 		}
 
 		for i := uint32(0); i < sectorSize; {
@@ -199,25 +373,12 @@ func (f *File) GetAllChildren() ([]*File, error) {
 
 			// Is this a root directory '.' record?
 			if f.isRootDir && newDE.Identifier == string([]byte{0}) {
-				newDE.SystemUseEntries, _ = splitSystemUseEntries(newDE.SystemUse, f.ra)
-
-				// get the SP record
-				if len(newDE.SystemUseEntries) > 0 && newDE.SystemUseEntries[0].Type() == "SP" {
-					sprecord, err := SPRecordDecode(newDE.SystemUseEntries[0])
-					if err != nil {
-						return nil, fmt.Errorf("invalid SP record: %w", err)
-					}
-
-					hasRockRidge, err := suspHasRockRidge(newDE.SystemUseEntries)
-					if err != nil {
-						return nil, fmt.Errorf("failed to check for Rock Ridge extension: %w", err)
-					}
-
-					// save SUSP offset from the SP record
-					f.susp = &SUSPMetadata{
-						Offset:       sprecord.BytesSkipped,
-						HasRockRidge: hasRockRidge,
-					}
+				susp, err := rootSUSPMetadata(newDE, f.ra)
+				if err != nil {
+					return nil, err
+				}
+				if susp != nil {
+					f.susp = susp
 				}
 			} else {
 				// are we on a volume with SUSP?
@@ -226,13 +387,31 @@ func (f *File) GetAllChildren() ([]*File, error) {
 					offsetSystemUse := newDE.SystemUse[f.susp.Offset:]
 					newDE.SystemUseEntries, _ = splitSystemUseEntries(offsetSystemUse, f.ra)
 				}
+
+				if f.lengthFromDot && newDE.Identifier == string([]byte{0}) {
+					f.de.ExtentLength = newDE.ExtentLength
+					f.lengthFromDot = false
+				}
+			}
+
+			if f.hasRockRidge() {
+				if err := f.resolveRockRidgeRelocation(newDE); err != nil {
+					return nil, err
+				}
 			}
 
 			i += entryLength
 
+			// ECMA-119 6.5.1: all records of a file but the final one carry the multi-extent flag
+			if last := len(f.children) - 1; last >= 0 && f.children[last].continuesWith(newDE) {
+				f.children[last].extents = append(f.children[last].extents, newDE)
+				continue
+			}
+
 			newFile := &File{ra: f.ra,
 				de:       newDE,
 				children: nil,
+				joliet:   f.joliet,
 				susp:     f.susp.Clone(),
 			}
 
@@ -243,6 +422,85 @@ func (f *File) GetAllChildren() ([]*File, error) {
 	return f.children, nil
 }
 
+// rootSUSPMetadata decodes the System Use entries of the "." record of the root directory
+// and returns the SUSP metadata announced by its SP record, if there is one
+func rootSUSPMetadata(de *DirectoryEntry, ra io.ReaderAt) (*SUSPMetadata, error) {
+	de.SystemUseEntries, _ = splitSystemUseEntries(de.SystemUse, ra)
+
+	// get the SP record
+	if len(de.SystemUseEntries) == 0 || de.SystemUseEntries[0].Type() != "SP" {
+		return nil, nil
+	}
+
+	sprecord, err := SPRecordDecode(de.SystemUseEntries[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SP record: %w", err)
+	}
+
+	hasRockRidge, err := suspHasRockRidge(de.SystemUseEntries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for Rock Ridge extension: %w", err)
+	}
+
+	// save SUSP offset from the SP record
+	return &SUSPMetadata{
+		Offset:       sprecord.BytesSkipped,
+		HasRockRidge: hasRockRidge,
+	}, nil
+}
+
+// continuesWith returns true if the record describes the next extent of the file
+func (f *File) continuesWith(de *DirectoryEntry) bool {
+	lastRecord := f.de
+	if len(f.extents) > 0 {
+		lastRecord = f.extents[len(f.extents)-1]
+	}
+
+	return lastRecord.FileFlags&dirFlagMultiExtent != 0 && lastRecord.Identifier == de.Identifier
+}
+
+// resolveRockRidgeRelocation replaces the contents of a DirectoryEntry with the directory
+// its CL or PL entry points to, so that deep directories relocated by Rock Ridge
+// appear in their logical place and ".." leads to their logical parent.
+func (f *File) resolveRockRidgeRelocation(de *DirectoryEntry) error {
+	location, found, err := de.SystemUseEntries.GetRockRidgeChildLink()
+	if de.Identifier == string([]byte{1}) {
+		location, found, err = de.SystemUseEntries.GetRockRidgeParentLink()
+	}
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+
+	// The "." entry of the linked directory describes the directory itself.
+	buffer := make([]byte, sectorSize)
+	if _, err := f.ra.ReadAt(buffer, int64(location)*int64(sectorSize)); err != nil {
+		return fmt.Errorf("reading relocated directory: %w", err)
+	}
+
+	var linked DirectoryEntry
+	if err := linked.UnmarshalBinary(buffer); err != nil {
+		return fmt.Errorf("reading relocated directory: %w", err)
+	}
+	if int(f.susp.Offset) <= len(linked.SystemUse) {
+		linked.SystemUseEntries, _ = splitSystemUseEntries(linked.SystemUse[f.susp.Offset:], f.ra)
+	}
+
+	// The "." entry has no name of its own, so keep the one of the placeholder.
+	for _, entry := range de.SystemUseEntries {
+		if entry.Type() == "NM" {
+			linked.SystemUseEntries = append(linked.SystemUseEntries, entry)
+		}
+	}
+	linked.Identifier = de.Identifier
+	linked.FileFlags |= dirFlagDir
+
+	*de = linked
+	return nil
+}
+
 // GetChildren returns the children entries in case of a directory
 // or an error in case of a file. It does NOT include the "." and ".." entries.
 func (f *File) GetChildren() ([]*File, error) {
@@ -257,6 +515,11 @@ func (f *File) GetChildren() ([]*File, error) {
 			continue
 		}
 
+		// directories relocated by Rock Ridge are listed in their original place instead
+		if child.hasRockRidge() && child.de.SystemUseEntries.IsRockRidgeRelocated() {
+			continue
+		}
+
 		filteredChildren = append(filteredChildren, child)
 	}
 
@@ -280,13 +543,99 @@ func (f *File) GetDotEntry() (*File, error) {
 	return nil, nil
 }
 
+// ErrIsDirectory is returned when reading the contents of a directory as if it were a regular file
+var ErrIsDirectory = errors.New("is a directory")
+
+// FileReader reads the contents of a File. Besides being an io.ReadSeeker, it implements io.ReaderAt,
+// which may be used concurrently with other calls, so the contents can be passed on to e.g.
+// zip.NewReader or another OpenImage. Multi-extent, interleaved and sparse files read as contiguous data,
+// compressed files are decompressed block by block as they are read.
+type FileReader struct {
+	sr *io.SectionReader
+}
+
+var (
+	_ io.ReadSeeker = &FileReader{}
+	_ io.ReaderAt   = &FileReader{}
+)
+
+// Read implements io.Reader
+func (fr *FileReader) Read(p []byte) (int, error) {
+	return fr.sr.Read(p)
+}
+
+// ReadAt implements io.ReaderAt
+func (fr *FileReader) ReadAt(p []byte, off int64) (int, error) {
+	return fr.sr.ReadAt(p, off)
+}
+
+// Seek implements io.Seeker
+func (fr *FileReader) Seek(offset int64, whence int) (int64, error) {
+	return fr.sr.Seek(offset, whence)
+}
+
+// Size returns the size of the file in bytes
+func (fr *FileReader) Size() int64 {
+	return fr.sr.Size()
+}
+
+// Open returns a FileReader of the file's contents.
+// If File is a directory, it returns an error wrapping ErrIsDirectory.
+func (f *File) Open() (*FileReader, error) {
+	if f.IsDir() {
+		return nil, fmt.Errorf("%s: %w", f.Name(), ErrIsDirectory)
+	}
+
+	sr, err := f.sectionReader()
+	if err != nil {
+		return nil, err
+	}
+	return &FileReader{sr: sr}, nil
+}
+
 // Reader returns a reader that allows to read the file's data.
-// If File is a directory, it returns nil.
+// If File is a directory, reading from it fails with an error wrapping ErrIsDirectory.
 func (f *File) Reader() io.Reader {
-	if f.IsDir() {
-		return nil
+	fr, err := f.Open()
+	if err != nil {
+		return &errorReader{err: err}
 	}
+	return fr
+}
 
-	baseOffset := int64(f.de.ExtentLocation) * int64(sectorSize)
-	return io.NewSectionReader(f.ra, baseOffset, int64(f.de.ExtentLength))
+// sectionReader returns a reader of the file's logical contents
+func (f *File) sectionReader() (*io.SectionReader, error) {
+	if sf := f.sparse(); sf != nil {
+		sparseReader, err := newSparseReaderAt(f.ra, uint32(f.de.ExtentLocation), sf)
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(sparseReader, 0, int64(sf.VirtualSize)), nil
+	}
+
+	var recorded *io.SectionReader
+	if len(f.extents) > 0 {
+		recorded = io.NewSectionReader(newMultiExtentReaderAt(f.ra, append([]*DirectoryEntry{f.de}, f.extents...)), 0, f.recordedSize())
+	} else {
+		recorded = io.NewSectionReader(extentReaderAt(f.ra, f.de), 0, int64(f.de.ExtentLength))
+	}
+
+	if zf := f.zisofs(); zf != nil {
+		zisofsReader, err := newZisofsReaderAt(recorded, recorded.Size(), zf)
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(zisofsReader, 0, int64(zf.UncompressedSize)), nil
+	}
+
+	return recorded, nil
+}
+
+// errorReader fails every read with the same error
+type errorReader struct {
+	err error
+}
+
+func (er *errorReader) Read([]byte) (int, error) {
+	return 0, er.err
 }
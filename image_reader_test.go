@@ -4,6 +4,8 @@
 package iso9660
 
 import (
+	"archive/zip"
+	"bytes"
 	"io"
 	"io/fs"
 	"os"
@@ -16,6 +18,46 @@ import (
 const loremIpsum = `Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum.
 `
 
+// marshalDirectory encodes the given directory records into a single sector
+func marshalDirectory(t *testing.T, entries ...*DirectoryEntry) []byte {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		data, err := e.MarshalBinary()
+		assert.NoError(t, err)
+		buf.Write(data)
+	}
+	sector := make([]byte, sectorSize)
+	copy(sector, buf.Bytes())
+	return sector
+}
+
+func marshalVolumeDescriptor(t *testing.T, vd volumeDescriptor) []byte {
+	data, err := vd.MarshalBinary()
+	assert.NoError(t, err)
+	return data
+}
+
+// suEntry encodes a System Use entry with the given type and payload
+func suEntry(entryType string, payload ...byte) []byte {
+	return append([]byte{entryType[0], entryType[1], byte(4 + len(payload)), 1}, payload...)
+}
+
+func suLocation(entryType string, location uint32) []byte {
+	payload := make([]byte, 8)
+	WriteInt32LSBMSB(payload, int32(location))
+	return suEntry(entryType, payload...)
+}
+
+// rockRidgeRootSU is the System Use area of the root "." entry of a Rock Ridge volume
+func rockRidgeRootSU() []byte {
+	su := suEntry("SP", 0xBE, 0xEF, 0)
+	return append(su, suEntry("ER", append([]byte{10, 0, 0, 1}, RockRidgeIdentifier...)...)...)
+}
+
+func rockRidgeName(name string) []byte {
+	return suEntry("NM", append([]byte{0}, name...)...)
+}
+
 func TestImageReader(t *testing.T) {
 	tz := time.FixedZone("", 3600*2)
 	recordTime := time.Date(2018, 07, 25, 22, 01, 02, 0, tz)
@@ -106,7 +148,11 @@ func TestFile(t *testing.T) {
 		children: []*File{},
 	}
 
-	assert.Nil(t, f.Reader())
+	_, err := io.ReadAll(f.Reader())
+	assert.ErrorIs(t, err, ErrIsDirectory)
+	fr, err := f.Open()
+	assert.ErrorIs(t, err, ErrIsDirectory)
+	assert.Nil(t, fr)
 	assert.Equal(t, os.ModeDir, f.Mode())
 }
 
@@ -152,6 +198,9 @@ func TestImageReaderSUSP(t *testing.T) {
 	symlink := children[4]
 	assert.Equal(t, "this-is-a-symlink", symlink.Name())
 	assert.Equal(t, os.ModeSymlink, symlink.Mode()&os.ModeSymlink)
+	target, err := symlink.Readlink()
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/share/some-random-directory/even-deeper-path/symlink-target", target)
 
 	dir1 := children[1]
 	assert.Equal(t, "dir1", dir1.Name())
@@ -167,14 +216,393 @@ func TestImageReaderSUSP(t *testing.T) {
 	assert.Equal(t, fs.FileMode(0640), loremFile.Mode().Perm(), "expected mode %o, got %o", 0640, loremFile.Mode().Perm())
 	assert.NotNil(t, loremFile.susp)
 	assert.True(t, loremFile.susp.HasRockRidge)
+	if attrs, ok := loremFile.Sys().(*PosixAttributes); assert.True(t, ok) {
+		assert.Equal(t, uint32(1000), attrs.UID)
+		assert.Equal(t, uint32(1), attrs.Links)
+	}
 
 	data, err := io.ReadAll(loremFile.Reader())
 	assert.NoError(t, err)
 
 	assert.Equal(t, loremIpsum, string(data))
 
+	_, err = loremFile.Readlink()
+	assert.Error(t, err)
+
+	// Rock Ridge TF records the modify, access and attribute change times
+	mtime := time.Date(2023, 8, 20, 12, 58, 31, 0, time.FixedZone("", 3600*2))
+	assert.True(t, mtime.Equal(loremFile.ModTime()), "expected %s, got %s", mtime, loremFile.ModTime())
+	timestamps, err := loremFile.Timestamps()
+	assert.NoError(t, err)
+	assert.True(t, timestamps.Creation.IsZero())
+	assert.True(t, mtime.Equal(timestamps.Access))
+	ctime := time.Date(2023, 8, 20, 13, 37, 54, 0, time.FixedZone("", 3600*2))
+	assert.True(t, ctime.Equal(timestamps.AttributeChange))
+
 	assert.Len(t, loremFile.de.SystemUseEntries, 4)
 	assert.Equal(t, "RR", loremFile.de.SystemUseEntries[0].Type())
 	assert.Equal(t, "PX", loremFile.de.SystemUseEntries[2].Type())
 	assert.Equal(t, "TF", loremFile.de.SystemUseEntries[3].Type())
 }
+
+func TestImageReaderRockRidgeRelocation(t *testing.T) {
+	dirMode := pxEntry(0040755, 2, 0, 0)
+
+	rootDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00", SystemUse: rockRidgeRootSU()}
+	rootDotDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+	placeholder := &DirectoryEntry{Identifier: "DEEP;1", SystemUse: append(rockRidgeName("deep"), suLocation("CL", 20)...)}
+	rrMoved := &DirectoryEntry{ExtentLocation: 19, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "RR_MOVED", SystemUse: append(rockRidgeName("rr_moved"), dirMode...)}
+
+	rrMovedDot := rrMoved.Clone()
+	rrMovedDot.Identifier = "\x00"
+	relocated := &DirectoryEntry{ExtentLocation: 20, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "DEEP", SystemUse: append(append(rockRidgeName("deep"), dirMode...), suEntry("RE")...)}
+
+	relocatedDot := &DirectoryEntry{ExtentLocation: 20, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00", SystemUse: pxEntry(0040700, 2, 0, 0)}
+	relocatedDotDot := &DirectoryEntry{ExtentLocation: 19, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01", SystemUse: suLocation("PL", 18)}
+	file := &DirectoryEntry{ExtentLocation: 21, ExtentLength: uint32(len(loremIpsum)), Identifier: "LOREM.TXT;1", SystemUse: rockRidgeName("lorem.txt")}
+
+	var image bytes.Buffer
+	image.Write(make([]byte, systemAreaSize))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: 22, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: rootDotDot},
+	}))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	image.Write(marshalDirectory(t, rootDot, rootDotDot, placeholder, rrMoved))
+	image.Write(marshalDirectory(t, &rrMovedDot, rootDotDot, relocated))
+	image.Write(marshalDirectory(t, relocatedDot, relocatedDotDot, file))
+	data := make([]byte, sectorSize)
+	copy(data, loremIpsum)
+	image.Write(data)
+
+	img, err := OpenImage(bytes.NewReader(image.Bytes()))
+	assert.NoError(t, err)
+
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	children, err := root.GetChildren()
+	assert.NoError(t, err)
+	if !assert.Len(t, children, 2) {
+		return
+	}
+
+	deep := children[0]
+	assert.Equal(t, "deep", deep.Name())
+	assert.True(t, deep.IsDir())
+	assert.Equal(t, fs.ModeDir|0700, deep.Mode())
+
+	deepChildren, err := deep.GetAllChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, deepChildren, 3) {
+		// ".." leads back to the logical parent, not to rr_moved
+		assert.Equal(t, int32(18), deepChildren[1].de.ExtentLocation)
+
+		assert.Equal(t, "lorem.txt", deepChildren[2].Name())
+		content, err := io.ReadAll(deepChildren[2].Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, loremIpsum, string(content))
+	}
+
+	assert.Equal(t, "rr_moved", children[1].Name())
+	movedChildren, err := children[1].GetChildren()
+	assert.NoError(t, err)
+	assert.Len(t, movedChildren, 0)
+}
+
+func TestImageReaderRockRidgeSparse(t *testing.T) {
+	virtualSize := uint64(2*sectorSize) + uint64(len(loremIpsum))
+	sf := make([]byte, 17)
+	WriteInt32LSBMSB(sf[0:8], int32(virtualSize>>32))
+	WriteInt32LSBMSB(sf[8:16], int32(virtualSize))
+	sf[16] = 1
+
+	rootDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00", SystemUse: rockRidgeRootSU()}
+	rootDotDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+	file := &DirectoryEntry{ExtentLocation: 19, ExtentLength: 2 * sectorSize, Identifier: "SPARSE;1", SystemUse: append(rockRidgeName("sparse"), suEntry("SF", sf...)...)}
+
+	// the first and the last block share the same data, the one in between is a hole
+	table := make([]byte, sectorSize)
+	WriteInt32LSBMSB(table[0:8], 20)
+	WriteInt32LSBMSB(table[16:24], 20)
+
+	var image bytes.Buffer
+	image.Write(make([]byte, systemAreaSize))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: 21, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: rootDotDot},
+	}))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	image.Write(marshalDirectory(t, rootDot, rootDotDot, file))
+	image.Write(table)
+	data := make([]byte, sectorSize)
+	copy(data, loremIpsum)
+	image.Write(data)
+
+	img, err := OpenImage(bytes.NewReader(image.Bytes()))
+	assert.NoError(t, err)
+
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	children, err := root.GetChildren()
+	assert.NoError(t, err)
+	if !assert.Len(t, children, 1) {
+		return
+	}
+
+	sparse := children[0]
+	assert.True(t, sparse.IsSparse())
+	assert.Equal(t, int64(virtualSize), sparse.Size())
+
+	content, err := io.ReadAll(sparse.Reader())
+	assert.NoError(t, err)
+	expected := make([]byte, virtualSize)
+	copy(expected, loremIpsum)
+	copy(expected[2*sectorSize:], loremIpsum)
+	assert.Equal(t, expected, content)
+
+	// reads crossing a hole
+	sr, err := sparse.sectionReader()
+	assert.NoError(t, err)
+	buf := make([]byte, sectorSize)
+	n, err := sr.ReadAt(buf, int64(sectorSize/2))
+	assert.NoError(t, err)
+	assert.Equal(t, int(sectorSize), n)
+	assert.Equal(t, expected[sectorSize/2:sectorSize+sectorSize/2], buf)
+}
+
+func TestSparseReaderAtDepth(t *testing.T) {
+	ra := bytes.NewReader(make([]byte, 4*sectorSize))
+
+	_, err := newSparseReaderAt(ra, 1, &RockRidgeSparseEntry{VirtualSize: 4096, TableDepth: 0})
+	assert.Error(t, err)
+
+	// 256^8 overflows the blocks spanned by an entry of the top level table
+	_, err = newSparseReaderAt(ra, 1, &RockRidgeSparseEntry{VirtualSize: 4096, TableDepth: 9})
+	assert.Error(t, err)
+	_, err = newSparseReaderAt(ra, 1, &RockRidgeSparseEntry{VirtualSize: 4096, TableDepth: 2})
+	assert.Error(t, err)
+
+	_, err = newSparseReaderAt(ra, 1, &RockRidgeSparseEntry{VirtualSize: 256 * uint64(sectorSize), TableDepth: 1})
+	assert.NoError(t, err)
+	_, err = newSparseReaderAt(ra, 1, &RockRidgeSparseEntry{VirtualSize: 256*uint64(sectorSize) + 1, TableDepth: 2})
+	assert.NoError(t, err)
+	_, err = newSparseReaderAt(ra, 1, &RockRidgeSparseEntry{VirtualSize: 1 << 63, TableDepth: 7})
+	assert.NoError(t, err)
+	_, err = newSparseReaderAt(ra, 1, &RockRidgeSparseEntry{VirtualSize: 1 << 63, TableDepth: 8})
+	assert.Error(t, err)
+}
+
+func TestImageReaderMultiExtent(t *testing.T) {
+	rootDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00"}
+	rootDotDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+	// the extents of a file do not need to be adjacent or in order
+	first := &DirectoryEntry{ExtentLocation: 21, ExtentLength: 2 * sectorSize, FileFlags: dirFlagMultiExtent, Identifier: "BIG.IMG;1"}
+	second := &DirectoryEntry{ExtentLocation: 19, ExtentLength: sectorSize, FileFlags: dirFlagMultiExtent, Identifier: "BIG.IMG;1"}
+	third := &DirectoryEntry{ExtentLocation: 20, ExtentLength: 100, Identifier: "BIG.IMG;1"}
+	other := &DirectoryEntry{ExtentLocation: 20, ExtentLength: 100, Identifier: "OTHER.IMG;1"}
+
+	sector := func(b byte) []byte { return bytes.Repeat([]byte{b}, int(sectorSize)) }
+
+	var image bytes.Buffer
+	image.Write(make([]byte, systemAreaSize))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: 23, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: rootDotDot},
+	}))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	image.Write(marshalDirectory(t, rootDot, rootDotDot, first, second, third, other))
+	image.Write(sector('b'))
+	image.Write(sector('c'))
+	image.Write(sector('a'))
+	image.Write(sector('A'))
+
+	img, err := OpenImage(bytes.NewReader(image.Bytes()))
+	assert.NoError(t, err)
+
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	children, err := root.GetChildren()
+	assert.NoError(t, err)
+	if !assert.Len(t, children, 2) {
+		return
+	}
+
+	big := children[0]
+	assert.Equal(t, "BIG.IMG", big.Name())
+	assert.Equal(t, int64(3*sectorSize+100), big.Size())
+	assert.Equal(t, int64(100), children[1].Size())
+
+	expected := append(sector('a'), sector('A')...)
+	expected = append(expected, sector('b')...)
+	expected = append(expected, bytes.Repeat([]byte{'c'}, 100)...)
+
+	content, err := io.ReadAll(big.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, content)
+
+	// reads crossing the boundaries of extents
+	sr, err := big.sectionReader()
+	assert.NoError(t, err)
+	buf := make([]byte, sectorSize+10)
+	n, err := sr.ReadAt(buf, int64(2*sectorSize-5))
+	assert.Equal(t, len(buf), n)
+	assert.NoError(t, err)
+	assert.Equal(t, expected[2*sectorSize-5:3*sectorSize+5], buf)
+
+	n, err = sr.ReadAt(buf, int64(3*sectorSize))
+	assert.Equal(t, 100, n)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestImageReaderInterleaved(t *testing.T) {
+	rootDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00"}
+	rootDotDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+	// two files interleaved in units of two sectors, the second one spread over two extents
+	first := &DirectoryEntry{ExtentLocation: 19, ExtentLength: 3*sectorSize + 10, FileUnitSize: 2, InterleaveGap: 2, Identifier: "FIRST.BIN;1"}
+	second := &DirectoryEntry{ExtentLocation: 21, ExtentLength: 2 * sectorSize, FileUnitSize: 2, InterleaveGap: 2, FileFlags: dirFlagMultiExtent, Identifier: "SECOND.BIN;1"}
+	secondTail := &DirectoryEntry{ExtentLocation: 25, ExtentLength: 5, Identifier: "SECOND.BIN;1"}
+
+	sector := func(b byte) []byte { return bytes.Repeat([]byte{b}, int(sectorSize)) }
+
+	var image bytes.Buffer
+	image.Write(make([]byte, systemAreaSize))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: 26, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: rootDotDot},
+	}))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	image.Write(marshalDirectory(t, rootDot, rootDotDot, first, second, secondTail))
+	for _, b := range []byte("abABcdx") {
+		image.Write(sector(b))
+	}
+
+	img, err := OpenImage(bytes.NewReader(image.Bytes()))
+	assert.NoError(t, err)
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	children, err := root.GetChildren()
+	if !assert.NoError(t, err) || !assert.Len(t, children, 2) {
+		return
+	}
+
+	expectedFirst := append(sector('a'), sector('b')...)
+	expectedFirst = append(expectedFirst, sector('c')...)
+	expectedFirst = append(expectedFirst, bytes.Repeat([]byte{'d'}, 10)...)
+	expectedSecond := append(sector('A'), sector('B')...)
+	expectedSecond = append(expectedSecond, bytes.Repeat([]byte{'x'}, 5)...)
+
+	for i, expected := range [][]byte{expectedFirst, expectedSecond} {
+		fr, err := children[i].Open()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(len(expected)), fr.Size())
+
+		content, err := io.ReadAll(fr)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, content)
+
+		// reads crossing the gaps
+		buf := make([]byte, 2*sectorSize)
+		n, err := fr.ReadAt(buf, int64(2*sectorSize-3))
+		assert.Equal(t, len(expected)-int(2*sectorSize-3), n)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, expected[2*sectorSize-3:], buf[:n])
+
+		n, err = fr.ReadAt(buf[:6], int64(sectorSize-3))
+		assert.Equal(t, 6, n)
+		assert.NoError(t, err)
+		assert.Equal(t, expected[sectorSize-3:sectorSize+3], buf[:6])
+	}
+}
+
+func TestFileOpen(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	zf, err := zw.Create("lorem.txt")
+	assert.NoError(t, err)
+	_, err = zf.Write([]byte(loremIpsum))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	inner, err := NewWriter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := inner.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	assert.NoError(t, inner.AddFile(bytes.NewReader(archive.Bytes()), "archive.zip"))
+	var innerImage bytes.Buffer
+	if !assert.NoError(t, inner.WriteTo(&innerImage, "inner")) {
+		return
+	}
+
+	outer, err := NewWriter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := outer.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	assert.NoError(t, outer.AddFile(bytes.NewReader(innerImage.Bytes()), "images/inner.iso"))
+	var outerImage bytes.Buffer
+	if !assert.NoError(t, outer.WriteTo(&outerImage, "outer")) {
+		return
+	}
+
+	img, err := OpenImage(bytes.NewReader(outerImage.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := img.Lookup("images/inner.iso")
+	if !assert.NoError(t, err) {
+		return
+	}
+	fr, err := f.Open()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the image within the image is opened through the ReaderAt of the file
+	nested, err := OpenImage(fr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	label, err := nested.Label()
+	assert.NoError(t, err)
+	assert.Equal(t, "inner", label)
+
+	f, err = nested.Lookup("archive.zip")
+	if !assert.NoError(t, err) {
+		return
+	}
+	fr, err = f.Open()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	zr, err := zip.NewReader(fr, fr.Size())
+	if !assert.NoError(t, err) || !assert.Len(t, zr.File, 1) {
+		return
+	}
+	rc, err := zr.File[0].Open()
+	assert.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, loremIpsum, string(content))
+
+	// seeking back to the start
+	_, err = io.ReadAll(fr)
+	assert.NoError(t, err)
+	offset, err := fr.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Zero(t, offset)
+	content, err = io.ReadAll(fr)
+	assert.NoError(t, err)
+	assert.Equal(t, archive.Bytes(), content)
+}
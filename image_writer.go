@@ -3,6 +3,7 @@ package iso9660
 import (
 	"bytes"
 	"container/list"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -19,12 +21,23 @@ import (
 const (
 	primaryVolumeDirectoryIdentifierMaxLength = 31 // ECMA-119 7.6.3
 	primaryVolumeFileIdentifierMaxLength      = 30 // ECMA-119 7.5
+	jolietIdentifierMaxLength                 = 64 // in characters, not counting the version suffix
+
+	// the system area spans the first 16 sectors of the image, see ECMA-119 6.2.1
+	systemAreaSectors = 16
+
+	// maxExtentLength is the length of all but the last extent of multi-extent files,
+	// the largest multiple of the sector size that can be recorded in a directory record
+	maxExtentLength = math.MaxUint32 &^ (sectorSize - 1)
+
+	// defaultInterchangeLevel allows for file identifiers of up to 30 characters, see ECMA-119 10.2
+	defaultInterchangeLevel = 2
 )
 
 var (
 	// ErrFileTooLarge is returned when trying to process a file of size greater
 	// than 4GB, which due to the 32-bit address limitation is not possible
-	// except with ISO 9660-Level 3
+	// except with ISO 9660-Level 3, see WithInterchangeLevel
 	ErrFileTooLarge = errors.New("file is exceeding the maximum file size of 4GB")
 )
 
@@ -32,17 +45,128 @@ var (
 // and writing them to an image.
 type ImageWriter struct {
 	stagingDir string
+
+	// originalNames maps paths within the staging dir to the names
+	// of the path's last component before they were mangled
+	originalNames map[string]string
+
+	// localFileInfos maps paths within the staging dir to the attributes
+	// of the local files and directories they were added from
+	localFileInfos map[string]os.FileInfo
+
+	joliet    bool
+	rockRidge bool
+
+	bootImages      []bootImage
+	bootCatalogPath string
+
+	isohybrid bool
+	mbrCode   []byte
+	mbrActive bool
+
+	interchangeLevel int
+	pathTableCopies  bool
+
+	// zisofsBlockSizeLog2 enables zisofs compression with the given block size
+	zisofsBlockSizeLog2 int
+
+	// udfRevision enables recording a UDF file system of the given revision
+	udfRevision int
+
+	// previousSession is the image a new session is appended to, which starts at sessionStart.
+	// previousFiles holds the records of the files carried over from it by their staged paths.
+	previousSession    *Image
+	sessionStart       uint32
+	previousFiles      map[string][]*DirectoryEntry
+	previousBootRecord *BootVolumeDescriptorBody
+}
+
+// WriterOption configures optional features of an ImageWriter
+type WriterOption func(*ImageWriter)
+
+// WithJoliet makes the ImageWriter record an additional Joliet directory tree,
+// which preserves the original file names of up to 64 Unicode characters.
+// Both directory trees refer to the same file data.
+func WithJoliet() WriterOption {
+	return func(iw *ImageWriter) {
+		iw.joliet = true
+	}
+}
+
+// WithRockRidge makes the ImageWriter record Rock Ridge extensions in the primary directory tree,
+// which preserve the original file names, POSIX attributes, modification times and symbolic links.
+// Attributes are taken from local files added with AddLocalFile or AddLocalDirectory.
+// Files added with AddFile are recorded with the mode 0644 and owned by root.
+func WithRockRidge() WriterOption {
+	return func(iw *ImageWriter) {
+		iw.rockRidge = true
+	}
+}
+
+// WithInterchangeLevel sets the interchange level of the image, see ECMA-119 10.
+// At level 3 files larger than 4GB are recorded in several extents, while at the default level 2
+// adding them makes WriteTo fail with ErrFileTooLarge. The file name restrictions of level 1 are not supported.
+func WithInterchangeLevel(level int) WriterOption {
+	return func(iw *ImageWriter) {
+		iw.interchangeLevel = level
+	}
 }
 
 // NewWriter creates a new ImageWrite and initializes its temporary staging dir.
 // Cleanup should be called after the ImageWriter is no longer needed.
-func NewWriter() (*ImageWriter, error) {
+func NewWriter(opts ...WriterOption) (*ImageWriter, error) {
+	iw := &ImageWriter{interchangeLevel: defaultInterchangeLevel}
+	for _, opt := range opts {
+		opt(iw)
+	}
+
+	if iw.interchangeLevel != 2 && iw.interchangeLevel != 3 {
+		return nil, fmt.Errorf("interchange level %d is not supported", iw.interchangeLevel)
+	}
+
+	if iw.previousSession != nil && iw.isohybrid {
+		return nil, fmt.Errorf("a session cannot be appended to a hybrid image")
+	}
+
+	if iw.mbrActive && !iw.isohybrid {
+		return nil, fmt.Errorf("the protective MBR can only be marked active in isohybrid images")
+	}
+
+	if iw.zisofsBlockSizeLog2 != 0 {
+		if iw.zisofsBlockSizeLog2 < zisofsMinBlockSizeLog2 || iw.zisofsBlockSizeLog2 > zisofsMaxBlockSizeLog2 {
+			return nil, fmt.Errorf("zisofs block size 2^%d is not supported", iw.zisofsBlockSizeLog2)
+		}
+		if !iw.rockRidge {
+			return nil, fmt.Errorf("zisofs compression requires Rock Ridge")
+		}
+	}
+
+	if iw.udfRevision != 0 {
+		if iw.udfRevision != UDFRevision102 && iw.udfRevision != UDFRevision201 {
+			return nil, fmt.Errorf("UDF revision %X is not supported", iw.udfRevision)
+		}
+		if iw.zisofsBlockSizeLog2 != 0 {
+			return nil, fmt.Errorf("UDF cannot refer to files compressed with zisofs")
+		}
+		if iw.previousSession != nil {
+			return nil, fmt.Errorf("UDF cannot be recorded when appending a session")
+		}
+	}
+
 	tmp, err := os.MkdirTemp("", "")
 	if err != nil {
 		return nil, err
 	}
+	iw.stagingDir = tmp
 
-	return &ImageWriter{stagingDir: tmp}, nil
+	if iw.previousSession != nil {
+		if err := iw.stagePreviousSession(); err != nil {
+			_ = iw.Cleanup()
+			return nil, fmt.Errorf("staging the previous session: %w", err)
+		}
+	}
+
+	return iw, nil
 }
 
 // Cleanup deletes the underlying temporary staging directory of an ImageWriter.
@@ -64,12 +188,21 @@ func (iw *ImageWriter) Cleanup() error {
 // All path components are mangled to match basic ISO9660 filename requirements.
 func (iw *ImageWriter) AddFile(data io.Reader, filePath string) error {
 	directoryPath, fileName := manglePath(filePath)
+	iw.recordOriginalNames(filePath)
+	delete(iw.localFileInfos, path.Join(directoryPath, fileName))
+	delete(iw.previousFiles, path.Join(directoryPath, fileName))
+
+	if err := iw.mkdirStaged(directoryPath); err != nil {
+		return err
+	}
 
-	if err := os.MkdirAll(path.Join(iw.stagingDir, directoryPath), 0755); err != nil {
+	// a symlink staged under the same path is replaced instead of written through
+	stagedFile := path.Join(iw.stagingDir, directoryPath, fileName)
+	if err := os.Remove(stagedFile); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	f, err := os.OpenFile(path.Join(iw.stagingDir, directoryPath, fileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	f, err := os.OpenFile(stagedFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		return err
 	}
@@ -79,6 +212,31 @@ func (iw *ImageWriter) AddFile(data io.Reader, filePath string) error {
 	return err
 }
 
+// mkdirStaged creates a directory of the staging area along with its parents. Unlike os.MkdirAll,
+// it refuses to descend into staged symlinks, whose targets may lie anywhere on the host.
+func (iw *ImageWriter) mkdirStaged(directoryPath string) error {
+	current := iw.stagingDir
+	for _, segment := range splitPath(directoryPath) {
+		current = path.Join(current, segment)
+
+		info, err := os.Lstat(current)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(current, 0755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("%q is a symlink, which cannot contain files", strings.TrimPrefix(current, iw.stagingDir+"/"))
+		case !info.IsDir():
+			return fmt.Errorf("%q is not a directory", strings.TrimPrefix(current, iw.stagingDir+"/"))
+		}
+	}
+
+	return nil
+}
+
 func failIfSymlink(path string) error {
 	info, err := os.Lstat(path)
 	if err != nil {
@@ -86,21 +244,30 @@ func failIfSymlink(path string) error {
 	}
 
 	if info.Mode()&os.ModeSymlink != 0 {
-		return fmt.Errorf("%q is a symlink - these are not yet supported", path)
+		return fmt.Errorf("%q is a symlink - these are only supported with Rock Ridge", path)
 	}
 
 	return nil
 }
 
 // AddLocalFile adds a file identified by its path to the ImageWriter's staging area.
+// Symbolic links are only supported with Rock Ridge and are recorded as such, without being followed.
 func (iw *ImageWriter) AddLocalFile(origin, target string) error {
-	if err := failIfSymlink(origin); err != nil {
+	if !iw.rockRidge {
+		if err := failIfSymlink(origin); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Lstat(origin)
+	if err != nil {
 		return err
 	}
 
 	directoryPath, fileName := manglePath(target)
+	iw.recordOriginalNames(target)
 
-	if err := os.MkdirAll(path.Join(iw.stagingDir, directoryPath), 0755); err != nil {
+	if err := iw.mkdirStaged(directoryPath); err != nil {
 		return err
 	}
 
@@ -109,8 +276,23 @@ func (iw *ImageWriter) AddLocalFile(origin, target string) error {
 	if err := os.Remove(stagedFile); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	delete(iw.previousFiles, path.Join(directoryPath, fileName))
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		linkTarget, err := os.Readlink(origin)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(linkTarget, stagedFile); err != nil {
+			return err
+		}
+
+		iw.recordLocalFileInfo(path.Join(directoryPath, fileName), info)
+		return nil
+	}
 
 	if err := os.Link(origin, stagedFile); err == nil {
+		iw.recordLocalFileInfo(path.Join(directoryPath, fileName), info)
 		return nil
 	}
 
@@ -121,7 +303,12 @@ func (iw *ImageWriter) AddLocalFile(origin, target string) error {
 
 	defer f.Close()
 
-	return iw.AddFile(f, target)
+	if err := iw.AddFile(f, target); err != nil {
+		return err
+	}
+
+	iw.recordLocalFileInfo(path.Join(directoryPath, fileName), info)
+	return nil
 }
 
 func ensureIsDirectory(path string) error {
@@ -150,10 +337,14 @@ func (iw *ImageWriter) AddLocalDirectory(origin, target string) error {
 	}
 
 	walkfn := func(path string, info os.FileInfo, err error) error {
+		relPath := path[len(origin):] // We need the path to be relative to the origin.
 		if info.IsDir() {
+			// the directory only gets staged along with its contents, but its attributes are kept anyway
+			if dirPath := mangleDirectoryPath(filepath.Join(target, relPath)); dirPath != "" {
+				iw.recordLocalFileInfo(dirPath, info)
+			}
 			return nil
 		}
-		relPath := path[len(origin):] // We need the path to be relative to the origin.
 		return iw.AddLocalFile(path, filepath.Join(target, relPath))
 	}
 
@@ -176,6 +367,44 @@ func manglePath(input string) (string, string) {
 	return path.Join(dirSegments...), name
 }
 
+// mangleDirectoryPath mangles all components of a directory's path
+func mangleDirectoryPath(input string) string {
+	segments := splitPath(posixifyPath(input))
+	for i := range segments {
+		segments[i] = mangleDirectoryName(segments[i])
+	}
+
+	return path.Join(segments...)
+}
+
+// recordOriginalNames remembers the unmangled names of all components of the given path,
+// so that they can be recorded in extensions which are not subject to the ISO9660 naming rules.
+func (iw *ImageWriter) recordOriginalNames(input string) {
+	if iw.originalNames == nil {
+		iw.originalNames = make(map[string]string)
+	}
+
+	segments := splitPath(posixifyPath(input))
+	var mangledPath string
+	for i, segment := range segments {
+		if i == len(segments)-1 {
+			mangledPath = path.Join(mangledPath, mangleFileName(segment))
+		} else {
+			mangledPath = path.Join(mangledPath, mangleDirectoryName(segment))
+		}
+		iw.originalNames[mangledPath] = segment
+	}
+}
+
+// recordLocalFileInfo remembers the attributes of the local file staged under the given path
+func (iw *ImageWriter) recordLocalFileInfo(stagedPath string, info os.FileInfo) {
+	if iw.localFileInfos == nil {
+		iw.localFileInfos = make(map[string]os.FileInfo)
+	}
+
+	iw.localFileInfos[stagedPath] = info
+}
+
 // Converts given path to Posix (replacing \ with /)
 //
 // @param {string} givenPath Path to convert
@@ -253,35 +482,326 @@ func mangleD1String(input string, maxCharacters int) string {
 	return mangledString
 }
 
+// stagedEntry is a file or directory within the staging directory
+// along with the identifier it is recorded under in a directory tree
+type stagedEntry struct {
+	os.DirEntry
+	identifier string
+	systemUse  []byte
+
+	// extentLengths holds the lengths of the extents of a regular file,
+	// each of which is described by a record of its own
+	extentLengths []uint32
+}
+
+// readStagedDir lists the contents of a staged directory in the order in which their
+// DirectoryEntries have to be recorded in the primary or the Joliet directory tree.
+func (wc *writeContext) readStagedDir(dirPath string, joliet bool) ([]stagedEntry, error) {
+	contents, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]stagedEntry, 0, len(contents))
+	for _, c := range contents {
+		identifier := c.Name()
+		if joliet {
+			identifier = string(encodeUCS2(jolietIdentifier(wc.originalName(path.Join(dirPath, c.Name())), c.IsDir())))
+		}
+		entry := stagedEntry{DirEntry: c, identifier: identifier}
+		if records, ok := wc.previousFiles[strings.TrimPrefix(path.Join(dirPath, c.Name()), wc.stagingDir+"/")]; ok {
+			// the file is carried over from the previous session along with its extents
+			for _, de := range records {
+				entry.extentLengths = append(entry.extentLengths, de.ExtentLength)
+			}
+		} else if c.Type().IsRegular() {
+			info, err := c.Info()
+			if err != nil {
+				return nil, err
+			}
+			size := info.Size()
+			if cf, ok := wc.compressedFiles[path.Join(dirPath, c.Name())]; ok {
+				size = cf.size
+			}
+			if entry.extentLengths, err = wc.extentLengths(size); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if joliet {
+		wc.uniqueJolietIdentifiers(dirPath, entries)
+
+		// the original names don't necessarily sort the same way as the mangled ones
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].identifier < entries[j].identifier
+		})
+	}
+
+	return entries, nil
+}
+
+// uniqueJolietIdentifiers renames the entries of a directory whose Joliet identifiers are already taken
+// by preceding ones, which happens when names only differ in forbidden characters or beyond 64 characters
+func (wc *writeContext) uniqueJolietIdentifiers(dirPath string, entries []stagedEntry) {
+	used := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		used[e.identifier] = true
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for i, e := range entries {
+		if !seen[e.identifier] {
+			seen[e.identifier] = true
+			continue
+		}
+
+		name := wc.originalName(path.Join(dirPath, e.Name()))
+		for n := 1; ; n++ {
+			identifier := string(encodeUCS2(uniqueJolietIdentifier(name, e.IsDir(), n)))
+			if !used[identifier] {
+				used[identifier], seen[identifier] = true, true
+				entries[i].identifier = identifier
+				break
+			}
+		}
+	}
+}
+
+// extentLengths splits a file of the given size into extents, see ECMA-119 6.5.1
+func (wc *writeContext) extentLengths(size int64) ([]uint32, error) {
+	if size <= math.MaxUint32 {
+		return []uint32{uint32(size)}, nil
+	}
+	if wc.interchangeLevel < 3 {
+		return nil, ErrFileTooLarge
+	}
+
+	var lengths []uint32
+	for ; size > int64(maxExtentLength); size -= int64(maxExtentLength) {
+		lengths = append(lengths, maxExtentLength)
+	}
+	return append(lengths, uint32(size)), nil
+}
+
+// originalName returns the name a staged file had before it was mangled
+func (wc *writeContext) originalName(stagedPath string) string {
+	relativePath := strings.TrimPrefix(stagedPath, wc.stagingDir+"/")
+	if name, ok := wc.originalNames[relativePath]; ok {
+		return name
+	}
+
+	// the file has been staged in some other way, so recover what we can
+	return strings.Split(path.Base(stagedPath), ";")[0]
+}
+
+// directoryLayout holds the contents of a staged directory along with
+// the System Use areas of its records and their Continuation Areas.
+type directoryLayout struct {
+	entries          []stagedEntry
+	dotSystemUse     []byte
+	dotDotSystemUse  []byte
+	continuationArea continuationArea
+}
+
+// layoutDirectory lists a staged directory and, if Rock Ridge is enabled for the directory tree,
+// prepares the System Use areas of all its records. The entries which don't fit into their records
+// are spilled into Continuation Areas located at the given sector.
+func (wc *writeContext) layoutDirectory(dirPath string, joliet bool, continuationLocation uint32) (*directoryLayout, error) {
+	contents, err := wc.readStagedDir(dirPath, joliet)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &directoryLayout{
+		entries:          contents,
+		continuationArea: continuationArea{location: continuationLocation},
+	}
+
+	if !wc.rockRidge || joliet {
+		return layout, nil
+	}
+
+	parentPath := path.Dir(dirPath)
+	dotEntries, err := wc.rockRidgeEntries(dirPath, "")
+	if err != nil {
+		return nil, err
+	}
+	if dirPath == wc.stagingDir {
+		parentPath = dirPath
+
+		// SUSP-112 5.3 and 5.5: the root directory announces the use of SUSP and Rock Ridge
+		sp := marshalSPRecord(&SPRecord{BytesSkipped: 0})
+		er := marshalExtensionRecord(&ExtensionRecord{
+			Version:    RockRidgeVersion,
+			Identifier: RockRidgeIdentifier,
+			Descriptor: rockRidgeDescriptor,
+			Source:     rockRidgeSource,
+		})
+		dotEntries = append(append([]SystemUseEntry{sp}, dotEntries...), er)
+	}
+	dotDotEntries, err := wc.rockRidgeEntries(parentPath, "")
+	if err != nil {
+		return nil, err
+	}
+
+	layout.dotSystemUse = layout.systemUse(dotEntries, 1)
+	layout.dotDotSystemUse = layout.systemUse(dotDotEntries, 1)
+
+	for i, c := range layout.entries {
+		childPath := path.Join(dirPath, c.Name())
+		entries, err := wc.rockRidgeEntries(childPath, wc.originalName(childPath))
+		if err != nil {
+			return nil, err
+		}
+		layout.entries[i].systemUse = layout.systemUse(entries, len(c.identifier))
+	}
+
+	return layout, nil
+}
+
+// systemUse returns the System Use area of a record with an identifier of the given length,
+// moving entries to the Continuation Area if the record would exceed its maximum length.
+func (dl *directoryLayout) systemUse(entries []SystemUseEntry, identifierLen int) []byte {
+	space := 255 - (33 + identifierLen + (identifierLen+1)%2)
+
+	inline, continued := splitSystemUse(entries, space)
+	if len(continued) > 0 {
+		inline = append(inline, dl.continuationArea.place(continued))
+	}
+
+	var systemUse []byte
+	for _, e := range inline {
+		systemUse = append(systemUse, e...)
+	}
+	return systemUse
+}
+
+// recordSectors calculates the number of sectors occupied by the records of the directory
+func (dl *directoryLayout) recordSectors() uint32 {
+	sectors := uint32(1)
+	currentSectorOccupied := directoryRecordLength(1, len(dl.dotSystemUse)) + directoryRecordLength(1, len(dl.dotDotSystemUse))
+
+	for _, c := range dl.entries {
+		entryLength := directoryRecordLength(len(c.identifier), len(c.systemUse))
+
+		// multi-extent files are recorded in several records
+		records := len(c.extentLengths)
+		if records == 0 {
+			records = 1
+		}
+
+		for ; records > 0; records-- {
+			if currentSectorOccupied+entryLength > sectorSize {
+				sectors++
+				currentSectorOccupied = entryLength
+			} else {
+				currentSectorOccupied += entryLength
+			}
+		}
+	}
+
+	return sectors
+}
+
+// directoryRecordLength calculates the length of a record, see ECMA-119 9.1
+func directoryRecordLength(identifierLen, systemUseLen int) uint32 {
+	idPaddingLen := (identifierLen + 1) % 2
+	return uint32(33 + identifierLen + idPaddingLen + systemUseLen)
+}
+
 // calculateDirChildrenSectors calculates the total mashalled size of all DirectoryEntries
-// within a directory. The size of each entry depends of the length of the filename.
-func calculateDirChildrenSectors(path string) (uint32, error) {
-	contents, err := os.ReadDir(path)
+// within a directory, as well as the size of their Continuation Areas. The size of each entry
+// depends of the length of the filename and the System Use entries recorded along with it.
+func (wc *writeContext) calculateDirChildrenSectors(path string, joliet bool) (uint32, uint32, error) {
+	layout, err := wc.layoutDirectory(path, joliet, 0)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
-	var sectors uint32
-	var currentSectorOccupied uint32 = 68 // the 0x00 and 0x01 entries
+	return layout.recordSectors(), layout.continuationArea.sectors(), nil
+}
 
-	for _, c := range contents {
-		identifierLen := len(c.Name())
-		idPaddingLen := (identifierLen + 1) % 2
-		entryLength := uint32(33 + identifierLen + idPaddingLen)
+// rockRidgeEntries returns the Rock Ridge entries describing a staged file or directory.
+// The name is recorded in NM entries unless it is empty, as is the case for "." and "..".
+func (wc *writeContext) rockRidgeEntries(stagedPath string, name string) ([]SystemUseEntry, error) {
+	attrs, modTime, err := wc.posixAttributes(stagedPath)
+	if err != nil {
+		return nil, err
+	}
 
-		if currentSectorOccupied+entryLength > sectorSize {
-			sectors++
-			currentSectorOccupied = entryLength
-		} else {
-			currentSectorOccupied += entryLength
+	entries := []SystemUseEntry{
+		marshalRockRidgePosixEntry(attrs),
+		marshalRockRidgeTimestampEntry(&RockRidgeTimestamps{Modify: modTime, Access: modTime, AttributeChange: modTime}),
+	}
+
+	if name != "" {
+		entries = append(entries, marshalRockRidgeNameEntries(name)...)
+	}
+
+	if zf := wc.zisofsEntry(stagedPath); zf != nil {
+		entries = append(entries, marshalRockRidgeZisofsEntry(zf))
+	}
+
+	if attrs.Mode&os.ModeSymlink != 0 {
+		target, err := os.Readlink(stagedPath)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, marshalRockRidgeSymlinkEntries(target)...)
+	}
+
+	return entries, nil
+}
+
+// posixAttributes returns the attributes and the modification time of a staged file or directory,
+// which are taken from the local file it was added from, if any
+func (wc *writeContext) posixAttributes(stagedPath string) (*PosixAttributes, time.Time, error) {
+	stagedInfo, err := os.Lstat(stagedPath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	relativePath := strings.TrimPrefix(stagedPath, wc.stagingDir+"/")
+	localInfo, hasLocalInfo := wc.localFileInfos[relativePath]
+
+	attrs := &PosixAttributes{Links: 1}
+	modTime := stagedInfo.ModTime()
+
+	switch {
+	case stagedInfo.Mode()&os.ModeSymlink != 0:
+		attrs.Mode = os.ModeSymlink | 0777
+	case stagedInfo.IsDir():
+		attrs.Mode = os.ModeDir | 0755
+
+		// a directory is linked from its parent, its "." entry and the ".." entries of its subdirectories
+		contents, err := os.ReadDir(stagedPath)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		attrs.Links = 2
+		for _, c := range contents {
+			if c.IsDir() {
+				attrs.Links++
+			}
 		}
+	default:
+		attrs.Mode = 0644
 	}
 
-	if currentSectorOccupied > 0 {
-		sectors++
+	if hasLocalInfo {
+		attrs.Mode = attrs.Mode.Type() | localInfo.Mode().Perm() | localInfo.Mode()&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)
+		if previous, ok := localInfo.Sys().(*PosixAttributes); ok {
+			// the file is carried over from the previous session
+			attrs.UID, attrs.GID = previous.UID, previous.GID
+		} else {
+			attrs.UID, attrs.GID = fileOwner(localInfo)
+		}
+		modTime = localInfo.ModTime()
 	}
 
-	return sectors, nil
+	return attrs, modTime, nil
 }
 
 func fileLengthToSectors(l uint32) uint32 {
@@ -294,21 +814,46 @@ func fileLengthToSectors(l uint32) uint32 {
 
 type writeContext struct {
 	stagingDir        string
+	originalNames     map[string]string
+	localFileInfos    map[string]os.FileInfo
+	previousFiles     map[string][]*DirectoryEntry
+	rockRidge         bool
+	interchangeLevel  int
 	timestamp         RecordingTimestamp
+	sessionStart      uint32
 	freeSectorPointer uint32
+
+	// fileEntries holds the DirectoryEntries of staged files in the primary directory tree,
+	// so that other directory trees can refer to the same extents.
+	fileEntries map[string]*DirectoryEntry
+
+	// extentEntries holds the DirectoryEntries of the following extents of multi-extent files
+	extentEntries map[string][]*DirectoryEntry
+
+	// generatedFiles holds contents which are written instead of those of the staged files,
+	// such as the boot catalog, which can only be generated once all files are placed.
+	generatedFiles map[string][]byte
+
+	// compressedFiles holds the staged files which are written compressed in the zisofs format
+	// with blocks of 2^zisofsBlockSizeLog2 bytes
+	zisofsBlockSizeLog2 int
+	compressedFiles     map[string]*compressedFile
 }
 
 func (wc *writeContext) allocateSectors(n uint32) uint32 {
 	return atomic.AddUint32(&wc.freeSectorPointer, n) - n
 }
 
-func (wc *writeContext) createDEForRoot() (*DirectoryEntry, error) {
-	extentLengthInSectors, err := calculateDirChildrenSectors(wc.stagingDir)
+// createDEForRoot allocates the root directory along with its Continuation Areas,
+// which directly follow the directory's records.
+func (wc *writeContext) createDEForRoot(joliet bool) (*DirectoryEntry, uint32, error) {
+	extentLengthInSectors, continuationSectors, err := wc.calculateDirChildrenSectors(wc.stagingDir, joliet)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	extentLocation := wc.allocateSectors(extentLengthInSectors)
+	continuationLocation := wc.allocateSectors(continuationSectors)
 	de := &DirectoryEntry{
 		ExtendedAtributeRecordLength: 0,
 		ExtentLocation:               int32(extentLocation),
@@ -321,56 +866,95 @@ func (wc *writeContext) createDEForRoot() (*DirectoryEntry, error) {
 		Identifier:                   string([]byte{0}),
 		SystemUse:                    []byte{},
 	}
-	return de, nil
+	return de, continuationLocation, nil
 }
 
 type itemToWrite struct {
 	isDirectory     bool
+	joliet          bool // the item is a directory of the Joliet tree
 	dirPath         string
 	ownEntry        *DirectoryEntry
 	parentEntery    *DirectoryEntry
 	childrenEntries []*DirectoryEntry
 	targetSector    uint32
+
+	// Continuation Areas of a directory's records are written right after them
+	continuationLocation uint32
+	layout               *directoryLayout
 }
 
 // scanDirectory reads the directory's contents and adds them to the queue, as well as stores all their DirectoryEntries in the item,
 // because we'll need them to write this item's descriptor.
 func (wc *writeContext) scanDirectory(item *itemToWrite, dirPath string, ownEntry *DirectoryEntry, parentEntery *DirectoryEntry, targetSector uint32) (*list.List, error) {
-	contents, err := os.ReadDir(dirPath)
+	joliet := item != nil && item.joliet
+	var continuationLocation uint32
+	if item != nil {
+		continuationLocation = item.continuationLocation
+	}
+
+	layout, err := wc.layoutDirectory(dirPath, joliet, continuationLocation)
 	if err != nil {
 		return nil, err
 	}
+	if item != nil {
+		item.layout = layout
+	}
 
 	itemsToWrite := list.New()
 
-	for _, c := range contents {
+	for _, c := range layout.entries {
 		var (
 			fileFlags             byte
 			extentLengthInSectors uint32
 			extentLength          uint32
+			continuationSectors   uint32
 		)
+		isSymlink := c.Type()&os.ModeSymlink != 0
+		childPath := path.Join(dirPath, c.Name())
 		if c.IsDir() {
-			extentLengthInSectors, err = calculateDirChildrenSectors(path.Join(dirPath, c.Name()))
+			extentLengthInSectors, continuationSectors, err = wc.calculateDirChildrenSectors(childPath, joliet)
 			if err != nil {
 				return nil, err
 			}
 			fileFlags = dirFlagDir
 			extentLength = extentLengthInSectors * sectorSize
-		} else {
-			fileinfo, err := c.Info()
-			if err != nil {
-				return nil, err
+		} else if joliet {
+			// The file's data has already been placed by the primary directory tree.
+			for _, primaryEntry := range append([]*DirectoryEntry{wc.fileEntries[childPath]}, wc.extentEntries[childPath]...) {
+				de := primaryEntry.Clone()
+				de.Identifier = c.identifier
+				de.SystemUse = []byte{}
+				item.childrenEntries = append(item.childrenEntries, &de)
 			}
-			if fileinfo.Size() > int64(math.MaxUint32) {
-				return nil, ErrFileTooLarge
+			continue
+		} else if records, ok := wc.previousFiles[strings.TrimPrefix(childPath, wc.stagingDir+"/")]; ok {
+			// The file's data has already been recorded by the previous session.
+			for i, previous := range records {
+				de := previous.Clone()
+				de.Identifier = c.identifier
+				de.SystemUse = c.systemUse
+				item.childrenEntries = append(item.childrenEntries, &de)
+				if i == 0 {
+					wc.fileEntries[childPath] = &de
+				} else {
+					wc.extentEntries[childPath] = append(wc.extentEntries[childPath], &de)
+				}
+			}
+			continue
+		} else if isSymlink {
+			// symbolic links are recorded as empty files with an SL entry
+			fileFlags = 0
+		} else {
+			extentLength = c.extentLengths[0]
+			for _, l := range c.extentLengths {
+				extentLengthInSectors += fileLengthToSectors(l)
 			}
-			extentLength = uint32(fileinfo.Size())
-			extentLengthInSectors = fileLengthToSectors(extentLength)
 
 			fileFlags = 0
 		}
 
 		extentLocation := wc.allocateSectors(extentLengthInSectors)
+		childContinuationLocation := wc.allocateSectors(continuationSectors)
 		de := &DirectoryEntry{
 			ExtendedAtributeRecordLength: 0,
 			ExtentLocation:               int32(extentLocation),
@@ -380,8 +964,12 @@ func (wc *writeContext) scanDirectory(item *itemToWrite, dirPath string, ownEntr
 			FileUnitSize:                 0, // 0 for non-interleaved write
 			InterleaveGap:                0, // not interleaved
 			VolumeSequenceNumber:         1, // we only have one volume
-			Identifier:                   c.Name(),
-			SystemUse:                    []byte{},
+			Identifier:                   c.identifier,
+			SystemUse:                    c.systemUse,
+		}
+
+		if !c.IsDir() {
+			wc.fileEntries[childPath] = de
 		}
 
 		// Add this child's descriptor to the currently scanned directory's list of children,
@@ -392,27 +980,50 @@ func (wc *writeContext) scanDirectory(item *itemToWrite, dirPath string, ownEntr
 			item.childrenEntries = append(item.childrenEntries, de)
 		}
 
+		// the extents of a multi-extent file follow each other, all records but the last carry the flag
+		for i := 1; i < len(c.extentLengths); i++ {
+			previous := item.childrenEntries[len(item.childrenEntries)-1]
+			previous.FileFlags |= dirFlagMultiExtent
+
+			next := previous.Clone()
+			next.ExtentLocation += int32(fileLengthToSectors(previous.ExtentLength))
+			next.ExtentLength = c.extentLengths[i]
+			next.FileFlags &^= dirFlagMultiExtent
+			item.childrenEntries = append(item.childrenEntries, &next)
+			wc.extentEntries[childPath] = append(wc.extentEntries[childPath], &next)
+		}
+
+		if isSymlink {
+			// there is no data to write
+			continue
+		}
+
 		// queue this child for processing
 		itemsToWrite.PushBack(itemToWrite{
-			isDirectory:  c.IsDir(),
-			dirPath:      path.Join(dirPath, c.Name()),
-			ownEntry:     de,
-			parentEntery: ownEntry,
-			targetSector: uint32(de.ExtentLocation),
+			isDirectory:          c.IsDir(),
+			joliet:               joliet,
+			dirPath:              childPath,
+			ownEntry:             de,
+			parentEntery:         ownEntry,
+			targetSector:         uint32(de.ExtentLocation),
+			continuationLocation: childContinuationLocation,
 		})
 	}
 
 	return itemsToWrite, nil
 }
 
-// processDirectory writes a given directory item to the destination sectors
-func processDirectory(w io.Writer, children []*DirectoryEntry, ownEntry *DirectoryEntry, parentEntry *DirectoryEntry) error {
+// processDirectory writes a given directory item to the destination sectors,
+// followed by the Continuation Areas of its records
+func processDirectory(w io.Writer, it *itemToWrite) error {
 	var currentOffset uint32
 
-	currentDE := ownEntry.Clone()
+	currentDE := it.ownEntry.Clone()
 	currentDE.Identifier = string([]byte{0})
-	parentDE := parentEntry.Clone()
+	currentDE.SystemUse = it.layout.dotSystemUse
+	parentDE := it.parentEntery.Clone()
 	parentDE.Identifier = string([]byte{1})
+	parentDE.SystemUse = it.layout.dotDotSystemUse
 
 	currentDEData, err := currentDE.MarshalBinary()
 	if err != nil {
@@ -434,7 +1045,7 @@ func processDirectory(w io.Writer, children []*DirectoryEntry, ownEntry *Directo
 	}
 	currentOffset += uint32(n)
 
-	for _, childDescriptor := range children {
+	for _, childDescriptor := range it.childrenEntries {
 		data, err := childDescriptor.MarshalBinary()
 		if err != nil {
 			return err
@@ -462,18 +1073,34 @@ func processDirectory(w io.Writer, children []*DirectoryEntry, ownEntry *Directo
 	}
 
 	// fill with zeros to the end of the sector
-	remainingSectorSpace := sectorSize - (currentOffset % sectorSize)
-	if remainingSectorSpace != 0 {
-		zeros := bytes.Repeat([]byte{0}, int(remainingSectorSpace))
+	if occupied := currentOffset % sectorSize; occupied != 0 {
+		zeros := bytes.Repeat([]byte{0}, int(sectorSize-occupied))
 		_, err = w.Write(zeros)
 		if err != nil {
 			return err
 		}
 	}
 
+	continuation := it.layout.continuationArea
+	if len(continuation.data) > 0 {
+		padded := make([]byte, continuation.sectors()*sectorSize)
+		copy(padded, continuation.data)
+		if _, err = w.Write(padded); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// processGeneratedFile writes the given contents in place of a staged file
+func processGeneratedFile(w io.Writer, data []byte) error {
+	padded := make([]byte, fileLengthToSectors(uint32(len(data)))*sectorSize)
+	copy(padded, data)
+	_, err := w.Write(padded)
+	return err
+}
+
 func processFile(w io.Writer, dirPath string) error {
 	f, err := os.Open(dirPath)
 	if err != nil {
@@ -486,18 +1113,15 @@ func processFile(w io.Writer, dirPath string) error {
 		return err
 	}
 
-	if fileinfo.Size() > int64(math.MaxUint32) {
-		return ErrFileTooLarge
-	}
-
 	buffer := make([]byte, sectorSize)
 
-	for bytesLeft := uint32(fileinfo.Size()); bytesLeft > 0; {
-		var toRead uint32
-		if bytesLeft < sectorSize {
+	// the extents of multi-extent files are contiguous, so they can be written in one go
+	for bytesLeft := fileinfo.Size(); bytesLeft > 0; {
+		var toRead int64
+		if bytesLeft < int64(sectorSize) {
 			toRead = bytesLeft
 		} else {
-			toRead = sectorSize
+			toRead = int64(sectorSize)
 		}
 
 		if _, err = io.ReadAtLeast(f, buffer, int(toRead)); err != nil {
@@ -538,12 +1162,16 @@ func (wc *writeContext) traverseStagingDir(rootItem itemToWrite) (*list.List, er
 	return itemsToWrite, nil
 }
 
-func writeAll(w io.Writer, itemsToWrite *list.List) error {
+func (wc *writeContext) writeAll(w io.Writer, itemsToWrite *list.List) error {
 	for item := itemsToWrite.Front(); item != nil; item = item.Next() {
 		it := item.Value.(itemToWrite)
 		var err error
 		if it.isDirectory {
-			err = processDirectory(w, it.childrenEntries, it.ownEntry, it.parentEntery)
+			err = processDirectory(w, &it)
+		} else if data, ok := wc.generatedFiles[it.dirPath]; ok {
+			err = processGeneratedFile(w, data)
+		} else if cf, ok := wc.compressedFiles[it.dirPath]; ok {
+			err = processFile(w, cf.path)
 		} else {
 			err = processFile(w, it.dirPath)
 		}
@@ -556,27 +1184,84 @@ func writeAll(w io.Writer, itemsToWrite *list.List) error {
 	return nil
 }
 
-// WriteTo writes the image to the given WriterAt
+// WriteTo writes the image to the given WriterAt.
+// When appending to an existing image, it writes the new session, which starts at SessionOffset.
 func (iw *ImageWriter) WriteTo(w io.Writer, volumeIdentifier string) error {
 	now := time.Now()
 
+	volumeDescriptorCount := uint32(2) // primary + terminator
+	if iw.joliet {
+		volumeDescriptorCount++
+	}
+	if len(iw.bootImages) > 0 || iw.previousBootRecord != nil {
+		volumeDescriptorCount++
+	}
+
 	wc := writeContext{
 		stagingDir:        iw.stagingDir,
+		originalNames:     iw.originalNames,
+		localFileInfos:    iw.localFileInfos,
+		previousFiles:     iw.previousFiles,
+		rockRidge:         iw.rockRidge,
+		interchangeLevel:  iw.interchangeLevel,
 		timestamp:         RecordingTimestamp{},
-		freeSectorPointer: 18, // system area (16) + 2 volume descriptors
+		sessionStart:      iw.sessionStart,
+		freeSectorPointer: iw.sessionStart + systemAreaSectors + volumeDescriptorCount, // system area (16) + volume descriptors
+		fileEntries:       make(map[string]*DirectoryEntry),
+		extentEntries:     make(map[string][]*DirectoryEntry),
+		generatedFiles:    make(map[string][]byte),
+
+		zisofsBlockSizeLog2: iw.zisofsBlockSizeLog2,
+		compressedFiles:     make(map[string]*compressedFile),
+	}
+
+	if iw.zisofsBlockSizeLog2 != 0 {
+		// the compressed files are kept next to the staging directory, which has room for the payload
+		compressionDir, err := os.MkdirTemp(filepath.Dir(iw.stagingDir), "iso9660-zisofs-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(compressionDir)
+
+		if err := wc.compressStagedFiles(iw, compressionDir); err != nil {
+			return fmt.Errorf("compressing files: %w", err)
+		}
 	}
 
-	rootDE, err := wc.createDEForRoot()
+	var udf *udfLayout
+	if iw.udfRevision != 0 {
+		// the partition of UDF, which holds everything else, starts right after the anchor
+		wc.freeSectorPointer = udfPartitionStart
+		var err error
+		if udf, err = wc.layoutUDF(iw.udfRevision); err != nil {
+			return fmt.Errorf("laying out UDF: %s", err)
+		}
+	}
+
+	// the path tables directly follow the volume descriptors
+	pathTable, err := wc.layoutPathTable(false, iw.pathTableCopies)
+	if err != nil {
+		return fmt.Errorf("creating path table: %s", err)
+	}
+	var jolietPathTable *pathTableLayout
+	if iw.joliet {
+		if jolietPathTable, err = wc.layoutPathTable(true, iw.pathTableCopies); err != nil {
+			return fmt.Errorf("creating Joliet path table: %s", err)
+		}
+	}
+
+	rootDE, rootContinuationLocation, err := wc.createDEForRoot(false)
 	if err != nil {
 		return fmt.Errorf("creating root directory descriptor: %s", err)
 	}
 
 	rootItem := itemToWrite{
-		isDirectory:  true,
-		dirPath:      wc.stagingDir,
-		ownEntry:     rootDE,
-		parentEntery: rootDE,
-		targetSector: uint32(rootDE.ExtentLocation),
+		isDirectory:          true,
+		dirPath:              wc.stagingDir,
+		ownEntry:             rootDE,
+		parentEntery:         rootDE,
+		targetSector:         uint32(rootDE.ExtentLocation),
+		continuationLocation: rootContinuationLocation,
 	}
 
 	itemsToWrite, err := wc.traverseStagingDir(rootItem)
@@ -584,6 +1269,41 @@ func (iw *ImageWriter) WriteTo(w io.Writer, volumeIdentifier string) error {
 		return fmt.Errorf("tranversing staging directory: %s", err)
 	}
 
+	var jolietRootDE *DirectoryEntry
+	if iw.joliet {
+		jolietRootDE, _, err = wc.createDEForRoot(true)
+		if err != nil {
+			return fmt.Errorf("creating Joliet root directory descriptor: %s", err)
+		}
+
+		jolietRootItem := itemToWrite{
+			isDirectory:  true,
+			joliet:       true,
+			dirPath:      wc.stagingDir,
+			ownEntry:     jolietRootDE,
+			parentEntery: jolietRootDE,
+			targetSector: uint32(jolietRootDE.ExtentLocation),
+		}
+
+		jolietItems, err := wc.traverseStagingDir(jolietRootItem)
+		if err != nil {
+			return fmt.Errorf("tranversing staging directory for Joliet: %s", err)
+		}
+		itemsToWrite.PushBackList(jolietItems)
+	}
+
+	var udfEndAnchor uint32
+	if udf != nil {
+		// the second anchor is recorded in the last sector of the partition, ahead of a backup GPT
+		udfEndAnchor = wc.allocateSectors(1)
+		udf.partitionLength = udfEndAnchor - udfPartitionStart
+	}
+
+	if iw.isohybrid {
+		// the backup GPT occupies the last sectors of the image
+		wc.allocateSectors(gptBackupSectors)
+	}
+
 	pvd := volumeDescriptor{
 		Header: volumeDescriptorHeader{
 			Type:       volumeTypePrimary,
@@ -597,11 +1317,6 @@ func (iw *ImageWriter) WriteTo(w io.Writer, volumeIdentifier string) error {
 			VolumeSetSize:                 1,
 			VolumeSequenceNumber:          1,
 			LogicalBlockSize:              int16(sectorSize),
-			PathTableSize:                 0,
-			TypeLPathTableLoc:             0,
-			OptTypeLPathTableLoc:          0,
-			TypeMPathTableLoc:             0,
-			OptTypeMPathTableLoc:          0,
 			RootDirectoryEntry:            rootDE,
 			VolumeSetIdentifier:           "",
 			PublisherIdentifier:           "",
@@ -619,6 +1334,61 @@ func (iw *ImageWriter) WriteTo(w io.Writer, volumeIdentifier string) error {
 		},
 	}
 
+	pathTable.setLocations(itemsToWrite)
+	pathTable.setVolumeDescriptorFields(pvd.Primary)
+	pathTables := pathTable.tables()
+
+	volumeDescriptors := []volumeDescriptor{pvd}
+
+	if len(iw.bootImages) > 0 {
+		catalogLocation, err := wc.prepareBootCatalog(iw)
+		if err != nil {
+			return fmt.Errorf("preparing El Torito boot catalog: %s", err)
+		}
+
+		// El Torito requires the boot record to be located in sector 17, right after the primary volume descriptor
+		boot := &BootVolumeDescriptorBody{BootSystemIdentifier: elToritoBootSystemIdentifier}
+		binary.LittleEndian.PutUint32(boot.BootSystemUse[0:4], catalogLocation)
+
+		volumeDescriptors = append(volumeDescriptors, volumeDescriptor{
+			Header: volumeDescriptorHeader{
+				Type:       volumeTypeBoot,
+				Identifier: standardIdentifierBytes,
+				Version:    1,
+			},
+			Boot: boot,
+		})
+	} else if iw.previousBootRecord != nil {
+		// the boot catalog of the previous session stays where it is
+		volumeDescriptors = append(volumeDescriptors, volumeDescriptor{
+			Header: volumeDescriptorHeader{
+				Type:       volumeTypeBoot,
+				Identifier: standardIdentifierBytes,
+				Version:    1,
+			},
+			Boot: iw.previousBootRecord,
+		})
+	}
+
+	if iw.joliet {
+		// the Joliet SVD describes the same volume, just with a different directory tree
+		svdBody := *pvd.Primary
+		svdBody.RootDirectoryEntry = jolietRootDE
+		copy(svdBody.EscapeSequences[:], jolietLevel3Escape)
+		jolietPathTable.setLocations(itemsToWrite)
+		jolietPathTable.setVolumeDescriptorFields(&svdBody)
+		pathTables = append(pathTables, jolietPathTable.tables()...)
+
+		volumeDescriptors = append(volumeDescriptors, volumeDescriptor{
+			Header: volumeDescriptorHeader{
+				Type:       volumeTypeSupplementary,
+				Identifier: standardIdentifierBytes,
+				Version:    1,
+			},
+			Primary: &svdBody,
+		})
+	}
+
 	terminator := volumeDescriptor{
 		Header: volumeDescriptorHeader{
 			Type:       volumeTypeTerminator,
@@ -626,33 +1396,59 @@ func (iw *ImageWriter) WriteTo(w io.Writer, volumeIdentifier string) error {
 			Version:    1,
 		},
 	}
+	volumeDescriptors = append(volumeDescriptors, terminator)
 
-	// write 16 sectors of zeroes
-	zeroSector := bytes.Repeat([]byte{0}, int(sectorSize))
-	for i := uint32(0); i < 16; i++ {
-		if _, err = w.Write(zeroSector); err != nil {
-			return err
+	systemArea := make([]byte, systemAreaSectors*int(sectorSize))
+	var gptBackup []byte
+	if iw.isohybrid {
+		systemArea, gptBackup, err = wc.hybridSystemArea(iw, wc.freeSectorPointer)
+		if err != nil {
+			return fmt.Errorf("partitioning hybrid image: %s", err)
 		}
 	}
 
-	buffer, err := pvd.MarshalBinary()
-	if err != nil {
+	if _, err = w.Write(systemArea); err != nil {
 		return err
 	}
-	if _, err = w.Write(buffer); err != nil {
-		return err
+
+	for _, vd := range volumeDescriptors {
+		buffer, err := vd.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(buffer); err != nil {
+			return err
+		}
 	}
 
-	if buffer, err = terminator.MarshalBinary(); err != nil {
-		return err
+	if udf != nil {
+		if err = udf.writeVolumeStructures(w, systemAreaSectors+uint32(len(volumeDescriptors)), volumeIdentifier, now); err != nil {
+			return err
+		}
+		if err = udf.writeFileSet(w, &wc, volumeIdentifier, now); err != nil {
+			return fmt.Errorf("writing UDF file set: %s", err)
+		}
 	}
-	if _, err = w.Write(buffer); err != nil {
-		return err
+
+	for _, table := range pathTables {
+		if _, err = w.Write(table); err != nil {
+			return err
+		}
 	}
 
-	if err = writeAll(w, itemsToWrite); err != nil {
+	if err = wc.writeAll(w, itemsToWrite); err != nil {
 		return fmt.Errorf("writing files: %s", err)
 	}
 
+	if udf != nil {
+		if err = processGeneratedFile(w, udf.anchor(udfEndAnchor)); err != nil {
+			return err
+		}
+	}
+
+	if _, err = w.Write(gptBackup); err != nil {
+		return err
+	}
+
 	return nil
 }
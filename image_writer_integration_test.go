@@ -172,3 +172,104 @@ func TestWriterAndMountWithAddLocal(t *testing.T) {
 	output, err = umountCmd.CombinedOutput()
 	assert.NoError(t, err, "failed to unmount the ISO image: %v\n%s", err, string(output))
 }
+
+// Linux prefers the Joliet tree over the primary one when mounting,
+// so the original file names have to be visible.
+func TestWriterAndMountJoliet(t *testing.T) {
+	w, err := NewWriter(WithJoliet())
+	assert.NoError(t, err)
+	defer func() {
+		if cleanupErr := w.Cleanup(); cleanupErr != nil {
+			t.Fatalf("failed to cleanup writer: %v", cleanupErr)
+		}
+	}()
+
+	longPath := "Program Files/Some Vendor/A File With A Rather Long Name.txt"
+	err = w.AddFile(strings.NewReader("hrh2309hr320h"), longPath)
+	assert.NoError(t, err)
+
+	f, err := os.CreateTemp(os.TempDir(), "iso9660_golang_test")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	err = w.WriteTo(f, "testvolume")
+	assert.NoError(t, err)
+
+	mountDir, err := os.MkdirTemp("", "")
+	assert.NoError(t, err)
+	defer func() {
+		if removeErr := os.RemoveAll(mountDir); removeErr != nil {
+			t.Fatalf("failed to delete mount directory: %v", removeErr)
+		}
+	}()
+
+	mountCmd := exec.Command("mount", "-t", "iso9660", f.Name(), mountDir)
+	output, err := mountCmd.CombinedOutput()
+	assert.NoError(t, err, "failed to mount the ISO image: %v\n%s", err, string(output))
+
+	data, err := os.ReadFile(filepath.Join(mountDir, longPath))
+	assert.NoError(t, err)
+	assert.Equal(t, "hrh2309hr320h", string(data))
+
+	umountCmd := exec.Command("umount", mountDir)
+	output, err = umountCmd.CombinedOutput()
+	assert.NoError(t, err, "failed to unmount the ISO image: %v\n%s", err, string(output))
+}
+
+// Linux has to pick up the original names, modes and symlinks from the Rock Ridge entries.
+func TestWriterAndMountRockRidge(t *testing.T) {
+	w, err := NewWriter(WithRockRidge())
+	assert.NoError(t, err)
+	defer func() {
+		if cleanupErr := w.Cleanup(); cleanupErr != nil {
+			t.Fatalf("failed to cleanup writer: %v", cleanupErr)
+		}
+	}()
+
+	tmpdir, err := os.MkdirTemp("", "iso9660_golang_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	scriptPath := filepath.Join(tmpdir, "Run Me.sh")
+	assert.NoError(t, os.WriteFile(scriptPath, []byte("#!/bin/sh\n"), 0755))
+	assert.NoError(t, os.Symlink("Run Me.sh", filepath.Join(tmpdir, "link")))
+	assert.NoError(t, w.AddLocalDirectory(tmpdir, "Mixed Case"))
+
+	longName := strings.Repeat("A Rather Long File Name ", 8) + ".txt"
+	assert.NoError(t, w.AddFile(strings.NewReader("hrh2309hr320h"), longName))
+
+	f, err := os.CreateTemp(os.TempDir(), "iso9660_golang_test")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	err = w.WriteTo(f, "testvolume")
+	assert.NoError(t, err)
+
+	mountDir, err := os.MkdirTemp("", "")
+	assert.NoError(t, err)
+	defer func() {
+		if removeErr := os.RemoveAll(mountDir); removeErr != nil {
+			t.Fatalf("failed to delete mount directory: %v", removeErr)
+		}
+	}()
+
+	mountCmd := exec.Command("mount", "-t", "iso9660", f.Name(), mountDir)
+	output, err := mountCmd.CombinedOutput()
+	assert.NoError(t, err, "failed to mount the ISO image: %v\n%s", err, string(output))
+
+	data, err := os.ReadFile(filepath.Join(mountDir, longName))
+	assert.NoError(t, err)
+	assert.Equal(t, "hrh2309hr320h", string(data))
+
+	info, err := os.Stat(filepath.Join(mountDir, "Mixed Case", "Run Me.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode())
+
+	target, err := os.Readlink(filepath.Join(mountDir, "Mixed Case", "link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Run Me.sh", target)
+
+	umountCmd := exec.Command("umount", mountDir)
+	output, err = umountCmd.CombinedOutput()
+	assert.NoError(t, err, "failed to unmount the ISO image: %v\n%s", err, string(output))
+}
@@ -4,10 +4,17 @@
 package iso9660
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -194,7 +201,7 @@ func TestWriter_AddSymlink(t *testing.T) {
 	assert.NoError(t, err)
 
 	err = w.AddLocalFile(symlinkPath, "foo")
-	assert.ErrorContains(t, err, " is a symlink - these are not yet supported")
+	assert.ErrorContains(t, err, " is a symlink - these are only supported with Rock Ridge")
 }
 
 func TestWriter_CleanupInvalid(t *testing.T) {
@@ -218,3 +225,330 @@ func TestWriteContextScanDirectory(t *testing.T) {
 	// assert.ErrorIs(t, err, )
 	assert.EqualError(t, err, "open : no such file or directory")
 }
+
+func TestWriterJoliet(t *testing.T) {
+	w, err := NewWriter(WithJoliet())
+	assert.NoError(t, err)
+	defer func() {
+		if cleanupErr := w.Cleanup(); cleanupErr != nil {
+			t.Fatalf("failed to cleanup writer: %v", cleanupErr)
+		}
+	}()
+
+	longName := "This file name is longer than sixty-four characters, so it is truncated.txt"
+	assert.NoError(t, w.AddFile(strings.NewReader(loremIpsum), "Drivers/Zażółć gęślą jaźń.inf"))
+	assert.NoError(t, w.AddFile(strings.NewReader("hrh2309hr320h"), "Drivers/"+longName))
+	assert.NoError(t, w.AddFile(strings.NewReader("hrh2309hr320h"), "README"))
+
+	var buf bytes.Buffer
+	assert.NoError(t, w.WriteTo(&buf, "Joliet Volume"))
+
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	if assert.Len(t, img.volumeDescriptors, 3) {
+		assert.Equal(t, volumeTypeSupplementary, img.volumeDescriptors[1].Type())
+		assert.Equal(t, "Joliet Volume", img.volumeDescriptors[1].Primary.VolumeIdentifier)
+	}
+
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	isoChildren, err := root.GetChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, isoChildren, 2) {
+		assert.Equal(t, "drivers", isoChildren[0].Name())
+	}
+	isoDrivers, err := isoChildren[0].GetChildren()
+	assert.NoError(t, err)
+
+	jolietRoot, err := img.JolietRootDir()
+	assert.NoError(t, err)
+	children, err := jolietRoot.GetChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, children, 2) {
+		assert.Equal(t, "Drivers", children[0].Name())
+		assert.True(t, children[0].IsDir())
+		assert.Equal(t, "README", children[1].Name())
+	}
+
+	drivers, err := children[0].GetChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, drivers, 2) && assert.Len(t, isoDrivers, 2) {
+		assert.Equal(t, longName[:64], drivers[0].Name())
+		assert.Equal(t, "Zażółć gęślą jaźń.inf", drivers[1].Name())
+
+		data, err := io.ReadAll(drivers[1].Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, loremIpsum, string(data))
+
+		// the file data is shared between both trees
+		for _, isoFile := range isoDrivers {
+			if isoFile.Size() == int64(len(loremIpsum)) {
+				assert.Equal(t, isoFile.de.ExtentLocation, drivers[1].de.ExtentLocation)
+			}
+		}
+	}
+}
+
+func TestWriterRockRidge(t *testing.T) {
+	w, err := NewWriter(WithRockRidge(), WithJoliet())
+	assert.NoError(t, err)
+	defer func() {
+		if cleanupErr := w.Cleanup(); cleanupErr != nil {
+			t.Fatalf("failed to cleanup writer: %v", cleanupErr)
+		}
+	}()
+
+	tmpdir, err := os.MkdirTemp("", "iso9660_golang_test")
+	assert.NoError(t, err)
+	defer func() {
+		os.RemoveAll(tmpdir) // nolint: errcheck
+	}()
+
+	mtime := time.Date(2023, 8, 20, 12, 58, 31, 0, time.UTC)
+	localPath := path.Join(tmpdir, "Script.sh")
+	assert.NoError(t, os.WriteFile(localPath, []byte(loremIpsum), 0700))
+	assert.NoError(t, os.Chmod(localPath, 0750))
+	assert.NoError(t, os.Chtimes(localPath, mtime, mtime))
+	assert.NoError(t, w.AddLocalFile(localPath, "bin/Script.sh"))
+
+	// the target is long enough to need several SL entries in a Continuation Area
+	longTarget := "../" + strings.Repeat("very-long-directory-name/", 12) + "target"
+	for name, target := range map[string]string{"absolute": "/usr/share/doc", "relative": "./Script.sh", "long": longTarget} {
+		symlinkPath := path.Join(tmpdir, name)
+		assert.NoError(t, os.Symlink(target, symlinkPath))
+		assert.NoError(t, w.AddLocalFile(symlinkPath, "bin/"+name))
+	}
+
+	// enough long names to fill several sectors of records and Continuation Areas
+	expectedFiles := map[string]string{"bin/Script.sh": loremIpsum}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("Many Files/%03d %s.txt", i, strings.Repeat("Long Name ", 20))
+		assert.NoError(t, w.AddFile(strings.NewReader(name), name))
+		expectedFiles[name] = name
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, w.WriteTo(&buf, "Rock Ridge Volume"))
+
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	rootDot, err := root.GetDotEntry()
+	assert.NoError(t, err)
+	ers, err := rootDot.de.SystemUseEntries.GetExtensionRecords()
+	assert.NoError(t, err)
+	if assert.Len(t, ers, 1) {
+		assert.Equal(t, RockRidgeIdentifier, ers[0].Identifier)
+	}
+
+	fsys := img.FS()
+	for name, content := range expectedFiles {
+		data, err := fs.ReadFile(fsys, name)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+
+	info, err := fs.Stat(fsys, "bin/Script.sh")
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0750), info.Mode())
+	assert.True(t, mtime.Equal(info.ModTime()))
+	if attrs, ok := info.Sys().(*PosixAttributes); assert.True(t, ok) {
+		assert.Equal(t, uint32(os.Getuid()), attrs.UID)
+		assert.Equal(t, uint32(os.Getgid()), attrs.GID)
+	}
+
+	info, err = fs.Stat(fsys, "Many Files")
+	assert.NoError(t, err)
+	assert.Equal(t, fs.ModeDir|0755, info.Mode())
+
+	bin, err := fs.ReadDir(fsys, "bin")
+	assert.NoError(t, err)
+	targets := map[string]string{}
+	for _, entry := range bin {
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, err := entry.Info()
+			assert.NoError(t, err)
+			targets[entry.Name()], err = info.(*File).Readlink()
+			assert.NoError(t, err)
+		}
+	}
+	assert.Equal(t, map[string]string{"absolute": "/usr/share/doc", "relative": "./Script.sh", "long": longTarget}, targets)
+
+	assert.NoError(t, fstest.TestFS(fsys, "bin/Script.sh", "bin/long", "Many Files/049 "+strings.Repeat("Long Name ", 20)+".txt"))
+
+	// the Joliet tree refers to the same files, without any System Use entries
+	jolietRoot, err := img.JolietRootDir()
+	assert.NoError(t, err)
+	jolietChildren, err := jolietRoot.GetChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, jolietChildren, 2) {
+		assert.Equal(t, "Many Files", jolietChildren[0].Name())
+		assert.Empty(t, jolietChildren[0].de.SystemUse)
+	}
+}
+
+func TestWriterReplaceSymlink(t *testing.T) {
+	w, err := NewWriter(WithRockRidge())
+	assert.NoError(t, err)
+	defer func() {
+		if cleanupErr := w.Cleanup(); cleanupErr != nil {
+			t.Fatalf("failed to cleanup writer: %v", cleanupErr)
+		}
+	}()
+
+	tmpdir, err := os.MkdirTemp("", "iso9660_golang_test")
+	assert.NoError(t, err)
+	defer func() {
+		os.RemoveAll(tmpdir) // nolint: errcheck
+	}()
+
+	outside := path.Join(tmpdir, "outside.txt")
+	assert.NoError(t, os.WriteFile(outside, []byte("untouched"), 0644))
+	symlinkPath := path.Join(tmpdir, "link")
+	assert.NoError(t, os.Symlink(outside, symlinkPath))
+	assert.NoError(t, w.AddLocalFile(symlinkPath, "link"))
+
+	// the staged symlink is replaced, not written through
+	assert.NoError(t, w.AddFile(strings.NewReader(loremIpsum), "link"))
+	data, err := os.ReadFile(outside)
+	assert.NoError(t, err)
+	assert.Equal(t, "untouched", string(data))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "replaced")) {
+		return
+	}
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	data, err = fs.ReadFile(img.FS(), "link")
+	assert.NoError(t, err)
+	assert.Equal(t, loremIpsum, string(data))
+}
+
+// sparseImageBuffer keeps only the sectors of a written image which contain any data
+type sparseImageBuffer struct {
+	sectors map[int64][]byte
+	size    int64
+}
+
+func (sb *sparseImageBuffer) Write(p []byte) (int, error) {
+	for written := 0; written < len(p); {
+		sector, offset := sb.size/int64(sectorSize), int(sb.size%int64(sectorSize))
+		chunk := p[written:]
+		if len(chunk) > int(sectorSize)-offset {
+			chunk = chunk[:int(sectorSize)-offset]
+		}
+
+		if data, ok := sb.sectors[sector]; ok {
+			copy(data[offset:], chunk)
+		} else if !bytes.Equal(chunk, make([]byte, len(chunk))) {
+			data = make([]byte, sectorSize)
+			copy(data[offset:], chunk)
+			sb.sectors[sector] = data
+		}
+
+		written += len(chunk)
+		sb.size += int64(len(chunk))
+	}
+	return len(p), nil
+}
+
+func (sb *sparseImageBuffer) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		if off+int64(i) >= sb.size {
+			return i, io.EOF
+		}
+		sector := sb.sectors[(off+int64(i))/int64(sectorSize)]
+		if sector == nil {
+			p[i] = 0
+		} else {
+			p[i] = sector[(off+int64(i))%int64(sectorSize)]
+		}
+	}
+	return len(p), nil
+}
+
+func TestWriterMultiExtent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes more than 4GB of image data")
+	}
+
+	// a sparse file with some data at both ends
+	size := int64(math.MaxUint32) + 5000
+	dir := t.TempDir()
+	local, err := os.Create(path.Join(dir, "disk.qcow2"))
+	assert.NoError(t, err)
+	assert.NoError(t, local.Truncate(size))
+	_, err = local.WriteAt([]byte("head"), 0)
+	assert.NoError(t, err)
+	_, err = local.WriteAt([]byte("tail"), size-4)
+	assert.NoError(t, err)
+	assert.NoError(t, local.Close())
+
+	_, err = NewWriter(WithInterchangeLevel(1))
+	assert.EqualError(t, err, "interchange level 1 is not supported")
+
+	w, err := NewWriter()
+	assert.NoError(t, err)
+	defer w.Cleanup()
+	assert.NoError(t, w.AddLocalFile(path.Join(dir, "disk.qcow2"), "images/disk.qcow2"))
+	assert.ErrorContains(t, w.WriteTo(io.Discard, "toolarge"), ErrFileTooLarge.Error())
+
+	w, err = NewWriter(WithInterchangeLevel(3), WithJoliet(), WithRockRidge())
+	assert.NoError(t, err)
+	defer w.Cleanup()
+	assert.NoError(t, w.AddLocalFile(path.Join(dir, "disk.qcow2"), "images/disk.qcow2"))
+	assert.NoError(t, w.AddFile(strings.NewReader(loremIpsum), "images/readme.txt"))
+
+	buf := &sparseImageBuffer{sectors: make(map[int64][]byte)}
+	if !assert.NoError(t, w.WriteTo(buf, "multiextent")) {
+		return
+	}
+
+	img, err := OpenImage(buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rootPrimary, err := img.RootDir()
+	assert.NoError(t, err)
+	rootJoliet, err := img.JolietRootDir()
+	assert.NoError(t, err)
+
+	for _, root := range []*File{rootPrimary, rootJoliet} {
+		images, err := root.GetChildren()
+		if !assert.NoError(t, err) || !assert.Len(t, images, 1) {
+			return
+		}
+		children, err := images[0].GetChildren()
+		if !assert.NoError(t, err) || !assert.Len(t, children, 2) {
+			return
+		}
+
+		disk := children[0]
+		assert.Equal(t, "disk.qcow2", disk.Name())
+		assert.Equal(t, size, disk.Size())
+		if assert.Len(t, disk.extents, 1) {
+			assert.Equal(t, uint8(dirFlagMultiExtent), disk.de.FileFlags&dirFlagMultiExtent)
+			assert.Equal(t, uint32(maxExtentLength), disk.de.ExtentLength)
+			assert.Equal(t, uint8(0), disk.extents[0].FileFlags&dirFlagMultiExtent)
+			assert.Equal(t, uint32(size-int64(maxExtentLength)), disk.extents[0].ExtentLength)
+		}
+
+		sr, err := disk.sectionReader()
+		assert.NoError(t, err)
+		data := make([]byte, 4)
+		_, err = sr.ReadAt(data, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "head", string(data))
+		_, err = sr.ReadAt(data, size-4)
+		assert.NoError(t, err)
+		assert.Equal(t, "tail", string(data))
+
+		readme, err := io.ReadAll(children[1].Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, loremIpsum, string(readme))
+	}
+}
@@ -0,0 +1,68 @@
+package iso9660
+
+import (
+	"io"
+)
+
+// An extent recorded in interleaved mode (ECMA-119 6.4.3) is divided into file units of
+// FileUnitSize logical blocks, each of which is followed by a gap of InterleaveGap logical
+// blocks belonging to other files. The data length of the extent does not include the gaps.
+
+// interleavedReaderAt reads the data of an interleaved extent as contiguous data
+type interleavedReaderAt struct {
+	ra       io.ReaderAt
+	location int64 // the offset of the first file unit in the image
+	unit     int64 // the size of a file unit in bytes
+	stride   int64 // the distance between the starts of two file units in bytes
+	length   int64
+}
+
+var _ io.ReaderAt = &interleavedReaderAt{}
+
+// extentReaderAt returns a reader of the data recorded in the extent of a directory record
+func extentReaderAt(ra io.ReaderAt, de *DirectoryEntry) io.ReaderAt {
+	location := int64(de.ExtentLocation) * int64(sectorSize)
+	if de.FileUnitSize == 0 {
+		return io.NewSectionReader(ra, location, int64(de.ExtentLength))
+	}
+
+	unit := int64(de.FileUnitSize) * int64(sectorSize)
+	return &interleavedReaderAt{
+		ra:       ra,
+		location: location,
+		unit:     unit,
+		stride:   unit + int64(de.InterleaveGap)*int64(sectorSize),
+		length:   int64(de.ExtentLength),
+	}
+}
+
+// ReadAt implements io.ReaderAt
+func (ir *interleavedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= ir.length {
+		return 0, io.EOF
+	}
+
+	var err error
+	if remaining := ir.length - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		offsetInUnit := pos % ir.unit
+		chunk := p[n:]
+		if maxChunk := ir.unit - offsetInUnit; int64(len(chunk)) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+
+		read, readErr := ir.ra.ReadAt(chunk, ir.location+pos/ir.unit*ir.stride+offsetInUnit)
+		n += read
+		if readErr != nil && !(readErr == io.EOF && read == len(chunk)) {
+			return n, readErr
+		}
+	}
+
+	return n, err
+}
@@ -49,6 +49,10 @@ const (
 
 var standardIdentifierBytes = [5]byte{'C', 'D', '0', '0', '1'}
 
+// ErrUDFNotSupported is returned when decoding a descriptor of the UDF volume recognition sequence as
+// an ISO9660 volume descriptor.
+//
+// Deprecated: OpenImage skips these descriptors, the UDF file system is read through Image.UDFRootDir.
 var ErrUDFNotSupported = errors.New("UDF volumes are not supported")
 
 // volumeDescriptorHeader represents the data in bytes 0-6
@@ -91,13 +95,16 @@ type BootVolumeDescriptorBody struct {
 }
 
 var _ encoding.BinaryUnmarshaler = &BootVolumeDescriptorBody{}
+var _ encoding.BinaryMarshaler = BootVolumeDescriptorBody{}
 
 // PrimaryVolumeDescriptorBody represents the data in bytes 7-2047
 // of a Primary Volume Descriptor as defined in ECMA-119 8.4
 type PrimaryVolumeDescriptorBody struct {
+	VolumeFlags                   byte // only meaningful in Supplementary Volume Descriptors
 	SystemIdentifier              string
 	VolumeIdentifier              string
 	VolumeSpaceSize               int32
+	EscapeSequences               [32]byte // only meaningful in Supplementary Volume Descriptors
 	VolumeSetSize                 int16
 	VolumeSequenceNumber          int16
 	LogicalBlockSize              int16
@@ -240,8 +247,19 @@ func (pvd *PrimaryVolumeDescriptorBody) UnmarshalBinary(data []byte) error {
 
 	var err error
 
-	pvd.SystemIdentifier = strings.TrimRight(string(data[8:40]), " ")
-	pvd.VolumeIdentifier = strings.TrimRight(string(data[40:72]), " ")
+	pvd.VolumeFlags = data[7]
+	copy(pvd.EscapeSequences[:], data[88:120])
+
+	// Joliet volumes record their identifiers in UCS-2
+	unmarshalString := func(b []byte) string {
+		return strings.TrimRight(string(b), " ")
+	}
+	if pvd.IsJoliet() {
+		unmarshalString = unmarshalUCS2String
+	}
+
+	pvd.SystemIdentifier = unmarshalString(data[8:40])
+	pvd.VolumeIdentifier = unmarshalString(data[40:72])
 
 	if pvd.VolumeSpaceSize, err = UnmarshalInt32LSBMSB(data[80:88]); err != nil {
 		return err
@@ -275,13 +293,13 @@ func (pvd *PrimaryVolumeDescriptorBody) UnmarshalBinary(data []byte) error {
 		return err
 	}
 
-	pvd.VolumeSetIdentifier = strings.TrimRight(string(data[190:318]), " ")
-	pvd.PublisherIdentifier = strings.TrimRight(string(data[318:446]), " ")
-	pvd.DataPreparerIdentifier = strings.TrimRight(string(data[446:574]), " ")
-	pvd.ApplicationIdentifier = strings.TrimRight(string(data[574:702]), " ")
-	pvd.CopyrightFileIdentifier = strings.TrimRight(string(data[702:740]), " ")
-	pvd.AbstractFileIdentifier = strings.TrimRight(string(data[740:776]), " ")
-	pvd.BibliographicFileIdentifier = strings.TrimRight(string(data[776:813]), " ")
+	pvd.VolumeSetIdentifier = unmarshalString(data[190:318])
+	pvd.PublisherIdentifier = unmarshalString(data[318:446])
+	pvd.DataPreparerIdentifier = unmarshalString(data[446:574])
+	pvd.ApplicationIdentifier = unmarshalString(data[574:702])
+	pvd.CopyrightFileIdentifier = unmarshalString(data[702:740])
+	pvd.AbstractFileIdentifier = unmarshalString(data[740:776])
+	pvd.BibliographicFileIdentifier = unmarshalString(data[776:813])
 
 	if pvd.VolumeCreationDateAndTime.UnmarshalBinary(data[813:830]) != nil {
 		return err
@@ -309,13 +327,22 @@ func (pvd *PrimaryVolumeDescriptorBody) UnmarshalBinary(data []byte) error {
 func (pvd PrimaryVolumeDescriptorBody) MarshalBinary() ([]byte, error) {
 	output := make([]byte, sectorSize)
 
-	d := MarshalString(pvd.SystemIdentifier, 32)
+	output[7] = pvd.VolumeFlags
+
+	// Joliet volumes record their identifiers in UCS-2
+	marshalString := MarshalString
+	if pvd.IsJoliet() {
+		marshalString = marshalUCS2String
+	}
+
+	d := marshalString(pvd.SystemIdentifier, 32)
 	copy(output[8:40], d)
 
-	d = MarshalString(pvd.VolumeIdentifier, 32)
+	d = marshalString(pvd.VolumeIdentifier, 32)
 	copy(output[40:72], d)
 
 	WriteInt32LSBMSB(output[80:88], pvd.VolumeSpaceSize)
+	copy(output[88:120], pvd.EscapeSequences[:])
 	WriteInt16LSBMSB(output[120:124], pvd.VolumeSetSize)
 	WriteInt16LSBMSB(output[124:128], pvd.VolumeSequenceNumber)
 	WriteInt16LSBMSB(output[128:132], pvd.LogicalBlockSize)
@@ -332,13 +359,13 @@ func (pvd PrimaryVolumeDescriptorBody) MarshalBinary() ([]byte, error) {
 	}
 	copy(output[156:190], binaryRDE)
 
-	copy(output[190:318], MarshalString(pvd.VolumeSetIdentifier, 128))
-	copy(output[318:446], MarshalString(pvd.PublisherIdentifier, 128))
-	copy(output[446:574], MarshalString(pvd.DataPreparerIdentifier, 128))
-	copy(output[574:702], MarshalString(pvd.ApplicationIdentifier, 128))
-	copy(output[702:740], MarshalString(pvd.CopyrightFileIdentifier, 38))
-	copy(output[740:776], MarshalString(pvd.AbstractFileIdentifier, 36))
-	copy(output[776:813], MarshalString(pvd.BibliographicFileIdentifier, 37))
+	copy(output[190:318], marshalString(pvd.VolumeSetIdentifier, 128))
+	copy(output[318:446], marshalString(pvd.PublisherIdentifier, 128))
+	copy(output[446:574], marshalString(pvd.DataPreparerIdentifier, 128))
+	copy(output[574:702], marshalString(pvd.ApplicationIdentifier, 128))
+	copy(output[702:740], marshalString(pvd.CopyrightFileIdentifier, 38))
+	copy(output[740:776], marshalString(pvd.AbstractFileIdentifier, 36))
+	copy(output[776:813], marshalString(pvd.BibliographicFileIdentifier, 37))
 
 	d, err = pvd.VolumeCreationDateAndTime.MarshalBinary()
 	if err != nil {
@@ -384,6 +411,21 @@ func (bvd *BootVolumeDescriptorBody) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// MarshalBinary encodes a BootVolumeDescriptorBody to binary form as defined in ECMA-119 8.2.
+// Unlike other identifiers, the boot identifiers are padded with zeros, as required by El Torito.
+func (bvd BootVolumeDescriptorBody) MarshalBinary() ([]byte, error) {
+	output := make([]byte, sectorSize)
+	if len(bvd.BootSystemIdentifier) > 32 || len(bvd.BootIdentifier) > 32 {
+		return nil, fmt.Errorf("BootVolumeDescriptorBody.MarshalBinary: identifier too long")
+	}
+
+	copy(output[7:39], bvd.BootSystemIdentifier)
+	copy(output[39:71], bvd.BootIdentifier)
+	copy(output[71:2048], bvd.BootSystemUse[:])
+
+	return output, nil
+}
+
 type volumeDescriptor struct {
 	Header  volumeDescriptorHeader
 	Boot    *BootVolumeDescriptorBody
@@ -439,7 +481,9 @@ func (vd volumeDescriptor) MarshalBinary() ([]byte, error) {
 
 	switch vd.Header.Type {
 	case volumeTypeBoot:
-		return nil, errors.New("boot volumes are not yet supported")
+		if output, err = vd.Boot.MarshalBinary(); err != nil {
+			return nil, err
+		}
 	case volumeTypePartition:
 		return nil, errors.New("partition volumes are not yet supported")
 	case volumeTypePrimary, volumeTypeSupplementary:
@@ -559,7 +603,7 @@ func (ts *RecordingTimestamp) UnmarshalBinary(data []byte) error {
 	hour := int(data[3])
 	min := int(data[4])
 	sec := int(data[5])
-	tzOffset := int(data[6])
+	tzOffset := int(int8(data[6])) // a signed number of 15 minute intervals
 	secondsInAQuarter := 60 * 15
 
 	tz := time.FixedZone("", tzOffset*secondsInAQuarter)
@@ -586,6 +630,18 @@ func (ts RecordingTimestamp) MarshalBinary(dst []byte) {
 	dst[6] = byte(offsetInQuarters)
 }
 
+// Time converts the VolumeDescriptorTimestamp to time.Time.
+// A timestamp with all digits set to zero means "not specified" and yields a zero time.Time.
+func (ts VolumeDescriptorTimestamp) Time() time.Time {
+	if ts == (VolumeDescriptorTimestamp{}) {
+		return time.Time{}
+	}
+
+	secondsInAQuarter := 60 * 15
+	tz := time.FixedZone("", int(int8(ts.Offset))*secondsInAQuarter)
+	return time.Date(ts.Year, time.Month(ts.Month), ts.Day, ts.Hour, ts.Minute, ts.Second, ts.Hundredth*10000000, tz)
+}
+
 // VolumeDescriptorTimestampFromTime converts time.Time to VolumeDescriptorTimestamp
 func VolumeDescriptorTimestampFromTime(t time.Time) VolumeDescriptorTimestamp {
 	t = t.UTC()
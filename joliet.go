@@ -0,0 +1,162 @@
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Joliet Specification
+// http://littlesvr.ca/isomaster/resources/JolietSpecification.html
+
+// Escape sequences identifying the Joliet UCS-2 levels in the
+// Escape Sequences field of a Supplementary Volume Descriptor
+var (
+	jolietLevel1Escape = []byte{'%', '/', '@'}
+	jolietLevel2Escape = []byte{'%', '/', 'C'}
+	jolietLevel3Escape = []byte{'%', '/', 'E'}
+)
+
+// jolietLevel returns the UCS-2 level announced in the escape sequences
+// of a Supplementary Volume Descriptor or 0 if the volume is not Joliet.
+func jolietLevel(escapeSequences [32]byte) int {
+	for level, seq := range [][]byte{jolietLevel1Escape, jolietLevel2Escape, jolietLevel3Escape} {
+		if bytes.HasPrefix(escapeSequences[:], seq) {
+			return level + 1
+		}
+	}
+
+	return 0
+}
+
+// IsJoliet returns true if the volume descriptor body announces Joliet
+// UCS-2 identifiers through its escape sequences.
+func (pvd *PrimaryVolumeDescriptorBody) IsJoliet() bool {
+	return jolietLevel(pvd.EscapeSequences) != 0
+}
+
+// decodeUCS2 converts a big-endian UCS-2 (or UTF-16) string to UTF-8.
+// A trailing odd byte is ignored.
+func decodeUCS2(s string) string {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16([]byte(s[2*i : 2*i+2]))
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// jolietName decodes the identifier of a Joliet directory record,
+// dropping the version number of files.
+func jolietName(identifier string, isDir bool) string {
+	// the "." and ".." entries are single bytes, just like in the primary volume
+	if len(identifier) == 1 {
+		return identifier
+	}
+
+	name := decodeUCS2(identifier)
+	if !isDir {
+		if i := strings.LastIndex(name, ";"); i >= 0 {
+			name = name[:i]
+		}
+	}
+
+	return name
+}
+
+// encodeUCS2 converts a UTF-8 string to big-endian UTF-16,
+// which is what Joliet implementations expect in practice.
+func encodeUCS2(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	output := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.BigEndian.PutUint16(output[2*i:], u)
+	}
+
+	return output
+}
+
+// marshalUCS2String is the UCS-2 counterpart of MarshalString.
+// Odd lengths are padded with a single zero byte.
+func marshalUCS2String(s string, padToLength int) []byte {
+	encoded := encodeUCS2(s)
+	if len(encoded) > padToLength {
+		encoded = encoded[:padToLength&^1]
+	}
+
+	output := make([]byte, padToLength)
+	copy(output, encoded)
+	for i := len(encoded); i+1 < padToLength; i += 2 {
+		output[i] = 0
+		output[i+1] = ' '
+	}
+
+	return output
+}
+
+func unmarshalUCS2String(data []byte) string {
+	return strings.TrimRight(decodeUCS2(string(data)), " ")
+}
+
+// jolietIdentifier converts a file name into a Joliet identifier (before UCS-2 encoding).
+// Characters forbidden by the Joliet specification are replaced with underscores,
+// the name is truncated to 64 characters and files receive a version suffix.
+func jolietIdentifier(name string, isDir bool) string {
+	identifier := truncateUTF16(sanitizeJolietName(name), jolietIdentifierMaxLength)
+	if isDir {
+		return identifier
+	}
+
+	return identifier + ";1"
+}
+
+// uniqueJolietIdentifier is the n-th alternative to the Joliet identifier of a file name, which is used
+// when the identifier is already taken in its directory. It inserts "~n" before the extension of files
+// and shortens the rest of the name so that it still fits into 64 characters.
+func uniqueJolietIdentifier(name string, isDir bool, n int) string {
+	base, extension := sanitizeJolietName(name), ""
+	if dot := strings.LastIndex(base, "."); !isDir && dot > 0 {
+		base, extension = base[:dot], base[dot:]
+	}
+
+	suffix := fmt.Sprintf("~%d", n)
+	remaining := jolietIdentifierMaxLength - utf16Length(suffix) - utf16Length(extension)
+	if remaining < 1 {
+		// the extension is too long to be kept apart from the rest of the name
+		remaining, base, extension = jolietIdentifierMaxLength-utf16Length(suffix), base+extension, ""
+	}
+	identifier := truncateUTF16(base, remaining) + suffix + extension
+	if isDir {
+		return identifier
+	}
+
+	return identifier + ";1"
+}
+
+// sanitizeJolietName replaces the characters forbidden by the Joliet specification with underscores
+func sanitizeJolietName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune("*/:;?\\", r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// truncateUTF16 truncates a string to at most the given number of UTF-16 code units
+// without splitting surrogate pairs
+func truncateUTF16(s string, maxUnits int) string {
+	units := 0
+	for i, r := range s {
+		if units += len(utf16.Encode([]rune{r})); units > maxUnits {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func utf16Length(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,147 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJolietLevel(t *testing.T) {
+	var escapes [32]byte
+	assert.Equal(t, 0, jolietLevel(escapes))
+
+	copy(escapes[:], "%/@")
+	assert.Equal(t, 1, jolietLevel(escapes))
+	copy(escapes[:], "%/C")
+	assert.Equal(t, 2, jolietLevel(escapes))
+	copy(escapes[:], "%/E")
+	assert.Equal(t, 3, jolietLevel(escapes))
+}
+
+func TestJolietName(t *testing.T) {
+	assert.Equal(t, "\x00", jolietName("\x00", true))
+	assert.Equal(t, "Long File Name.tar.gz", jolietName(string(append([]byte{0, 'L', 0, 'o', 0, 'n', 0, 'g', 0, ' '}, []byte("\x00F\x00i\x00l\x00e\x00 \x00N\x00a\x00m\x00e\x00.\x00t\x00a\x00r\x00.\x00g\x00z\x00;\x001")...)), false))
+	assert.Equal(t, "Zażółć", jolietName("\x00Z\x00a\x01\x7c\x00\xf3\x01\x42\x01\x07", true))
+}
+
+func TestJolietImageReader(t *testing.T) {
+	jolietFileName := "\x00A\x00 \x00v\x00e\x00r\x00y\x00 \x00l\x00o\x00n\x00g\x00 \x00f\x00i\x00l\x00e\x00 \x00n\x00a\x00m\x00e\x00.\x00t\x00x\x00t\x00;\x001"
+
+	isoRoot := &DirectoryEntry{ExtentLocation: 19, ExtentLength: sectorSize, FileFlags: dirFlagDir, VolumeSequenceNumber: 1, Identifier: "\x00"}
+	jolietRoot := &DirectoryEntry{ExtentLocation: 20, ExtentLength: sectorSize, FileFlags: dirFlagDir, VolumeSequenceNumber: 1, Identifier: "\x00"}
+	isoFile := &DirectoryEntry{ExtentLocation: 21, ExtentLength: uint32(len(loremIpsum)), VolumeSequenceNumber: 1, Identifier: "A_VERY_L.TXT;1"}
+	jolietFile := isoFile.Clone()
+	jolietFile.Identifier = jolietFileName
+
+	svd := volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypeSupplementary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: 22, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: jolietRoot},
+	}
+	copy(svd.Primary.EscapeSequences[:], jolietLevel3Escape)
+
+	var image bytes.Buffer
+	image.Write(make([]byte, systemAreaSize))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: 22, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: isoRoot},
+	}))
+	image.Write(marshalVolumeDescriptor(t, svd))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	image.Write(marshalDirectory(t, isoRoot, isoRoot, isoFile))
+	image.Write(marshalDirectory(t, jolietRoot, jolietRoot, &jolietFile))
+	data := make([]byte, sectorSize)
+	copy(data, loremIpsum)
+	image.Write(data)
+
+	img, err := OpenImage(bytes.NewReader(image.Bytes()))
+	assert.NoError(t, err)
+
+	root, err := img.RootDir()
+	assert.NoError(t, err)
+	children, err := root.GetChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, children, 1) {
+		assert.Equal(t, "A_VERY_L.TXT", children[0].Name())
+	}
+
+	jroot, err := img.JolietRootDir()
+	assert.NoError(t, err)
+	children, err = jroot.GetChildren()
+	assert.NoError(t, err)
+	if assert.Len(t, children, 1) {
+		assert.Equal(t, "A very long file name.txt", children[0].Name())
+		content, err := io.ReadAll(children[0].Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, loremIpsum, string(content))
+	}
+}
+
+func TestJolietRootDirMissing(t *testing.T) {
+	img := Image{volumeDescriptors: []volumeDescriptor{}}
+	_, err := img.JolietRootDir()
+	assert.Error(t, err)
+}
+
+func TestJolietIdentifier(t *testing.T) {
+	assert.Equal(t, "dir", jolietIdentifier("dir", true))
+	assert.Equal(t, "a_b_c.txt;1", jolietIdentifier("a*b:c.txt", false))
+	assert.Equal(t, strings.Repeat("ł", 64)+";1", jolietIdentifier(strings.Repeat("ł", 70), false))
+
+	assert.Equal(t, "dir.d~1", uniqueJolietIdentifier("dir.d", true, 1))
+	assert.Equal(t, "a_b~2.txt;1", uniqueJolietIdentifier("a?b.txt", false, 2))
+	assert.Equal(t, strings.Repeat("ł", 57)+"~12.txt;1", uniqueJolietIdentifier(strings.Repeat("ł", 70)+".txt", false, 12))
+	assert.Equal(t, "x."+strings.Repeat("y", 60)+"~1;1", uniqueJolietIdentifier("x."+strings.Repeat("y", 70), false, 1))
+}
+
+func TestWriterJolietCollisions(t *testing.T) {
+	w, err := NewWriter(WithJoliet())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	// the first two names only differ in characters forbidden by Joliet, the last one takes the first alternative
+	files := map[string]string{"x*y.txt": "1", "x?y.txt": "2", "x_y~1.txt": "3"}
+	for name, content := range files {
+		assert.NoError(t, w.AddFile(strings.NewReader(content), name))
+	}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "collisions")) {
+		return
+	}
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	root, err := img.JolietRootDir()
+	if !assert.NoError(t, err) {
+		return
+	}
+	children, err := root.GetChildren()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	contents := map[string]string{}
+	for _, c := range children {
+		data, err := io.ReadAll(c.Reader())
+		assert.NoError(t, err)
+		contents[c.Name()] = string(data)
+	}
+	assert.Equal(t, map[string]string{
+		"x_y.txt":   files["x*y.txt"],
+		"x_y~1.txt": files["x_y~1.txt"],
+		"x_y~2.txt": files["x?y.txt"],
+	}, contents)
+}
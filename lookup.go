@@ -0,0 +1,241 @@
+package iso9660
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Lookup returns the file or directory found under the given slash-separated path in the primary volume.
+// Each component of the path matches a file by its Rock Ridge name or by its ISO9660 name with or without
+// the version suffix, e.g. "readme.txt", "README.TXT;1" or "README.TXT". Names are compared regardless of
+// case if the image was opened WithCaseInsensitiveLookup. Errors for missing files wrap fs.ErrNotExist.
+//
+// The directories along the path are resolved through the path table, so that only the extent of the
+// directory containing the file has to be read. Directories missing from the path table, such as those
+// named by their Rock Ridge names or relocated ones, are found by walking the directory tree instead.
+// As the path table lists directories relocated by Rock Ridge under the relocation directory, paths
+// through it such as "rr_moved/deep" resolve, although GetChildren hides the directories it holds.
+func (i *Image) Lookup(name string) (*File, error) {
+	return i.lookup("lookup", name)
+}
+
+// Stat returns the file or directory found under the given path, which is resolved like with Lookup
+func (i *Image) Stat(name string) (*File, error) {
+	return i.lookup("stat", name)
+}
+
+// Open opens the file or directory found under the given path, which is resolved like with Lookup,
+// so that Image implements fs.FS. As required by fs.FS, paths which are not fs.ValidPath, such as those
+// starting with a slash, are rejected with fs.ErrInvalid. The returned fs.File of a regular file also
+// implements io.Seeker and io.ReaderAt, the one of a directory implements fs.ReadDirFile.
+func (i *Image) Open(name string) (fs.File, error) {
+	return i.FS().Open(name)
+}
+
+func (i *Image) lookup(op, name string) (*File, error) {
+	root, err := i.RootDir()
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	components := splitPath(path.Clean("/" + name))
+	if len(components) == 0 {
+		return root, nil
+	}
+
+	dir, remaining, err := i.lookupPathTable(root, components[:len(components)-1])
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	current := dir
+	for _, component := range append(remaining, components[len(components)-1]) {
+		if !current.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+
+		children, err := current.GetChildren()
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		next := i.findChild(children, component)
+		if next == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		current = next
+	}
+
+	return current, nil
+}
+
+// findChild returns the file matching the given name. Names take precedence over ISO9660 identifiers,
+// so that the names listed by GetChildren always lead to the files they belong to, and exact matches
+// are preferred to those which differ in case when the lookup is case-insensitive.
+func (i *Image) findChild(children []*File, name string) *File {
+	equalities := []func(a, b string) bool{func(a, b string) bool { return a == b }}
+	if i.caseInsensitive {
+		equalities = append(equalities, strings.EqualFold)
+	}
+
+	for _, equal := range equalities {
+		for _, c := range children {
+			if equal(c.Name(), name) {
+				return c
+			}
+		}
+		for _, c := range children {
+			if c.matchesIdentifier(name, equal) {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchesIdentifier returns true if the given name is the ISO9660 identifier of the file
+// or the identifier without the version suffix
+func (f *File) matchesIdentifier(name string, equal func(a, b string) bool) bool {
+	if equal(f.de.Identifier, name) {
+		return true
+	}
+
+	identifier, _, hasVersion := strings.Cut(f.de.Identifier, ";")
+	return hasVersion && equal(identifier, name)
+}
+
+// lookupPathTable resolves as many of the leading directories as possible through the path table.
+// It returns the last directory found along with the components which remain to be resolved.
+func (i *Image) lookupPathTable(root *File, components []string) (*File, []string, error) {
+	records, err := i.readPathTable()
+	if err != nil || len(records) == 0 {
+		// a broken path table is no reason to fail, the directory tree itself has all the information
+		return root, components, nil
+	}
+
+	// findSubdirectory returns the number of the record of the matching subdirectory or 0.
+	// The records of the subdirectories always come after the record of their parent.
+	findSubdirectory := func(parent int, component string, equal func(a, b string) bool) int {
+		for n := parent; n < len(records); n++ {
+			if int(records[n].ParentNumber) == parent && equal(records[n].Identifier, component) {
+				return n + 1
+			}
+		}
+		return 0
+	}
+
+	number, resolved := 1, 0
+	for _, component := range components {
+		found := findSubdirectory(number, component, func(a, b string) bool { return a == b })
+		if found == 0 && i.caseInsensitive {
+			found = findSubdirectory(number, component, strings.EqualFold)
+		}
+		if found == 0 {
+			break
+		}
+
+		number = found
+		resolved++
+	}
+
+	if resolved == 0 {
+		return root, components, nil
+	}
+
+	dir, err := i.pathTableDirectory(&records[number-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return dir, components[resolved:], nil
+}
+
+// readPathTable reads the Type L or, lacking that, the Type M path table of the primary volume
+func (i *Image) readPathTable() ([]pathTableRecord, error) {
+	i.pathTableMutex.Lock()
+	defer i.pathTableMutex.Unlock()
+
+	if i.pathTableRead {
+		return i.pathTable, i.pathTableErr
+	}
+	i.pathTableRead = true
+
+	for _, vd := range i.volumeDescriptors {
+		if vd.Type() != volumeTypePrimary {
+			continue
+		}
+
+		location, order := vd.Primary.TypeLPathTableLoc, binary.ByteOrder(binary.LittleEndian)
+		if location == 0 {
+			location, order = vd.Primary.TypeMPathTableLoc, binary.BigEndian
+		}
+		if location == 0 || vd.Primary.PathTableSize <= 0 || int64(vd.Primary.PathTableSize) > int64(vd.Primary.VolumeSpaceSize)*int64(sectorSize) {
+			i.pathTableErr = fmt.Errorf("the primary volume has no usable path table")
+			return nil, i.pathTableErr
+		}
+
+		data := make([]byte, vd.Primary.PathTableSize)
+		if _, err := i.ra.ReadAt(data, int64(location)*int64(sectorSize)); err != nil {
+			i.pathTableErr = fmt.Errorf("reading path table: %w", err)
+			return nil, i.pathTableErr
+		}
+
+		i.pathTable, i.pathTableErr = unmarshalPathTable(data, order)
+		return i.pathTable, i.pathTableErr
+	}
+
+	i.pathTableErr = fmt.Errorf("the image has no primary volume")
+	return nil, i.pathTableErr
+}
+
+// pathTableDirectory creates the File of a directory from its path table record without reading its extent.
+// The length of the extent is taken from the "." record once the directory's children are read.
+func (i *Image) pathTableDirectory(record *pathTableRecord) (*File, error) {
+	susp, err := i.rootSUSPMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	de := &DirectoryEntry{
+		ExtendedAtributeRecordLength: record.ExtendedAttributeRecordLength,
+		ExtentLocation:               int32(record.ExtentLocation),
+		ExtentLength:                 sectorSize,
+		FileFlags:                    dirFlagDir,
+		Identifier:                   record.Identifier,
+	}
+	return &File{ra: i.ra, de: de, susp: susp, lengthFromDot: true}, nil
+}
+
+// rootSUSPMetadata reads the SUSP metadata from the "." record of the root directory of the primary volume
+func (i *Image) rootSUSPMetadata() (*SUSPMetadata, error) {
+	i.pathTableMutex.Lock()
+	defer i.pathTableMutex.Unlock()
+
+	if i.rootSUSPRead {
+		return i.rootSUSP, i.rootSUSPErr
+	}
+	i.rootSUSPRead = true
+
+	root, err := i.RootDir()
+	if err != nil {
+		i.rootSUSPErr = err
+		return nil, err
+	}
+
+	buffer := make([]byte, sectorSize)
+	if _, err := i.ra.ReadAt(buffer, int64(root.de.ExtentLocation)*int64(sectorSize)); err != nil {
+		i.rootSUSPErr = fmt.Errorf("reading root directory: %w", err)
+		return nil, i.rootSUSPErr
+	}
+
+	dot := &DirectoryEntry{}
+	if err := dot.UnmarshalBinary(buffer); err != nil {
+		i.rootSUSPErr = fmt.Errorf("reading root directory: %w", err)
+		return nil, i.rootSUSPErr
+	}
+	i.rootSUSP, i.rootSUSPErr = rootSUSPMetadata(dot, i.ra)
+	return i.rootSUSP, i.rootSUSPErr
+}
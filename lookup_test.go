@@ -0,0 +1,280 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sectorRecorder remembers which sectors of an image have been read
+type sectorRecorder struct {
+	ra io.ReaderAt
+
+	mu      sync.Mutex
+	sectors map[int64]bool
+}
+
+func (sr *sectorRecorder) ReadAt(p []byte, off int64) (int, error) {
+	sr.mu.Lock()
+	for sector := off / int64(sectorSize); sector*int64(sectorSize) < off+int64(len(p)); sector++ {
+		sr.sectors[sector] = true
+	}
+	sr.mu.Unlock()
+	return sr.ra.ReadAt(p, off)
+}
+
+func (sr *sectorRecorder) reset() {
+	sr.mu.Lock()
+	sr.sectors = make(map[int64]bool)
+	sr.mu.Unlock()
+}
+
+func writeLookupImage(t *testing.T, opts ...WriterOption) []byte {
+	w, err := NewWriter(opts...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	for _, p := range []string{"b/x/deep/file.txt", "a/file.txt", "a/c/file.txt", "Long Directory Name/f.txt", "top.txt"} {
+		assert.NoError(t, w.AddFile(strings.NewReader(p), p))
+	}
+	// a directory whose records span several sectors
+	for i := 0; i < 100; i++ {
+		p := fmt.Sprintf("many/file%03d.txt", i)
+		assert.NoError(t, w.AddFile(strings.NewReader(p), p))
+	}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "lookup")) {
+		t.FailNow()
+	}
+	return buf.Bytes()
+}
+
+func TestImageLookup(t *testing.T) {
+	recorder := &sectorRecorder{ra: bytes.NewReader(writeLookupImage(t, WithRockRidge()))}
+	recorder.reset()
+	img, err := OpenImage(recorder)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the directories along the path must not be read
+	intermediate, err := img.Lookup("b/x")
+	if !assert.NoError(t, err) {
+		return
+	}
+	parent, err := img.Lookup("b")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, intermediate.IsDir())
+	assert.Equal(t, "x", intermediate.Name())
+
+	recorder.reset()
+	f, err := img.Lookup("b/x/deep/file.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "file.txt", f.Name())
+	data, err := io.ReadAll(f.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, "b/x/deep/file.txt", string(data))
+
+	assert.False(t, recorder.sectors[int64(parent.de.ExtentLocation)], "read the extent of b")
+	assert.False(t, recorder.sectors[int64(intermediate.de.ExtentLocation)], "read the extent of b/x")
+
+	// once the path table has been read, only the extent of the final directory is
+	c, err := img.Lookup("a/c")
+	if !assert.NoError(t, err) {
+		return
+	}
+	recorder.reset()
+	_, err = img.Lookup("a/c/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]bool{int64(c.de.ExtentLocation): true}, recorder.sectors)
+
+	many, err := img.Lookup("many")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Greater(t, many.de.ExtentLength, sectorSize)
+	f, err = img.Lookup("many/file099.txt")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file099.txt", f.Name())
+	}
+
+	for _, tc := range []struct {
+		path     string
+		expected string
+	}{
+		{path: "", expected: "\x00"},
+		{path: "/", expected: "\x00"},
+		{path: "top.txt", expected: "top.txt;1"},
+		{path: "top.txt;1", expected: "top.txt;1"},
+		{path: "/a/c/file.txt", expected: "file.txt;1"},
+		{path: "a/c", expected: "c"},
+		// the Rock Ridge name is not in the path table
+		{path: "Long Directory Name/f.txt", expected: "f.txt;1"},
+		{path: "long_directory_name/f.txt", expected: "f.txt;1"},
+	} {
+		f, err := img.Lookup(tc.path)
+		if assert.NoError(t, err, tc.path) {
+			assert.Equal(t, tc.expected, f.de.Identifier, tc.path)
+		}
+	}
+
+	for _, path := range []string{"missing", "a/missing", "top.txt/file.txt", "b/x/deep/missing"} {
+		_, err := img.Lookup(path)
+		assert.ErrorIs(t, err, fs.ErrNotExist, path)
+	}
+}
+
+func TestImageLookupWithoutPathTable(t *testing.T) {
+	image := writeLookupImage(t)
+
+	// clear the locations of the path tables in the primary volume descriptor
+	copy(image[16*sectorSize+140:16*sectorSize+156], make([]byte, 16))
+
+	img, err := OpenImage(bytes.NewReader(image))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f, err := img.Lookup("b/x/deep/file.txt")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file.txt", f.Name())
+	}
+	_, err = img.Lookup("b/x/file.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestImageStatAndOpen(t *testing.T) {
+	image := writeLookupImage(t, WithRockRidge())
+
+	for _, caseInsensitive := range []bool{false, true} {
+		var opts []ImageOption
+		if caseInsensitive {
+			opts = append(opts, WithCaseInsensitiveLookup())
+		}
+		img, err := OpenImage(bytes.NewReader(image), opts...)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		for _, tc := range []struct {
+			path        string
+			expected    string
+			foldingOnly bool
+		}{
+			{path: "Long Directory Name/f.txt", expected: "f.txt"},
+			{path: "long_directory_name/f.txt;1", expected: "f.txt"},
+			{path: "long_directory_name/f.txt", expected: "f.txt"},
+			{path: "a/./c/../c/file.txt", expected: "file.txt"},
+			{path: "/b/x/deep", expected: "deep"},
+			{path: "LONG DIRECTORY NAME/F.TXT", expected: "f.txt", foldingOnly: true},
+			{path: "LONG_DIRECTORY_NAME/F.TXT;1", expected: "f.txt", foldingOnly: true},
+			{path: "B/X/Deep/FILE.txt", expected: "file.txt", foldingOnly: true},
+		} {
+			f, err := img.Stat(tc.path)
+			if tc.foldingOnly && !caseInsensitive {
+				assert.ErrorIs(t, err, fs.ErrNotExist, tc.path)
+				continue
+			}
+			if assert.NoError(t, err, tc.path) {
+				assert.Equal(t, tc.expected, f.Name(), tc.path)
+			}
+		}
+
+		_, err = img.Stat("a/file.txt/more")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		var pathErr *fs.PathError
+		if assert.ErrorAs(t, err, &pathErr) {
+			assert.Equal(t, "stat", pathErr.Op)
+			assert.Equal(t, "a/file.txt/more", pathErr.Path)
+		}
+	}
+
+	img, err := OpenImage(bytes.NewReader(image))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f, err := img.Open("a/c/FILE.TXT;1")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Nil(t, f)
+
+	f, err = img.Open("a/c/file.txt;1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	rs, ok := f.(io.ReadSeeker)
+	if assert.True(t, ok) {
+		_, err = rs.Seek(2, io.SeekStart)
+		assert.NoError(t, err)
+		data, err := io.ReadAll(rs)
+		assert.NoError(t, err)
+		assert.Equal(t, "c/file.txt", string(data))
+	}
+
+	dir, err := img.Open(".")
+	if !assert.NoError(t, err) {
+		return
+	}
+	info, err := dir.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, ".", info.Name())
+	entries, err := dir.(fs.ReadDirFile).ReadDir(-1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+}
+
+func TestImageFSContract(t *testing.T) {
+	for _, opts := range [][]WriterOption{nil, {WithRockRidge()}} {
+		img, err := OpenImage(bytes.NewReader(writeLookupImage(t, opts...)))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var expected []string
+		if err := fs.WalkDir(img.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				expected = append(expected, path)
+			}
+			return err
+		}); !assert.NoError(t, err) {
+			return
+		}
+		assert.Len(t, expected, 105)
+		assert.NoError(t, fstest.TestFS(img, expected...))
+
+		for _, name := range []string{"/a", "../a", "a//c", "a/./c", "a/"} {
+			_, err := img.Open(name)
+			assert.ErrorIs(t, err, fs.ErrInvalid, name)
+			_, err = img.FS().Open(name)
+			assert.ErrorIs(t, err, fs.ErrInvalid, name)
+		}
+
+		// Image and its FS resolve names alike
+		f, err := img.FS().Open("top.txt;1")
+		if assert.NoError(t, err) {
+			assert.NoError(t, f.Close())
+		}
+	}
+}
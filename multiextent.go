@@ -0,0 +1,71 @@
+package iso9660
+
+import (
+	"io"
+	"sort"
+)
+
+// fileSection is an extent of a multi-extent file along with its offset within the file
+type fileSection struct {
+	offset int64
+	length int64
+	ra     io.ReaderAt // reads the data of the extent starting at 0
+}
+
+// multiExtentReaderAt reads the extents of a multi-extent file (ECMA-119 6.5.1)
+// as one contiguous file
+type multiExtentReaderAt struct {
+	sections []fileSection
+	size     int64
+}
+
+var _ io.ReaderAt = &multiExtentReaderAt{}
+
+func newMultiExtentReaderAt(ra io.ReaderAt, records []*DirectoryEntry) *multiExtentReaderAt {
+	mr := &multiExtentReaderAt{}
+	for _, de := range records {
+		mr.sections = append(mr.sections, fileSection{
+			offset: mr.size,
+			length: int64(de.ExtentLength),
+			ra:     extentReaderAt(ra, de),
+		})
+		mr.size += int64(de.ExtentLength)
+	}
+	return mr
+}
+
+// ReadAt implements io.ReaderAt
+func (mr *multiExtentReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= mr.size {
+		return 0, io.EOF
+	}
+
+	var err error
+	if remaining := mr.size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+
+	// the first section ending after the offset
+	i := sort.Search(len(mr.sections), func(i int) bool {
+		return mr.sections[i].offset+mr.sections[i].length > off
+	})
+
+	n := 0
+	for ; n < len(p) && i < len(mr.sections); i++ {
+		section := mr.sections[i]
+		offsetInSection := off + int64(n) - section.offset
+		chunk := p[n:]
+		if maxChunk := section.length - offsetInSection; int64(len(chunk)) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+
+		read, readErr := section.ra.ReadAt(chunk, offsetInSection)
+		n += read
+		if readErr != nil && !(readErr == io.EOF && read == len(chunk)) {
+			return n, readErr
+		}
+	}
+
+	return n, err
+}
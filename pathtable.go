@@ -0,0 +1,180 @@
+package iso9660
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"path"
+)
+
+// pathTableRecord describes a directory in the path table, see ECMA-119 9.4
+type pathTableRecord struct {
+	Identifier                    string
+	ExtendedAttributeRecordLength byte
+	ExtentLocation                uint32
+	ParentNumber                  uint16 // the number of the parent's record, counting from 1
+
+	dirPath string // the staged directory the record is written for
+}
+
+// length returns the length of the record including the padding field
+func (ptr *pathTableRecord) length() uint32 {
+	return uint32(8 + len(ptr.Identifier) + len(ptr.Identifier)%2)
+}
+
+// marshal encodes the record with numerical values in the given byte order,
+// which is little-endian for the Type L path table and big-endian for the Type M one
+func (ptr *pathTableRecord) marshal(order binary.ByteOrder) []byte {
+	data := make([]byte, ptr.length())
+	data[0] = byte(len(ptr.Identifier))
+	data[1] = ptr.ExtendedAttributeRecordLength
+	order.PutUint32(data[2:6], ptr.ExtentLocation)
+	order.PutUint16(data[6:8], ptr.ParentNumber)
+	copy(data[8:], ptr.Identifier)
+	return data
+}
+
+// marshalPathTable encodes the records of a path table in the given byte order
+func marshalPathTable(records []pathTableRecord, order binary.ByteOrder) []byte {
+	var data []byte
+	for i := range records {
+		data = append(data, records[i].marshal(order)...)
+	}
+	return data
+}
+
+// unmarshalPathTable decodes the records of a path table with numerical values in the given byte order
+func unmarshalPathTable(data []byte, order binary.ByteOrder) ([]pathTableRecord, error) {
+	var records []pathTableRecord
+	for len(data) > 0 {
+		identifierLen := int(data[0])
+		if identifierLen == 0 || len(data) < 8+identifierLen {
+			return nil, fmt.Errorf("invalid path table record %d", len(records)+1)
+		}
+
+		record := pathTableRecord{
+			Identifier:                    string(data[8 : 8+identifierLen]),
+			ExtendedAttributeRecordLength: data[1],
+			ExtentLocation:                order.Uint32(data[2:6]),
+			ParentNumber:                  order.Uint16(data[6:8]),
+		}
+		if record.ParentNumber == 0 || int(record.ParentNumber) > len(records)+1 {
+			return nil, fmt.Errorf("path table record %d refers to the unknown parent %d", len(records)+1, record.ParentNumber)
+		}
+		records = append(records, record)
+
+		recordLen := 8 + identifierLen + identifierLen%2
+		if recordLen > len(data) {
+			// the path table size doesn't necessarily include the padding of the last record
+			recordLen = len(data)
+		}
+		data = data[recordLen:]
+	}
+	return records, nil
+}
+
+// pathTableLayout holds the records of the path tables of a directory tree along with their locations
+type pathTableLayout struct {
+	joliet  bool
+	records []pathTableRecord
+	size    uint32
+
+	typeL, optTypeL, typeM, optTypeM uint32
+}
+
+// layoutPathTable lists the staged directories in the order of ECMA-119 9.4.3: by their level in the
+// hierarchy, then by the numbers of their parents and then by their identifiers. A breadth-first walk
+// yields exactly this order, as the directories of every level are visited in the order they are numbered.
+// The tables, optionally along with their redundant copies, are allocated right away.
+func (wc *writeContext) layoutPathTable(joliet, copies bool) (*pathTableLayout, error) {
+	ptl := &pathTableLayout{
+		joliet:  joliet,
+		records: []pathTableRecord{{Identifier: "\x00", ParentNumber: 1, dirPath: wc.stagingDir}},
+	}
+
+	for parent := 0; parent < len(ptl.records); parent++ {
+		contents, err := wc.readStagedDir(ptl.records[parent].dirPath, joliet)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range contents {
+			if !c.IsDir() {
+				continue
+			}
+			if len(ptl.records) == 0xFFFF {
+				return nil, fmt.Errorf("the image has more than %d directories, which cannot be numbered in the path table", 0xFFFF)
+			}
+
+			ptl.records = append(ptl.records, pathTableRecord{
+				Identifier:   c.identifier,
+				ParentNumber: uint16(parent + 1),
+				dirPath:      path.Join(ptl.records[parent].dirPath, c.Name()),
+			})
+		}
+	}
+
+	for i := range ptl.records {
+		ptl.size += ptl.records[i].length()
+	}
+
+	sectors := fileLengthToSectors(ptl.size)
+	ptl.typeL = wc.allocateSectors(sectors)
+	if copies {
+		ptl.optTypeL = wc.allocateSectors(sectors)
+	}
+	ptl.typeM = wc.allocateSectors(sectors)
+	if copies {
+		ptl.optTypeM = wc.allocateSectors(sectors)
+	}
+
+	return ptl, nil
+}
+
+// setLocations fills in the extent locations of the directories once they are placed
+func (ptl *pathTableLayout) setLocations(itemsToWrite *list.List) {
+	locations := make(map[string]uint32)
+	for item := itemsToWrite.Front(); item != nil; item = item.Next() {
+		if it := item.Value.(itemToWrite); it.isDirectory && it.joliet == ptl.joliet {
+			locations[it.dirPath] = uint32(it.ownEntry.ExtentLocation)
+		}
+	}
+
+	for i := range ptl.records {
+		ptl.records[i].ExtentLocation = locations[ptl.records[i].dirPath]
+	}
+}
+
+// tables returns the path tables padded to whole sectors in the order they were allocated in
+func (ptl *pathTableLayout) tables() [][]byte {
+	typeL := make([]byte, fileLengthToSectors(ptl.size)*sectorSize)
+	copy(typeL, marshalPathTable(ptl.records, binary.LittleEndian))
+	typeM := make([]byte, fileLengthToSectors(ptl.size)*sectorSize)
+	copy(typeM, marshalPathTable(ptl.records, binary.BigEndian))
+
+	tables := [][]byte{typeL}
+	if ptl.optTypeL != 0 {
+		tables = append(tables, typeL)
+	}
+	tables = append(tables, typeM)
+	if ptl.optTypeM != 0 {
+		tables = append(tables, typeM)
+	}
+	return tables
+}
+
+// setVolumeDescriptorFields records the size and the locations of the path tables in a volume descriptor
+func (ptl *pathTableLayout) setVolumeDescriptorFields(pvd *PrimaryVolumeDescriptorBody) {
+	pvd.PathTableSize = int32(ptl.size)
+	pvd.TypeLPathTableLoc = int32(ptl.typeL)
+	pvd.OptTypeLPathTableLoc = int32(ptl.optTypeL)
+	pvd.TypeMPathTableLoc = int32(ptl.typeM)
+	pvd.OptTypeMPathTableLoc = int32(ptl.optTypeM)
+}
+
+// WithPathTableCopies makes the ImageWriter record the optional copies of the Type L and Type M path tables
+func WithPathTableCopies() WriterOption {
+	return func(iw *ImageWriter) {
+		iw.pathTableCopies = true
+	}
+}
@@ -0,0 +1,139 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parsePathTable decodes the path table of the given size at the given sector
+func parsePathTable(t *testing.T, image []byte, location int32, size int32, order binary.ByteOrder) []pathTableRecord {
+	records, err := unmarshalPathTable(image[int64(location)*int64(sectorSize):int64(location)*int64(sectorSize)+int64(size)], order)
+	assert.NoError(t, err)
+	return records
+}
+
+func TestWriterPathTables(t *testing.T) {
+	w, err := NewWriter(WithJoliet(), WithPathTableCopies())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	for _, p := range []string{"b/x/deep/file.txt", "a/file.txt", "a/c/file.txt", "Long Directory Name/f.txt", "top.txt"} {
+		assert.NoError(t, w.AddFile(strings.NewReader(p), p))
+	}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "pathtables")) {
+		return
+	}
+	image := buf.Bytes()
+
+	img, err := OpenImage(bytes.NewReader(image))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// ordered by level, then by the number of the parent and then by identifier
+	expected := map[bool][]struct {
+		name   string
+		parent uint16
+	}{
+		false: {{"\x00", 1}, {"a", 1}, {"b", 1}, {"long_directory_name", 1}, {"c", 2}, {"x", 3}, {"deep", 6}},
+		true:  {{"\x00", 1}, {"Long Directory Name", 1}, {"a", 1}, {"b", 1}, {"c", 3}, {"x", 4}, {"deep", 6}},
+	}
+
+	for _, joliet := range []bool{false, true} {
+		vd := img.volumeDescriptors[0].Primary
+		root, err := img.RootDir()
+		if joliet {
+			vd = img.volumeDescriptors[1].Primary
+			root, err = img.JolietRootDir()
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NotZero(t, vd.TypeLPathTableLoc)
+		assert.NotZero(t, vd.OptTypeLPathTableLoc)
+		assert.NotZero(t, vd.TypeMPathTableLoc)
+		assert.NotZero(t, vd.OptTypeMPathTableLoc)
+
+		typeL := parsePathTable(t, image, vd.TypeLPathTableLoc, vd.PathTableSize, binary.LittleEndian)
+		assert.Equal(t, typeL, parsePathTable(t, image, vd.OptTypeLPathTableLoc, vd.PathTableSize, binary.LittleEndian))
+		assert.Equal(t, typeL, parsePathTable(t, image, vd.TypeMPathTableLoc, vd.PathTableSize, binary.BigEndian))
+		assert.Equal(t, typeL, parsePathTable(t, image, vd.OptTypeMPathTableLoc, vd.PathTableSize, binary.BigEndian))
+
+		if !assert.Len(t, typeL, len(expected[joliet])) {
+			continue
+		}
+
+		// the locations match those of the directories found by walking the directory tree
+		locations := map[string]uint32{"\x00": uint32(root.de.ExtentLocation)}
+		var walk func(dir *File)
+		walk = func(dir *File) {
+			children, err := dir.GetChildren()
+			assert.NoError(t, err)
+			for _, c := range children {
+				if c.IsDir() {
+					locations[c.Name()] = uint32(c.de.ExtentLocation)
+					walk(c)
+				}
+			}
+		}
+		walk(root)
+
+		for i, record := range typeL {
+			name := record.Identifier
+			if joliet && name != "\x00" {
+				name = decodeUCS2(name)
+			}
+			assert.Equal(t, expected[joliet][i].name, name)
+			assert.Equal(t, expected[joliet][i].parent, record.ParentNumber)
+			assert.Equal(t, locations[name], record.ExtentLocation, name)
+		}
+	}
+}
+
+func TestWriterPathTablesWithoutCopies(t *testing.T) {
+	w, err := NewWriter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	assert.NoError(t, w.AddFile(strings.NewReader(loremIpsum), "readme.txt"))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "pathtables")) {
+		return
+	}
+
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vd := img.volumeDescriptors[0].Primary
+	assert.Equal(t, int32(10), vd.PathTableSize)
+	assert.Equal(t, int32(18), vd.TypeLPathTableLoc)
+	assert.Equal(t, int32(19), vd.TypeMPathTableLoc)
+	assert.Zero(t, vd.OptTypeLPathTableLoc)
+	assert.Zero(t, vd.OptTypeMPathTableLoc)
+	assert.Equal(t, []pathTableRecord{{Identifier: "\x00", ExtentLocation: 20, ParentNumber: 1}}, parsePathTable(t, buf.Bytes(), vd.TypeLPathTableLoc, vd.PathTableSize, binary.LittleEndian))
+}
@@ -2,27 +2,69 @@ package iso9660
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"strings"
+	"time"
 )
 
 /* The following types of Rock Ridge records are being handled in some way:
  * - [X] PX (RR 4.1.1: POSIX file attributes)
- * - [ ] PN (RR 4.1.2: POSIX device number)
- * - [ ] SL (RR 4.1.3: symbolic link)
+ * - [x] PN (RR 4.1.2: POSIX device number)
+ * - [x] SL (RR 4.1.3: symbolic link)
  * - [x] NM (RR 4.1.4: alternate name)
- * - [ ] CL (RR 4.1.5.1: child link)
- * - [ ] PL (RR 4.1.5.2: parent link)
- * - [ ] RE (RR 4.1.5.3: relocated directory)
- * - [ ] TF (RR 4.1.6: time stamp(s) for a file)
- * - [ ] SF (RR 4.1.7: file data in sparse file format)
+ * - [x] CL (RR 4.1.5.1: child link)
+ * - [x] PL (RR 4.1.5.2: parent link)
+ * - [x] RE (RR 4.1.5.3: relocated directory)
+ * - [x] TF (RR 4.1.6: time stamp(s) for a file)
+ * - [x] SF (RR 4.1.7: file data in sparse file format)
+ * - [x] ZF (file data compressed in the zisofs format, introduced by mkisofs and not part of RRIP)
  */
 
 const (
 	RockRidgeIdentifier = "RRIP_1991A"
 	RockRidgeVersion    = 1
+
+	// the descriptor and source recorded in the ER entry by mkisofs, see RR 4.3
+	rockRidgeDescriptor = "THE ROCK RIDGE INTERCHANGE PROTOCOL PROVIDES SUPPORT FOR POSIX FILE SYSTEM SEMANTICS"
+	rockRidgeSource     = "PLEASE CONTACT DISC PUBLISHER FOR SPECIFICATION SOURCE.  SEE PUBLISHER IDENTIFIER IN PRIMARY VOLUME DESCRIPTOR FOR CONTACT INFORMATION."
+)
+
+// Flags of a Component Record within an SL entry, see RR 4.1.3.1
+const (
+	rrComponentContinue = 1 << iota
+	rrComponentCurrent
+	rrComponentParent
+	rrComponentRoot
+	rrComponentVolumeRoot
+	rrComponentHost
+)
+
+// Flags of a TF entry, see RR 4.1.6
+const (
+	rrTimestampCreation = 1 << iota
+	rrTimestampModify
+	rrTimestampAccess
+	rrTimestampAttributes
+	rrTimestampBackup
+	rrTimestampExpiration
+	rrTimestampEffective
+	rrTimestampLongForm
 )
 
+// RockRidgeTimestamps contains the time stamps recorded in Rock Ridge TF entries.
+// Time stamps which are not recorded are left as zero values.
+type RockRidgeTimestamps struct {
+	Creation        time.Time
+	Modify          time.Time
+	Access          time.Time
+	AttributeChange time.Time
+	Backup          time.Time
+	Expiration      time.Time
+	Effective       time.Time
+}
+
 type RockRidgeNameEntry struct {
 	Flags byte
 	Name  string
@@ -69,26 +111,166 @@ func (s SystemUseEntrySlice) GetPosixAttr() (fs.FileMode, error) {
 	return 0, fmt.Errorf("mandatory entry PX not found")
 }
 
+// POSIX file type and mode bits, as recorded in PX entries
+const (
+	rrModeTypeMask = 0170000
+	rrModeSocket   = 0140000
+	rrModeSymlink  = 0120000
+	rrModeRegular  = 0100000
+	rrModeBlockDev = 0060000
+	rrModeDir      = 0040000
+	rrModeCharDev  = 0020000
+	rrModeFIFO     = 0010000
+	rrModeSetuid   = 04000
+	rrModeSetgid   = 02000
+	rrModeSticky   = 01000
+)
+
+// PosixAttributes contains the POSIX file attributes recorded in Rock Ridge PX and PN entries
+type PosixAttributes struct {
+	Mode   fs.FileMode
+	Links  uint32
+	UID    uint32
+	GID    uint32
+	Serial uint32 // the file serial number is not recorded by older versions of Rock Ridge
+
+	// DeviceMajor and DeviceMinor are only set for block and character devices
+	DeviceMajor uint32
+	DeviceMinor uint32
+}
+
+// GetPosixAttributes decodes the PX entry and, in case of devices, the PN entry
+func (s SystemUseEntrySlice) GetPosixAttributes() (*PosixAttributes, error) {
+	var attrs *PosixAttributes
+	for _, entry := range s {
+		if entry.Type() == "PX" {
+			var err error
+			if attrs, err = umarshalRockRidgePosixEntry(entry); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if attrs == nil {
+		return nil, fmt.Errorf("mandatory entry PX not found")
+	}
+
+	if attrs.Mode&os.ModeDevice == 0 {
+		return attrs, nil
+	}
+
+	for _, entry := range s {
+		if entry.Type() == "PN" {
+			major, minor, err := umarshalRockRidgeDeviceEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+			attrs.DeviceMajor, attrs.DeviceMinor = major, minor
+			break
+		}
+	}
+
+	return attrs, nil
+}
+
 func umarshalRockRidgeAttrEntry(e SystemUseEntry) (fs.FileMode, error) {
+	if len(e.Data()) < 8 {
+		return 0, fmt.Errorf("unmarshall RR PX entry: %w", io.ErrUnexpectedEOF)
+	}
+
 	rrMode, err := UnmarshalUint32LSBMSB(e.Data()[0:8])
 	if err != nil {
 		return 0, fmt.Errorf("unmarshall RR PX entry: %w", err)
 	}
 
-	S_IFLNK := (rrMode & 0170000) == 0120000
-	S_IFDIR := (rrMode & 0170000) == 0040000
+	mode := fs.FileMode(rrMode) & fs.ModePerm // UNIX permissions
+
+	switch rrMode & rrModeTypeMask {
+	case rrModeSocket:
+		mode |= os.ModeSocket
+	case rrModeSymlink:
+		mode |= os.ModeSymlink
+	case rrModeBlockDev:
+		mode |= os.ModeDevice
+	case rrModeDir:
+		mode |= os.ModeDir
+	case rrModeCharDev:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case rrModeFIFO:
+		mode |= os.ModeNamedPipe
+	}
+
+	if rrMode&rrModeSetuid != 0 {
+		mode |= os.ModeSetuid
+	}
+	if rrMode&rrModeSetgid != 0 {
+		mode |= os.ModeSetgid
+	}
+	if rrMode&rrModeSticky != 0 {
+		mode |= os.ModeSticky
+	}
+
+	return mode, nil
+}
+
+func umarshalRockRidgePosixEntry(e SystemUseEntry) (*PosixAttributes, error) {
+	mode, err := umarshalRockRidgeAttrEntry(e)
+	if err != nil {
+		return nil, err
+	}
+
+	data := e.Data()
+	if len(data) < 32 {
+		return nil, fmt.Errorf("unmarshall RR PX entry: %w", io.ErrUnexpectedEOF)
+	}
+
+	attrs := &PosixAttributes{Mode: mode}
+	for _, field := range []struct {
+		dst  *uint32
+		data []byte
+	}{
+		{&attrs.Links, data[8:16]},
+		{&attrs.UID, data[16:24]},
+		{&attrs.GID, data[24:32]},
+	} {
+		if *field.dst, err = UnmarshalUint32LSBMSB(field.data); err != nil {
+			return nil, fmt.Errorf("unmarshall RR PX entry: %w", err)
+		}
+	}
+
+	// RRIP 1.12 added the file serial number
+	if len(data) >= 40 {
+		if attrs.Serial, err = UnmarshalUint32LSBMSB(data[32:40]); err != nil {
+			return nil, fmt.Errorf("unmarshall RR PX entry: %w", err)
+		}
+	}
+
+	return attrs, nil
+}
 
-	mode := rrMode & uint32(fs.ModePerm) // UNIX permissions
+// umarshalRockRidgeDeviceEntry decodes a PN entry into the major and minor device numbers
+func umarshalRockRidgeDeviceEntry(e SystemUseEntry) (uint32, uint32, error) {
+	data := e.Data()
+	if len(data) < 16 {
+		return 0, 0, fmt.Errorf("unmarshall RR PN entry: %w", io.ErrUnexpectedEOF)
+	}
 
-	if S_IFLNK {
-		mode |= uint32(os.ModeSymlink)
+	high, err := UnmarshalUint32LSBMSB(data[0:8])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unmarshall RR PN entry: %w", err)
+	}
+	low, err := UnmarshalUint32LSBMSB(data[8:16])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unmarshall RR PN entry: %w", err)
 	}
 
-	if S_IFDIR {
-		mode |= uint32(os.ModeDir)
+	// Like Linux, treat a lone low word as an old-style 16-bit dev_t.
+	if high == 0 && low&^0xff != 0 {
+		return low >> 8, low & 0xff, nil
 	}
 
-	return fs.FileMode(mode), nil
+	return high, low, nil
 }
 
 func umarshalRockRidgeNameEntry(e SystemUseEntry) *RockRidgeNameEntry {
@@ -97,3 +279,443 @@ func umarshalRockRidgeNameEntry(e SystemUseEntry) *RockRidgeNameEntry {
 		Name:  string(e.Data()[1:]),
 	}
 }
+
+// GetRockRidgeSymlink reassembles the target of a symbolic link from all SL entries.
+// Components may continue across several SL entries, which can in turn
+// be spread over Continuation Areas. It returns false if there are no SL entries.
+func (s SystemUseEntrySlice) GetRockRidgeSymlink() (string, bool, error) {
+	var target strings.Builder
+	found := false
+	needSeparator := false
+
+	for _, entry := range s {
+		if entry.Type() != "SL" {
+			continue
+		}
+		found = true
+
+		data := entry.Data()
+		if len(data) < 1 {
+			return "", true, fmt.Errorf("unmarshal RR SL entry: %w", io.ErrUnexpectedEOF)
+		}
+
+		// The SL entry's own CONTINUE flag is implied by the presence of further SL entries.
+		components := data[1:]
+		for len(components) > 0 {
+			if len(components) < 2 || len(components) < 2+int(components[1]) {
+				return "", true, fmt.Errorf("unmarshal RR SL component record: %w", io.ErrUnexpectedEOF)
+			}
+
+			flags := components[0]
+			content := string(components[2 : 2+int(components[1])])
+			components = components[2+int(components[1]):]
+
+			var part string
+			switch {
+			case flags&rrComponentRoot != 0:
+				target.WriteString("/")
+				needSeparator = false
+				continue
+			case flags&(rrComponentVolumeRoot|rrComponentHost) != 0:
+				// BUG(kdomanski): The deprecated VOLROOT and HOST components of RR symlinks are ignored.
+				continue
+			case flags&rrComponentCurrent != 0:
+				part = "."
+			case flags&rrComponentParent != 0:
+				part = ".."
+			default:
+				part = content
+			}
+
+			if needSeparator {
+				target.WriteString("/")
+			}
+			target.WriteString(part)
+
+			// a continued component is completed by the next record, without a separator
+			needSeparator = flags&rrComponentContinue == 0
+		}
+	}
+
+	return target.String(), found, nil
+}
+
+// GetRockRidgeTimestamps decodes the time stamps of all TF entries,
+// in either the 7-byte form of ECMA-119 9.1.5 or the 17-byte form of ECMA-119 8.4.26.1.
+func (s SystemUseEntrySlice) GetRockRidgeTimestamps() (*RockRidgeTimestamps, error) {
+	var ts *RockRidgeTimestamps
+
+	for _, entry := range s {
+		if entry.Type() != "TF" {
+			continue
+		}
+
+		if ts == nil {
+			ts = &RockRidgeTimestamps{}
+		}
+		if err := umarshalRockRidgeTimestampEntry(entry, ts); err != nil {
+			return nil, err
+		}
+	}
+
+	if ts == nil {
+		return nil, fmt.Errorf("entry TF not found")
+	}
+
+	return ts, nil
+}
+
+func umarshalRockRidgeTimestampEntry(e SystemUseEntry, ts *RockRidgeTimestamps) error {
+	data := e.Data()
+	if len(data) < 1 {
+		return fmt.Errorf("unmarshal RR TF entry: %w", io.ErrUnexpectedEOF)
+	}
+
+	flags := data[0]
+	data = data[1:]
+
+	timestampLen := 7
+	if flags&rrTimestampLongForm != 0 {
+		timestampLen = 17
+	}
+
+	// the time stamps are recorded in the order of their flags
+	for _, field := range []struct {
+		flag byte
+		dst  *time.Time
+	}{
+		{rrTimestampCreation, &ts.Creation},
+		{rrTimestampModify, &ts.Modify},
+		{rrTimestampAccess, &ts.Access},
+		{rrTimestampAttributes, &ts.AttributeChange},
+		{rrTimestampBackup, &ts.Backup},
+		{rrTimestampExpiration, &ts.Expiration},
+		{rrTimestampEffective, &ts.Effective},
+	} {
+		if flags&field.flag == 0 {
+			continue
+		}
+
+		if len(data) < timestampLen {
+			return fmt.Errorf("unmarshal RR TF entry: %w", io.ErrUnexpectedEOF)
+		}
+
+		t, err := unmarshalTimestamp(data[:timestampLen])
+		if err != nil {
+			return fmt.Errorf("unmarshal RR TF entry: %w", err)
+		}
+		*field.dst = t
+		data = data[timestampLen:]
+	}
+
+	return nil
+}
+
+// unmarshalTimestamp decodes a time stamp in either of the ECMA-119 formats.
+// A time stamp consisting of zeros only stands for "not specified" and yields a zero time.Time.
+func unmarshalTimestamp(data []byte) (time.Time, error) {
+	if len(data) == 17 {
+		var vdts VolumeDescriptorTimestamp
+		if err := vdts.UnmarshalBinary(data); err != nil {
+			return time.Time{}, err
+		}
+		return vdts.Time(), nil
+	}
+
+	unspecified := true
+	for _, b := range data {
+		if b != 0 {
+			unspecified = false
+			break
+		}
+	}
+	if unspecified {
+		return time.Time{}, nil
+	}
+
+	var rts RecordingTimestamp
+	if err := rts.UnmarshalBinary(data); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time(rts), nil
+}
+
+// getRockRidgeLink returns the location of the directory a CL or PL entry points to.
+// It returns false if there is no entry of the given type.
+func (s SystemUseEntrySlice) getRockRidgeLink(entryType string) (uint32, bool, error) {
+	for _, entry := range s {
+		if entry.Type() != entryType {
+			continue
+		}
+
+		if len(entry.Data()) < 8 {
+			return 0, true, fmt.Errorf("unmarshall RR %s entry: %w", entryType, io.ErrUnexpectedEOF)
+		}
+
+		location, err := UnmarshalUint32LSBMSB(entry.Data()[0:8])
+		if err != nil {
+			return 0, true, fmt.Errorf("unmarshall RR %s entry: %w", entryType, err)
+		}
+
+		return location, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// GetRockRidgeChildLink returns the location of a relocated directory,
+// which the entry stands in for. It returns false if there is no CL entry.
+func (s SystemUseEntrySlice) GetRockRidgeChildLink() (uint32, bool, error) {
+	return s.getRockRidgeLink("CL")
+}
+
+// GetRockRidgeParentLink returns the location of the original parent of
+// a relocated directory. It returns false if there is no PL entry.
+func (s SystemUseEntrySlice) GetRockRidgeParentLink() (uint32, bool, error) {
+	return s.getRockRidgeLink("PL")
+}
+
+// IsRockRidgeRelocated returns true if the entry has been marked by an RE entry
+// as a relocated directory, which should not appear in its current location.
+func (s SystemUseEntrySlice) IsRockRidgeRelocated() bool {
+	for _, entry := range s {
+		if entry.Type() == "RE" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RockRidgeSparseEntry describes file data recorded in the sparse format, see RR 4.1.7
+type RockRidgeSparseEntry struct {
+	VirtualSize uint64
+	TableDepth  byte
+}
+
+// GetRockRidgeSparse decodes the SF entry. It returns nil if there is none.
+func (s SystemUseEntrySlice) GetRockRidgeSparse() (*RockRidgeSparseEntry, error) {
+	for _, entry := range s {
+		if entry.Type() != "SF" {
+			continue
+		}
+
+		data := entry.Data()
+		if len(data) < 17 {
+			return nil, fmt.Errorf("unmarshall RR SF entry: %w", io.ErrUnexpectedEOF)
+		}
+
+		high, err := UnmarshalUint32LSBMSB(data[0:8])
+		if err != nil {
+			return nil, fmt.Errorf("unmarshall RR SF entry: %w", err)
+		}
+		low, err := UnmarshalUint32LSBMSB(data[8:16])
+		if err != nil {
+			return nil, fmt.Errorf("unmarshall RR SF entry: %w", err)
+		}
+
+		return &RockRidgeSparseEntry{
+			VirtualSize: uint64(high)<<32 | uint64(low),
+			TableDepth:  data[16],
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// RockRidgeZisofsEntry describes file data compressed in the zisofs format, as recorded in a ZF entry
+type RockRidgeZisofsEntry struct {
+	Algorithm        string // "pz" for paged zlib, the only algorithm in use
+	HeaderSize       byte   // the size of the file header in bytes
+	BlockSizeLog2    byte
+	UncompressedSize uint32
+}
+
+// GetRockRidgeZisofs decodes the ZF entry. It returns nil if there is none.
+func (s SystemUseEntrySlice) GetRockRidgeZisofs() (*RockRidgeZisofsEntry, error) {
+	for _, entry := range s {
+		if entry.Type() != "ZF" {
+			continue
+		}
+
+		data := entry.Data()
+		if len(data) < 12 {
+			return nil, fmt.Errorf("unmarshall RR ZF entry: %w", io.ErrUnexpectedEOF)
+		}
+
+		size, err := UnmarshalUint32LSBMSB(data[4:12])
+		if err != nil {
+			return nil, fmt.Errorf("unmarshall RR ZF entry: %w", err)
+		}
+
+		return &RockRidgeZisofsEntry{
+			Algorithm:        string(data[0:2]),
+			HeaderSize:       data[2] * 4,
+			BlockSizeLog2:    data[3],
+			UncompressedSize: size,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// Flags of an NM entry, see RR 4.1.4
+const (
+	rrNameContinue = 1 << iota
+	rrNameCurrent
+	rrNameParent
+)
+
+// maxSystemUseEntryLength is the largest length recordable in the LEN field of a System Use entry
+const maxSystemUseEntryLength = 255
+
+// newSystemUseEntry creates an entry with the given type, version 1 and payload
+func newSystemUseEntry(entryType string, payload []byte) SystemUseEntry {
+	e := SystemUseEntry{entryType[0], entryType[1], byte(4 + len(payload)), 1}
+	return append(e, payload...)
+}
+
+// rockRidgeMode converts a FileMode into the POSIX file mode recorded in PX entries
+func rockRidgeMode(mode fs.FileMode) uint32 {
+	rrMode := uint32(mode & fs.ModePerm)
+
+	switch {
+	case mode&os.ModeSocket != 0:
+		rrMode |= rrModeSocket
+	case mode&os.ModeSymlink != 0:
+		rrMode |= rrModeSymlink
+	case mode&os.ModeCharDevice != 0:
+		rrMode |= rrModeCharDev
+	case mode&os.ModeDevice != 0:
+		rrMode |= rrModeBlockDev
+	case mode&os.ModeDir != 0:
+		rrMode |= rrModeDir
+	case mode&os.ModeNamedPipe != 0:
+		rrMode |= rrModeFIFO
+	default:
+		rrMode |= rrModeRegular
+	}
+
+	if mode&os.ModeSetuid != 0 {
+		rrMode |= rrModeSetuid
+	}
+	if mode&os.ModeSetgid != 0 {
+		rrMode |= rrModeSetgid
+	}
+	if mode&os.ModeSticky != 0 {
+		rrMode |= rrModeSticky
+	}
+
+	return rrMode
+}
+
+// marshalRockRidgePosixEntry encodes a PX entry in the RRIP 1991A form, without the file serial number
+func marshalRockRidgePosixEntry(attrs *PosixAttributes) SystemUseEntry {
+	payload := make([]byte, 32)
+	WriteInt32LSBMSB(payload[0:8], int32(rockRidgeMode(attrs.Mode)))
+	WriteInt32LSBMSB(payload[8:16], int32(attrs.Links))
+	WriteInt32LSBMSB(payload[16:24], int32(attrs.UID))
+	WriteInt32LSBMSB(payload[24:32], int32(attrs.GID))
+	return newSystemUseEntry("PX", payload)
+}
+
+// marshalRockRidgeZisofsEntry encodes a ZF entry
+func marshalRockRidgeZisofsEntry(zf *RockRidgeZisofsEntry) SystemUseEntry {
+	payload := make([]byte, 12)
+	copy(payload[0:2], zf.Algorithm)
+	payload[2] = zf.HeaderSize / 4
+	payload[3] = zf.BlockSizeLog2
+	WriteInt32LSBMSB(payload[4:12], int32(zf.UncompressedSize))
+	return newSystemUseEntry("ZF", payload)
+}
+
+// marshalRockRidgeNameEntries encodes a name into as many NM entries as necessary
+func marshalRockRidgeNameEntries(name string) []SystemUseEntry {
+	maxNameLength := maxSystemUseEntryLength - 5
+
+	var entries []SystemUseEntry
+	for {
+		var flags byte
+		part := name
+		if len(part) > maxNameLength {
+			part = part[:maxNameLength]
+			flags |= rrNameContinue
+		}
+		name = name[len(part):]
+
+		entries = append(entries, newSystemUseEntry("NM", append([]byte{flags}, part...)))
+		if len(name) == 0 {
+			return entries
+		}
+	}
+}
+
+// marshalRockRidgeSymlinkEntries encodes the target of a symbolic link into as many SL entries as necessary
+func marshalRockRidgeSymlinkEntries(target string) []SystemUseEntry {
+	maxComponentsLength := maxSystemUseEntryLength - 5
+	maxContentLength := maxComponentsLength - 2
+
+	var components [][]byte
+	if strings.HasPrefix(target, "/") {
+		components = append(components, []byte{rrComponentRoot, 0})
+	}
+
+	for _, part := range strings.Split(target, "/") {
+		switch part {
+		case "":
+			continue
+		case ".":
+			components = append(components, []byte{rrComponentCurrent, 0})
+		case "..":
+			components = append(components, []byte{rrComponentParent, 0})
+		default:
+			for len(part) > maxContentLength {
+				components = append(components, append([]byte{rrComponentContinue, byte(maxContentLength)}, part[:maxContentLength]...))
+				part = part[maxContentLength:]
+			}
+			components = append(components, append([]byte{0, byte(len(part))}, part...))
+		}
+	}
+
+	var entries []SystemUseEntry
+	var payload []byte
+	for _, component := range components {
+		if len(payload)+len(component) > maxComponentsLength {
+			entries = append(entries, newSystemUseEntry("SL", append([]byte{rrComponentContinue}, payload...)))
+			payload = nil
+		}
+		payload = append(payload, component...)
+	}
+
+	return append(entries, newSystemUseEntry("SL", append([]byte{0}, payload...)))
+}
+
+// marshalRockRidgeTimestampEntry encodes all non-zero time stamps into a TF entry
+// using the 7-byte form of ECMA-119 9.1.5.
+func marshalRockRidgeTimestampEntry(ts *RockRidgeTimestamps) SystemUseEntry {
+	payload := []byte{0}
+
+	for _, field := range []struct {
+		flag byte
+		t    time.Time
+	}{
+		{rrTimestampCreation, ts.Creation},
+		{rrTimestampModify, ts.Modify},
+		{rrTimestampAccess, ts.Access},
+		{rrTimestampAttributes, ts.AttributeChange},
+		{rrTimestampBackup, ts.Backup},
+		{rrTimestampExpiration, ts.Expiration},
+		{rrTimestampEffective, ts.Effective},
+	} {
+		if field.t.IsZero() {
+			continue
+		}
+
+		payload[0] |= field.flag
+		timestamp := make([]byte, 7)
+		RecordingTimestamp(field.t).MarshalBinary(timestamp)
+		payload = append(payload, timestamp...)
+	}
+
+	return newSystemUseEntry("TF", payload)
+}
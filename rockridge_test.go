@@ -0,0 +1,181 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func slEntry(flags byte, components ...byte) SystemUseEntry {
+	e := SystemUseEntry{'S', 'L', byte(5 + len(components)), 1, flags}
+	return append(e, components...)
+}
+
+func TestRockRidgeSymlink(t *testing.T) {
+	for _, testcase := range []struct {
+		name    string
+		entries SystemUseEntrySlice
+		target  string
+	}{
+		{
+			name:    "absolute",
+			entries: SystemUseEntrySlice{slEntry(0, rrComponentRoot, 0, 0, 3, 'u', 's', 'r', 0, 3, 'b', 'i', 'n')},
+			target:  "/usr/bin",
+		},
+		{
+			name:    "relative with current and parent",
+			entries: SystemUseEntrySlice{slEntry(0, rrComponentCurrent, 0, rrComponentParent, 0, 0, 3, 'l', 'i', 'b')},
+			target:  "./../lib",
+		},
+		{
+			name: "component continued in the next SL entry",
+			entries: SystemUseEntrySlice{
+				slEntry(1, rrComponentParent, 0, rrComponentContinue, 4, 'v', 'e', 'r', 'y'),
+				{'N', 'M', 5, 1, 0},
+				slEntry(0, 0, 4, 'l', 'o', 'n', 'g', 0, 1, 'x'),
+			},
+			target: "../verylong/x",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			target, found, err := testcase.entries.GetRockRidgeSymlink()
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, testcase.target, target)
+		})
+	}
+
+	_, found, err := SystemUseEntrySlice{{'N', 'M', 5, 1, 0}}.GetRockRidgeSymlink()
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, err = SystemUseEntrySlice{slEntry(0, 0, 10, 'x')}.GetRockRidgeSymlink()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRockRidgeTimestamps(t *testing.T) {
+	tz := time.FixedZone("", -3600*5)
+
+	// short form: creation and modification
+	short := SystemUseEntry{'T', 'F', 19, 1, rrTimestampCreation | rrTimestampModify,
+		120, 1, 2, 3, 4, 5, 0xEC, // 2020-01-02 03:04:05 -05:00
+		121, 6, 7, 8, 9, 10, 0xEC, // 2021-06-07 08:09:10 -05:00
+	}
+	ts, err := SystemUseEntrySlice{short}.GetRockRidgeTimestamps()
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2020, 1, 2, 3, 4, 5, 0, tz).Equal(ts.Creation))
+	assert.True(t, time.Date(2021, 6, 7, 8, 9, 10, 0, tz).Equal(ts.Modify))
+	assert.True(t, ts.Access.IsZero())
+
+	// long form: access, expiration (unspecified) and effective
+	long := SystemUseEntry{'T', 'F', 56, 1, rrTimestampAccess | rrTimestampExpiration | rrTimestampEffective | rrTimestampLongForm}
+	long = append(long, "2022010203040599\xEC"...)
+	long = append(long, "0000000000000000\x00"...)
+	long = append(long, "2023123123595900\x00"...)
+	ts, err = SystemUseEntrySlice{long}.GetRockRidgeTimestamps()
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2022, 1, 2, 3, 4, 5, 990000000, tz).Equal(ts.Access))
+	assert.True(t, ts.Expiration.IsZero())
+	assert.True(t, time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC).Equal(ts.Effective))
+
+	_, err = SystemUseEntrySlice{{'T', 'F', 7, 1, rrTimestampModify, 120, 1}}.GetRockRidgeTimestamps()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = SystemUseEntrySlice{}.GetRockRidgeTimestamps()
+	assert.Error(t, err)
+}
+
+func pxEntry(mode, links, uid, gid uint32) SystemUseEntry {
+	e := SystemUseEntry{'P', 'X', 36, 1}
+	for _, v := range []uint32{mode, links, uid, gid} {
+		field := make([]byte, 8)
+		WriteInt32LSBMSB(field, int32(v))
+		e = append(e, field...)
+	}
+	return e
+}
+
+func pnEntry(high, low uint32) SystemUseEntry {
+	e := SystemUseEntry{'P', 'N', 20, 1}
+	for _, v := range []uint32{high, low} {
+		field := make([]byte, 8)
+		WriteInt32LSBMSB(field, int32(v))
+		e = append(e, field...)
+	}
+	return e
+}
+
+func TestRockRidgeFileTypes(t *testing.T) {
+	for _, testcase := range []struct {
+		rrMode uint32
+		mode   fs.FileMode
+	}{
+		{0100644, 0644},
+		{0040755, fs.ModeDir | 0755},
+		{0120777, fs.ModeSymlink | 0777},
+		{0140755, fs.ModeSocket | 0755},
+		{0060660, fs.ModeDevice | 0660},
+		{0020620, fs.ModeDevice | fs.ModeCharDevice | 0620},
+		{0010644, fs.ModeNamedPipe | 0644},
+		{0104755, fs.ModeSetuid | 0755},
+		{0042775, fs.ModeDir | fs.ModeSetgid | 0775},
+		{0041777, fs.ModeDir | fs.ModeSticky | 0777},
+	} {
+		mode, err := SystemUseEntrySlice{pxEntry(testcase.rrMode, 1, 0, 0)}.GetPosixAttr()
+		assert.NoError(t, err)
+		assert.Equal(t, testcase.mode, mode, "mode %o", testcase.rrMode)
+	}
+}
+
+func TestRockRidgePosixAttributes(t *testing.T) {
+	attrs, err := SystemUseEntrySlice{pxEntry(0100640, 2, 1000, 100)}.GetPosixAttributes()
+	assert.NoError(t, err)
+	assert.Equal(t, &PosixAttributes{Mode: 0640, Links: 2, UID: 1000, GID: 100}, attrs)
+
+	// /dev/sda1 with a 64-bit device number
+	attrs, err = SystemUseEntrySlice{pxEntry(0060660, 1, 0, 6), pnEntry(8, 1)}.GetPosixAttributes()
+	assert.NoError(t, err)
+	assert.Equal(t, fs.ModeDevice|0660, attrs.Mode)
+	assert.Equal(t, uint32(8), attrs.DeviceMajor)
+	assert.Equal(t, uint32(1), attrs.DeviceMinor)
+
+	// /dev/tty1 with an old-style 16-bit device number
+	attrs, err = SystemUseEntrySlice{pxEntry(0020620, 1, 0, 5), pnEntry(0, 0x0401)}.GetPosixAttributes()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), attrs.DeviceMajor)
+	assert.Equal(t, uint32(1), attrs.DeviceMinor)
+
+	_, err = SystemUseEntrySlice{pnEntry(8, 1)}.GetPosixAttributes()
+	assert.Error(t, err)
+}
+
+func TestRockRidgeSparse(t *testing.T) {
+	sf, err := SystemUseEntrySlice{pxEntry(0100644, 1, 0, 0)}.GetRockRidgeSparse()
+	assert.NoError(t, err)
+	assert.Nil(t, sf)
+
+	e := SystemUseEntry{'S', 'F', 21, 1}
+	for _, v := range []uint32{1, 0x800} {
+		field := make([]byte, 8)
+		WriteInt32LSBMSB(field, int32(v))
+		e = append(e, field...)
+	}
+	e = append(e, 2)
+
+	sf, err = SystemUseEntrySlice{e}.GetRockRidgeSparse()
+	assert.NoError(t, err)
+	if assert.NotNil(t, sf) {
+		assert.Equal(t, uint64(0x100000800), sf.VirtualSize)
+		assert.Equal(t, byte(2), sf.TableDepth)
+	}
+
+	truncated := append(SystemUseEntry{'S', 'F', 12, 1}, e[4:12]...)
+	_, err = SystemUseEntrySlice{truncated}.GetRockRidgeSparse()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,236 @@
+package iso9660
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// A multi-session image holds several volume descriptor sets, each of which is recorded 16 sectors
+// after the start of its session, like the one of a single-session image is recorded after the system area.
+// Directory records address the whole image, so later sessions can refer to the extents of files recorded
+// in earlier ones. The volume space of a session spans the image from sector 0 to the end of the session.
+
+// maxSessionGap is the number of sectors which may separate the end of a session from the start of the next one.
+// On a CD, the lead-out and lead-in areas and the pre-gap between the first and the second session take 11400 sectors.
+const maxSessionGap = 11400
+
+// Session describes a session of an image along with its volume descriptors
+type Session struct {
+	// Start is the sector at which the session starts. Its volume descriptors are recorded 16 sectors later.
+	Start uint32
+	// End is the sector following the last sector of the session
+	End uint32
+
+	Primary       *PrimaryVolumeDescriptorBody
+	Supplementary []*PrimaryVolumeDescriptorBody
+	Boot          []*BootVolumeDescriptorBody
+}
+
+// WithSessionStart makes OpenImage read the session starting at the given sector instead of the first one.
+// The start of every session of an image is listed by Image.Sessions.
+func WithSessionStart(sector uint32) ImageOption {
+	return func(i *Image) {
+		i.sessionStart = sector
+	}
+}
+
+// WithLastSession makes OpenImage look for the sessions recorded after the first one and read the last session.
+// Images with a single session are read as usual.
+func WithLastSession() ImageOption {
+	return func(i *Image) {
+		i.lastSession = true
+	}
+}
+
+// Sessions returns the sessions recorded in the image in the order they were recorded in.
+// Each of them can be opened by passing WithSessionStart to OpenImage.
+func (i *Image) Sessions() ([]Session, error) {
+	return scanSessions(i.ra)
+}
+
+// newSession describes the session starting at the given sector with the given volume descriptors
+func newSession(start uint32, volumeDescriptors []volumeDescriptor) (Session, error) {
+	s := Session{Start: start}
+	for _, vd := range volumeDescriptors {
+		switch vd.Type() {
+		case volumeTypePrimary:
+			if s.Primary == nil {
+				s.Primary = vd.Primary
+			}
+		case volumeTypeSupplementary:
+			s.Supplementary = append(s.Supplementary, vd.Primary)
+		case volumeTypeBoot:
+			s.Boot = append(s.Boot, vd.Boot)
+		}
+	}
+
+	if s.Primary == nil {
+		return s, fmt.Errorf("the session at sector %d has no primary volume descriptor", start)
+	}
+	if s.Primary.VolumeSpaceSize < 0 || uint32(s.Primary.VolumeSpaceSize) <= start+systemAreaSectors {
+		return s, fmt.Errorf("the volume space of the session at sector %d ends at sector %d", start, s.Primary.VolumeSpaceSize)
+	}
+	s.End = uint32(s.Primary.VolumeSpaceSize)
+
+	return s, nil
+}
+
+// scanSessions finds the sessions of an image. Each session after the first is looked for
+// in the sectors following the end of the volume space of the previous one.
+func scanSessions(ra io.ReaderAt) ([]Session, error) {
+	vds, err := readVolumeDescriptors(ra, 0)
+	if err != nil {
+		return nil, err
+	}
+	first, err := newSession(0, vds)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{first}
+	for {
+		next, ok := findNextSession(ra, sessions[len(sessions)-1].End)
+		if !ok {
+			return sessions, nil
+		}
+		sessions = append(sessions, next)
+	}
+}
+
+// findNextSession looks for a session starting within maxSessionGap sectors after the given sector
+func findNextSession(ra io.ReaderAt, after uint32) (Session, bool) {
+	buffer := make([]byte, sectorSize)
+	for start := after; start <= after+maxSessionGap; start++ {
+		if _, err := ra.ReadAt(buffer, int64(start+systemAreaSectors)*int64(sectorSize)); err != nil {
+			// the end of the image
+			return Session{}, false
+		}
+
+		var header volumeDescriptorHeader
+		if err := header.UnmarshalBinary(buffer); err != nil || header.Type != volumeTypePrimary || header.Identifier != standardIdentifierBytes {
+			continue
+		}
+
+		vds, err := readVolumeDescriptors(ra, start)
+		if err != nil {
+			continue
+		}
+		if s, err := newSession(start, vds); err == nil {
+			return s, true
+		}
+	}
+
+	return Session{}, false
+}
+
+// sessionAlignment is the number of sectors new sessions are aligned to, 32 KiB like with growisofs
+const sessionAlignment = 16
+
+// WithPreviousSession makes the ImageWriter append a new session to the given image instead of creating a new image.
+// The files of the session the image has been opened at are carried over to the new session, whose directory tree
+// refers to their extents in the image, so that only the files added to the ImageWriter are written.
+// Adding a file under the path of an existing one replaces it. The boot record of the image is kept
+// unless boot images are added.
+//
+// The new session starts after the last session of the image. WriteTo only writes the new session,
+// which has to be written to the image at SessionOffset. Hybrid images cannot be appended to.
+func WithPreviousSession(img *Image) WriterOption {
+	return func(iw *ImageWriter) {
+		iw.previousSession = img
+	}
+}
+
+// SessionOffset returns the offset in bytes at which the output of WriteTo starts within the image,
+// which is 0 unless a session is appended to an existing image
+func (iw *ImageWriter) SessionOffset() int64 {
+	return int64(iw.sessionStart) * int64(sectorSize)
+}
+
+// stagePreviousSession stages placeholders for the files and directories of the session to be appended to.
+// The records of the files are kept, so that the new directory tree can refer to their extents.
+func (iw *ImageWriter) stagePreviousSession() error {
+	img := iw.previousSession
+
+	sessions, err := scanSessions(img.ra)
+	if err != nil {
+		return fmt.Errorf("finding the last session: %w", err)
+	}
+	end := sessions[len(sessions)-1].End
+	iw.sessionStart = (end + sessionAlignment - 1) / sessionAlignment * sessionAlignment
+
+	for _, vd := range img.volumeDescriptors {
+		if vd.Type() == volumeTypeBoot && vd.Boot.BootSystemIdentifier == elToritoBootSystemIdentifier {
+			iw.previousBootRecord = vd.Boot
+		}
+	}
+
+	root, err := img.RootDir()
+	if err != nil {
+		return err
+	}
+
+	iw.previousFiles = make(map[string][]*DirectoryEntry)
+	return iw.stagePreviousDirectory(root, "")
+}
+
+// stagePreviousDirectory stages the contents of a directory of the previous session under the given original path
+func (iw *ImageWriter) stagePreviousDirectory(dir *File, dirPath string) error {
+	children, err := dir.GetChildren()
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", dirPath, err)
+	}
+
+	for _, c := range children {
+		originalPath := path.Join(dirPath, c.Name())
+		var stagedPath string
+		if c.IsDir() {
+			stagedPath = mangleDirectoryPath(originalPath)
+		} else {
+			stagedPath = path.Join(manglePath(originalPath))
+		}
+
+		if _, err := os.Lstat(path.Join(iw.stagingDir, stagedPath)); err == nil {
+			return fmt.Errorf("%q of the previous session would replace another file recorded as %q", originalPath, stagedPath)
+		}
+
+		iw.recordOriginalNames(originalPath)
+		if c.hasRockRidge() {
+			iw.recordLocalFileInfo(stagedPath, c)
+		}
+
+		switch {
+		case c.IsDir():
+			if err := iw.mkdirStaged(stagedPath); err != nil {
+				return err
+			}
+			if err := iw.stagePreviousDirectory(c, originalPath); err != nil {
+				return err
+			}
+		case c.Mode()&os.ModeSymlink != 0 && iw.rockRidge:
+			target, err := c.Readlink()
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, path.Join(iw.stagingDir, stagedPath)); err != nil {
+				return err
+			}
+		case c.IsSparse():
+			return fmt.Errorf("%q of the previous session is a sparse file, which cannot be carried over", originalPath)
+		case c.IsCompressed() && !iw.rockRidge:
+			return fmt.Errorf("%q of the previous session is compressed, which requires Rock Ridge", originalPath)
+		default:
+			f, err := os.Create(path.Join(iw.stagingDir, stagedPath))
+			if err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			iw.previousFiles[stagedPath] = append([]*DirectoryEntry{c.de}, c.extents...)
+		}
+	}
+
+	return nil
+}
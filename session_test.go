@@ -0,0 +1,384 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSessionImage creates an image with two sessions, the second of which starts at sector 32
+// and refers to the file recorded in the first one
+func writeSessionImage(t *testing.T) []byte {
+	sector := func(data string) []byte {
+		s := make([]byte, sectorSize)
+		copy(s, data)
+		return s
+	}
+	session := func(label string, rootLocation int32, volumeSpaceSize int32, files ...*DirectoryEntry) []byte {
+		dot := &DirectoryEntry{ExtentLocation: rootLocation, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00"}
+		dotDot := &DirectoryEntry{ExtentLocation: rootLocation, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+
+		var data bytes.Buffer
+		data.Write(make([]byte, systemAreaSize))
+		data.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+			Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+			Primary: &PrimaryVolumeDescriptorBody{VolumeIdentifier: label, VolumeSpaceSize: volumeSpaceSize, LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: dotDot},
+		}))
+		data.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+		data.Write(marshalDirectory(t, append([]*DirectoryEntry{dot, dotDot}, files...)...))
+		return data.Bytes()
+	}
+
+	old := &DirectoryEntry{ExtentLocation: 19, ExtentLength: 3, Identifier: "OLD.TXT;1"}
+	added := &DirectoryEntry{ExtentLocation: 51, ExtentLength: 3, Identifier: "NEW.TXT;1"}
+
+	var image bytes.Buffer
+	image.Write(session("FIRST", 18, 20, old))
+	image.Write(sector("old"))
+	// the gap between the sessions
+	image.Write(make([]byte, 12*sectorSize))
+	image.Write(session("SECOND", 50, 52, old, added))
+	image.Write(sector("new"))
+
+	return image.Bytes()
+}
+
+func TestImageSessions(t *testing.T) {
+	image := writeSessionImage(t)
+
+	img, err := OpenImage(bytes.NewReader(image))
+	if !assert.NoError(t, err) {
+		return
+	}
+	label, err := img.Label()
+	assert.NoError(t, err)
+	assert.Equal(t, "FIRST", label)
+
+	sessions, err := img.Sessions()
+	if !assert.NoError(t, err) || !assert.Len(t, sessions, 2) {
+		return
+	}
+	assert.Equal(t, uint32(0), sessions[0].Start)
+	assert.Equal(t, uint32(20), sessions[0].End)
+	assert.Equal(t, "FIRST", sessions[0].Primary.VolumeIdentifier)
+	assert.Equal(t, uint32(32), sessions[1].Start)
+	assert.Equal(t, uint32(52), sessions[1].End)
+	assert.Equal(t, "SECOND", sessions[1].Primary.VolumeIdentifier)
+	assert.Empty(t, sessions[1].Supplementary)
+
+	last, err := OpenImage(bytes.NewReader(image), WithLastSession())
+	if !assert.NoError(t, err) {
+		return
+	}
+	label, err = last.Label()
+	assert.NoError(t, err)
+	assert.Equal(t, "SECOND", label)
+
+	for name, content := range map[string]string{"OLD.TXT": "old", "NEW.TXT": "new"} {
+		f, err := last.Lookup(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		data, err := io.ReadAll(f.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+
+	// older sessions stay readable
+	for _, s := range sessions {
+		img, err := OpenImage(bytes.NewReader(image), WithSessionStart(s.Start))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		label, err := img.Label()
+		assert.NoError(t, err)
+		assert.Equal(t, s.Primary.VolumeIdentifier, label)
+	}
+
+	_, err = OpenImage(bytes.NewReader(image), WithSessionStart(5))
+	assert.Error(t, err)
+}
+
+func TestImageSessionsSingle(t *testing.T) {
+	w, err := NewWriter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	assert.NoError(t, w.AddFile(bytes.NewReader([]byte(loremIpsum)), "readme.txt"))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "single")) {
+		return
+	}
+
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()), WithLastSession())
+	if !assert.NoError(t, err) {
+		return
+	}
+	sessions, err := img.Sessions()
+	if assert.NoError(t, err) && assert.Len(t, sessions, 1) {
+		assert.Equal(t, uint32(0), sessions[0].Start)
+		assert.Equal(t, uint32(buf.Len())/sectorSize, sessions[0].End)
+	}
+}
+
+func TestWriterAppendSession(t *testing.T) {
+	w, err := NewWriter(WithRockRidge())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	assert.NoError(t, w.AddFile(strings.NewReader(loremIpsum), "ReadMe.txt"))
+	assert.NoError(t, w.AddFile(strings.NewReader("old"), "dir/old.txt"))
+	assert.NoError(t, w.AddFile(strings.NewReader("version 1"), "dir/replaced.txt"))
+
+	var first bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&first, "first")) {
+		return
+	}
+
+	img, err := OpenImage(bytes.NewReader(first.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	readme, err := img.Lookup("ReadMe.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	w2, err := NewWriter(WithRockRidge(), WithJoliet(), WithPreviousSession(img))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w2.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	assert.NoError(t, w2.AddFile(strings.NewReader("version 2"), "dir/replaced.txt"))
+	assert.NoError(t, w2.AddFile(strings.NewReader("new"), "new/Added.txt"))
+
+	offset := w2.SessionOffset()
+	assert.GreaterOrEqual(t, offset, int64(first.Len()))
+	assert.Zero(t, offset%(sessionAlignment*int64(sectorSize)))
+
+	var second bytes.Buffer
+	if !assert.NoError(t, w2.WriteTo(&second, "second")) {
+		return
+	}
+	// the data of the files carried over is not written again
+	assert.NotContains(t, second.String(), loremIpsum)
+
+	image := append(first.Bytes(), make([]byte, offset-int64(first.Len()))...)
+	image = append(image, second.Bytes()...)
+
+	appended, err := OpenImage(bytes.NewReader(image), WithLastSession())
+	if !assert.NoError(t, err) {
+		return
+	}
+	label, err := appended.Label()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", label)
+
+	sessions, err := appended.Sessions()
+	if assert.NoError(t, err) && assert.Len(t, sessions, 2) {
+		assert.Equal(t, uint32(offset/int64(sectorSize)), sessions[1].Start)
+		assert.Equal(t, uint32(len(image))/sectorSize, sessions[1].End)
+	}
+
+	expected := map[string]string{
+		"ReadMe.txt":       loremIpsum,
+		"dir/old.txt":      "old",
+		"dir/replaced.txt": "version 2",
+		"new/Added.txt":    "new",
+	}
+	for name, content := range expected {
+		f, err := appended.Lookup(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		data, err := io.ReadAll(f.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data), name)
+	}
+
+	carried, err := appended.Lookup("ReadMe.txt")
+	if assert.NoError(t, err) {
+		assert.Equal(t, readme.de.ExtentLocation, carried.de.ExtentLocation)
+		assert.Equal(t, readme.Mode(), carried.Mode())
+	}
+
+	jolietRoot, err := appended.JolietRootDir()
+	if assert.NoError(t, err) {
+		children, err := jolietRoot.GetChildren()
+		assert.NoError(t, err)
+		var names []string
+		for _, c := range children {
+			names = append(names, c.Name())
+		}
+		assert.Equal(t, []string{"ReadMe.txt", "dir", "new"}, names)
+	}
+
+	// the first session is left as it was
+	original, err := OpenImage(bytes.NewReader(image))
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := original.Lookup("dir/replaced.txt")
+	if assert.NoError(t, err) {
+		data, err := io.ReadAll(f.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, "version 1", string(data))
+	}
+	_, err = original.Lookup("new")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestWriterAppendSessionBootInfoTable(t *testing.T) {
+	w, err := NewWriter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	assert.NoError(t, w.AddFile(strings.NewReader(loremIpsum), "readme.txt"))
+
+	var first bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&first, "first")) {
+		return
+	}
+	img, err := OpenImage(bytes.NewReader(first.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	w2, err := NewWriter(WithPreviousSession(img))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w2.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	isolinux := bytes.Repeat([]byte{0xA5}, 5000)
+	assert.NoError(t, w2.AddFile(bytes.NewReader(isolinux), "isolinux/isolinux.bin"))
+	assert.NoError(t, w2.AddBootImage("isolinux/isolinux.bin", BootImageOptions{SectorCount: 4, BootInfoTable: true}))
+
+	offset := w2.SessionOffset()
+	var second bytes.Buffer
+	if !assert.NoError(t, w2.WriteTo(&second, "second")) {
+		return
+	}
+	image := append(first.Bytes(), make([]byte, offset-int64(first.Len()))...)
+	image = append(image, second.Bytes()...)
+
+	appended, err := OpenImage(bytes.NewReader(image), WithLastSession())
+	if !assert.NoError(t, err) {
+		return
+	}
+	bc, err := appended.BootCatalog()
+	if !assert.NoError(t, err) {
+		return
+	}
+	patched, err := io.ReadAll(bc.Default.Reader())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the boot info table points to the primary volume descriptor of the new session
+	pvdLocation := uint32(offset/int64(sectorSize)) + systemAreaSectors
+	assert.Equal(t, pvdLocation, binary.LittleEndian.Uint32(patched[8:12]))
+	assert.Equal(t, byte(volumeTypePrimary), image[int64(pvdLocation)*int64(sectorSize)])
+	assert.Equal(t, bc.Default.LoadRBA, binary.LittleEndian.Uint32(patched[12:16]))
+}
+
+func TestWriterAppendSessionReplaceSymlink(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "iso9660_golang_test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir) // nolint: errcheck
+
+	w, err := NewWriter(WithRockRidge())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+	pwned := filepath.Join(tmpdir, "pwned")
+	assert.NoError(t, os.Symlink(pwned, filepath.Join(tmpdir, "link")))
+	assert.NoError(t, w.AddLocalFile(filepath.Join(tmpdir, "link"), "link"))
+
+	var first bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&first, "first")) {
+		return
+	}
+	img, err := OpenImage(bytes.NewReader(first.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	w2, err := NewWriter(WithRockRidge(), WithPreviousSession(img))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w2.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	// the symlink staged from the previous session leads outside of the staging area
+	assert.NoError(t, w2.AddFile(strings.NewReader("replaced"), "link"))
+	_, err = os.Lstat(pwned)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// staged symlinks are not followed to directories either
+	assert.NoError(t, os.Symlink(tmpdir, filepath.Join(w2.stagingDir, "dirlink")))
+	assert.Error(t, w2.AddFile(strings.NewReader("escaped"), "dirlink/x"))
+	_, err = os.Lstat(filepath.Join(tmpdir, "x;1"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.NoError(t, os.Remove(filepath.Join(w2.stagingDir, "dirlink")))
+
+	offset := w2.SessionOffset()
+	var second bytes.Buffer
+	if !assert.NoError(t, w2.WriteTo(&second, "second")) {
+		return
+	}
+	image := append(first.Bytes(), make([]byte, offset-int64(first.Len()))...)
+	image = append(image, second.Bytes()...)
+
+	appended, err := OpenImage(bytes.NewReader(image), WithLastSession())
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := fs.ReadFile(appended.FS(), "link")
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced", string(data))
+}
@@ -0,0 +1,155 @@
+package iso9660
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Files recorded in the Rock Ridge sparse format (RR 4.1.7) start with a tree of
+// sparse file tables, each of which occupies one logical block. A table consists of
+// logical block numbers recorded in both byte orders (ECMA-119 7.3.3). Entries of the
+// tables at the lowest level point to the logical blocks holding the file's data,
+// entries of the higher levels point to tables of the next level down.
+// An entry set to 0 stands for a hole, which reads as zeros.
+const sparseTableEntrySize = 8
+
+// sparseReaderAt reads the virtual contents of a sparse file
+type sparseReaderAt struct {
+	ra          io.ReaderAt
+	rootTable   uint32
+	depth       int
+	virtualSize int64
+
+	tablesMutex sync.Mutex
+	tables      map[uint32][]uint32 // decoded tables by their location
+}
+
+var _ io.ReaderAt = &sparseReaderAt{}
+
+func newSparseReaderAt(ra io.ReaderAt, rootTable uint32, sf *RockRidgeSparseEntry) (*sparseReaderAt, error) {
+	if sf.TableDepth == 0 {
+		return nil, fmt.Errorf("invalid sparse file table depth 0")
+	}
+
+	// tables deeper than needed to cover the virtual size would let the blocks spanned
+	// by an entry of the top level table overflow
+	entriesPerTable := uint64(sectorSize / sparseTableEntrySize)
+	blocks := (sf.VirtualSize + uint64(sectorSize) - 1) / uint64(sectorSize)
+	neededDepth := 1
+	for capacity := entriesPerTable; capacity < blocks; capacity *= entriesPerTable {
+		neededDepth++
+	}
+	if int(sf.TableDepth) > neededDepth {
+		return nil, fmt.Errorf("sparse file table depth %d exceeds the depth %d needed for %d bytes", sf.TableDepth, neededDepth, sf.VirtualSize)
+	}
+
+	return &sparseReaderAt{
+		ra:          ra,
+		rootTable:   rootTable,
+		depth:       int(sf.TableDepth),
+		virtualSize: int64(sf.VirtualSize),
+		tables:      make(map[uint32][]uint32),
+	}, nil
+}
+
+func (sr *sparseReaderAt) readTable(location uint32) ([]uint32, error) {
+	sr.tablesMutex.Lock()
+	defer sr.tablesMutex.Unlock()
+
+	if table, ok := sr.tables[location]; ok {
+		return table, nil
+	}
+
+	buffer := make([]byte, sectorSize)
+	if _, err := sr.ra.ReadAt(buffer, int64(location)*int64(sectorSize)); err != nil {
+		return nil, fmt.Errorf("reading sparse file table: %w", err)
+	}
+
+	table := make([]uint32, sectorSize/sparseTableEntrySize)
+	for i := range table {
+		entry, err := UnmarshalUint32LSBMSB(buffer[i*sparseTableEntrySize : (i+1)*sparseTableEntrySize])
+		if err != nil {
+			return nil, fmt.Errorf("reading sparse file table: %w", err)
+		}
+		table[i] = entry
+	}
+
+	sr.tables[location] = table
+	return table, nil
+}
+
+// blockLocation resolves the n-th logical block of the virtual file.
+// It returns 0 if the block is a hole.
+func (sr *sparseReaderAt) blockLocation(n int64) (uint32, error) {
+	entriesPerTable := int64(sectorSize / sparseTableEntrySize)
+
+	// number of data blocks covered by a single entry of the top level table
+	span := int64(1)
+	for i := 1; i < sr.depth; i++ {
+		span *= entriesPerTable
+	}
+
+	location := sr.rootTable
+	for level := 0; level < sr.depth; level++ {
+		table, err := sr.readTable(location)
+		if err != nil {
+			return 0, err
+		}
+
+		index := n / span
+		if index >= entriesPerTable {
+			return 0, fmt.Errorf("block %d exceeds the sparse file tables", n)
+		}
+
+		location = table[index]
+		if location == 0 {
+			return 0, nil
+		}
+
+		n %= span
+		span /= entriesPerTable
+	}
+
+	return location, nil
+}
+
+// ReadAt implements io.ReaderAt
+func (sr *sparseReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= sr.virtualSize {
+		return 0, io.EOF
+	}
+
+	var err error
+	if remaining := sr.virtualSize - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+
+	n := 0
+	for n < len(p) {
+		block := (off + int64(n)) / int64(sectorSize)
+		offsetInBlock := (off + int64(n)) % int64(sectorSize)
+		chunk := p[n:]
+		if maxChunk := int64(sectorSize) - offsetInBlock; int64(len(chunk)) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+
+		location, lookupErr := sr.blockLocation(block)
+		if lookupErr != nil {
+			return n, lookupErr
+		}
+
+		if location == 0 {
+			for i := range chunk {
+				chunk[i] = 0
+			}
+		} else if _, readErr := sr.ra.ReadAt(chunk, int64(location)*int64(sectorSize)+offsetInBlock); readErr != nil {
+			return n, readErr
+		}
+
+		n += len(chunk)
+	}
+
+	return n, err
+}
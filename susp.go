@@ -174,8 +174,8 @@ func splitSystemUseEntries(data []byte, ra io.ReaderAt) ([]SystemUseEntry, error
 				return output, fmt.Errorf("unmarshaling ContinuationEntry: %w", err)
 			}
 			continuation := make([]byte, ce.lengthOfArea)
-			finalOffset := (ce.blockLocation * sectorSize) + ce.offset
-			if _, err := ra.ReadAt(continuation, int64(finalOffset)); err != nil {
+			finalOffset := int64(ce.blockLocation)*int64(sectorSize) + int64(ce.offset)
+			if _, err := ra.ReadAt(continuation, finalOffset); err != nil {
 				return output, fmt.Errorf("reading Continuation Area: %w", err)
 			}
 
@@ -209,3 +209,119 @@ func (sm *SUSPMetadata) Clone() *SUSPMetadata {
 		HasRockRidge: sm.HasRockRidge,
 	}
 }
+
+// continuationEntryLength is the length of a CE entry, see SUSP-112 5.1
+const continuationEntryLength = 28
+
+// marshalSPRecord encodes the SP entry, which has to open the System Use area
+// of the first directory record of the root directory
+func marshalSPRecord(sp *SPRecord) SystemUseEntry {
+	return newSystemUseEntry(SUEType_SharingProtocolIndicator, []byte{0xBE, 0xEF, sp.BytesSkipped})
+}
+
+// marshalExtensionRecord encodes an ER entry, see SUSP-112 5.5
+func marshalExtensionRecord(er *ExtensionRecord) SystemUseEntry {
+	payload := []byte{byte(len(er.Identifier)), byte(len(er.Descriptor)), byte(len(er.Source)), byte(er.Version)}
+	payload = append(payload, er.Identifier...)
+	payload = append(payload, er.Descriptor...)
+	payload = append(payload, er.Source...)
+	return newSystemUseEntry(SUEType_ExtensionsReference, payload)
+}
+
+func marshalContinuationEntry(ce *ContinuationEntry) SystemUseEntry {
+	payload := make([]byte, 24)
+	WriteInt32LSBMSB(payload[0:8], int32(ce.blockLocation))
+	WriteInt32LSBMSB(payload[8:16], int32(ce.offset))
+	WriteInt32LSBMSB(payload[16:24], int32(ce.lengthOfArea))
+	return newSystemUseEntry(SUEType_ContinuationArea, payload)
+}
+
+// splitSystemUse returns the longest run of entries which fits into the given space.
+// If not all of the entries fit, space is left after the run for a CE entry
+// pointing at the remaining ones.
+func splitSystemUse(entries []SystemUseEntry, space int) ([]SystemUseEntry, []SystemUseEntry) {
+	if systemUseLength(entries) <= space {
+		return entries, nil
+	}
+
+	var used, n int
+	for n < len(entries) && used+len(entries[n]) <= space-continuationEntryLength {
+		used += len(entries[n])
+		n++
+	}
+
+	return entries[:n], entries[n:]
+}
+
+func systemUseLength(entries []SystemUseEntry) int {
+	var length int
+	for _, e := range entries {
+		length += len(e)
+	}
+	return length
+}
+
+// continuationArea collects System Use entries that did not fit into their directory records.
+// It occupies consecutive sectors starting at location. Entries are never split across sectors,
+// because Linux refuses Continuation Areas crossing a logical block boundary.
+type continuationArea struct {
+	location uint32
+	data     []byte
+}
+
+// reserve returns the offset of length bytes within the area, skipping to the next sector if necessary
+func (ca *continuationArea) reserve(length int) int {
+	offset := len(ca.data)
+	if inSector := offset % int(sectorSize); inSector+length > int(sectorSize) {
+		offset += int(sectorSize) - inSector
+	}
+
+	ca.data = append(ca.data, make([]byte, offset+length-len(ca.data))...)
+	return offset
+}
+
+// place stores the entries in the area, chaining further CE entries if they don't fit into a single sector,
+// and returns the CE entry pointing at them.
+func (ca *continuationArea) place(entries []SystemUseEntry) SystemUseEntry {
+	var pieces [][]SystemUseEntry
+	for len(entries) > 0 {
+		var piece []SystemUseEntry
+		piece, entries = splitSystemUse(entries, int(sectorSize))
+		pieces = append(pieces, piece)
+	}
+
+	offsets := make([]int, len(pieces))
+	lengths := make([]int, len(pieces))
+	for i, piece := range pieces {
+		lengths[i] = systemUseLength(piece)
+		if i < len(pieces)-1 {
+			lengths[i] += continuationEntryLength
+		}
+		offsets[i] = ca.reserve(lengths[i])
+	}
+
+	for i, piece := range pieces {
+		offset := offsets[i]
+		for _, e := range piece {
+			offset += copy(ca.data[offset:], e)
+		}
+		if i < len(pieces)-1 {
+			copy(ca.data[offset:], ca.continuationEntry(offsets[i+1], lengths[i+1]))
+		}
+	}
+
+	return ca.continuationEntry(offsets[0], lengths[0])
+}
+
+func (ca *continuationArea) continuationEntry(offset, length int) SystemUseEntry {
+	return marshalContinuationEntry(&ContinuationEntry{
+		blockLocation: ca.location + uint32(offset)/sectorSize,
+		offset:        uint32(offset) % sectorSize,
+		lengthOfArea:  uint32(length),
+	})
+}
+
+// sectors returns the number of sectors occupied by the area
+func (ca *continuationArea) sectors() uint32 {
+	return fileLengthToSectors(uint32(len(ca.data)))
+}
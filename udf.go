@@ -0,0 +1,1320 @@
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// UDF (ECMA-167 as restricted by the OSTA Universal Disk Format specification) is recognized through
+// the descriptors of the volume recognition sequence, which follow the ISO9660 volume descriptors of
+// bridge images. The volume itself is found through the anchor volume descriptor pointer at sector 256,
+// which points to the volume descriptor sequence. Its partition and logical volume descriptors lead to
+// the file set descriptor and from there to the file entry of the root directory. All descriptors
+// start with a tag identifying them, protected by a checksum and a CRC.
+const (
+	udfAnchorSector = 256
+	udfTagSize      = 16
+
+	udfTagPrimaryVolume     uint16 = 1
+	udfTagAnchor            uint16 = 2
+	udfTagVolumePointer     uint16 = 3
+	udfTagImplementationUse uint16 = 4
+	udfTagPartition         uint16 = 5
+	udfTagLogicalVolume     uint16 = 6
+	udfTagUnallocatedSpace  uint16 = 7
+	udfTagTerminating       uint16 = 8
+	udfTagIntegrity         uint16 = 9
+	udfTagFileSet           uint16 = 256
+	udfTagFileIdentifier    uint16 = 257
+	udfTagAllocationExtent  uint16 = 258
+	udfTagFileEntry         uint16 = 261
+	udfTagExtendedFileEntry uint16 = 266
+
+	udfMaxAllocationExtents = 1024 // protects against loops of allocation extent descriptors
+	udfMaxVolumeDescriptors = 1024 // protects against loops of volume descriptor pointers
+
+	udfFileTypeDirectory byte = 4
+	udfFileTypeRegular   byte = 5
+	udfFileTypeSymlink   byte = 12
+
+	udfCharacteristicHidden    byte = 1 << 0
+	udfCharacteristicDirectory byte = 1 << 1
+	udfCharacteristicDeleted   byte = 1 << 2
+	udfCharacteristicParent    byte = 1 << 3
+
+	// the allocation descriptor types, found in the lowest bits of the ICB tag flags
+	udfAllocationShort    = 0
+	udfAllocationLong     = 1
+	udfAllocationExtended = 2
+	udfAllocationEmbedded = 3
+
+	// the extent types, found in the highest bits of the extent length of allocation descriptors
+	udfExtentRecorded    = 0
+	udfExtentAllocated   = 1
+	udfExtentUnallocated = 2
+	udfExtentNext        = 3
+	udfExtentLengthMask  = 1<<30 - 1
+)
+
+// volumeRecognitionIdentifiers are the identifiers of the ECMA-167 volume structure descriptors,
+// which are laid out like ISO9660 volume descriptors
+var volumeRecognitionIdentifiers = map[string]bool{
+	udfIdentifier: true, // BEA01
+	"NSR02":       true,
+	"NSR03":       true,
+	"TEA01":       true,
+	"BOOT2":       true,
+	"CDW02":       true,
+}
+
+// udfTag is the descriptor tag of ECMA-167 3/7.2
+type udfTag struct {
+	Identifier uint16
+	Version    uint16
+	Serial     uint16
+	Location   uint32
+}
+
+// unmarshalUDFTag decodes a descriptor tag, verifying its checksum and the CRC of the descriptor
+func unmarshalUDFTag(data []byte) (udfTag, error) {
+	if len(data) < udfTagSize {
+		return udfTag{}, io.ErrUnexpectedEOF
+	}
+
+	var checksum byte
+	for i := 0; i < udfTagSize; i++ {
+		if i != 4 {
+			checksum += data[i]
+		}
+	}
+	if checksum != data[4] {
+		return udfTag{}, fmt.Errorf("UDF descriptor tag checksum 0x%02X != 0x%02X", data[4], checksum)
+	}
+
+	tag := udfTag{
+		Identifier: binary.LittleEndian.Uint16(data[0:2]),
+		Version:    binary.LittleEndian.Uint16(data[2:4]),
+		Serial:     binary.LittleEndian.Uint16(data[6:8]),
+		Location:   binary.LittleEndian.Uint32(data[12:16]),
+	}
+
+	crcLength := int(binary.LittleEndian.Uint16(data[10:12]))
+	if udfTagSize+crcLength > len(data) {
+		return udfTag{}, fmt.Errorf("UDF descriptor %d is truncated", tag.Identifier)
+	}
+	if crc := udfCRC(data[udfTagSize : udfTagSize+crcLength]); crc != binary.LittleEndian.Uint16(data[8:10]) {
+		return udfTag{}, fmt.Errorf("UDF descriptor %d has an invalid CRC", tag.Identifier)
+	}
+
+	return tag, nil
+}
+
+// udfCRC calculates the CRC-ITU-T of descriptors, see ECMA-167 1/7.2.6
+func udfCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// udfExtent is an extent_ad of ECMA-167 3/7.1
+type udfExtent struct {
+	Length   uint32
+	Location uint32
+}
+
+func unmarshalUDFExtent(data []byte) udfExtent {
+	return udfExtent{
+		Length:   binary.LittleEndian.Uint32(data[0:4]),
+		Location: binary.LittleEndian.Uint32(data[4:8]),
+	}
+}
+
+// udfLongAllocation is a long_ad of ECMA-167 4/14.14.2, which points to a logical block of a partition
+type udfLongAllocation struct {
+	Length    uint32 // the type of the extent in the highest two bits
+	Block     uint32
+	Partition uint16
+}
+
+func unmarshalUDFLongAllocation(data []byte) udfLongAllocation {
+	return udfLongAllocation{
+		Length:    binary.LittleEndian.Uint32(data[0:4]),
+		Block:     binary.LittleEndian.Uint32(data[4:8]),
+		Partition: binary.LittleEndian.Uint16(data[8:10]),
+	}
+}
+
+// decodeUDFString decodes OSTA compressed Unicode (UDF 2.1.1), in which the first byte
+// tells whether the characters take 8 or 16 bits
+func decodeUDFString(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	switch data[0] {
+	case 8, 254:
+		runes := make([]rune, len(data)-1)
+		for i, b := range data[1:] {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case 16, 255:
+		units := make([]uint16, (len(data)-1)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(data[1+2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+
+	return ""
+}
+
+// decodeUDFDString decodes a dstring, a field of fixed size whose last byte holds the length of the string
+func decodeUDFDString(data []byte) string {
+	length := int(data[len(data)-1])
+	if length == 0 || length >= len(data) {
+		return ""
+	}
+	return decodeUDFString(data[:length])
+}
+
+// decodeUDFTimestamp decodes a timestamp of ECMA-167 1/7.3
+func decodeUDFTimestamp(data []byte) time.Time {
+	typeAndZone := binary.LittleEndian.Uint16(data[0:2])
+	year := int16(binary.LittleEndian.Uint16(data[2:4]))
+	if year == 0 && data[4] == 0 {
+		return time.Time{}
+	}
+
+	location := time.UTC
+	// the offset from UTC in minutes is a signed 12-bit number, -2047 means it isn't specified
+	if offset := int16(typeAndZone<<4) >> 4; typeAndZone>>12 == 1 && offset != -2047 {
+		location = time.FixedZone("", int(offset)*60)
+	}
+
+	nanoseconds := int(data[9])*10000000 + int(data[10])*100000 + int(data[11])*1000
+	return time.Date(int(year), time.Month(data[4]), int(data[5]), int(data[6]), int(data[7]), int(data[8]), nanoseconds, location)
+}
+
+// udfPartition is the part of the image holding the logical blocks of a partition
+type udfPartition struct {
+	Number uint16
+	Start  uint32
+	Length uint32
+}
+
+// udfVolume is the logical volume of a UDF file system
+type udfVolume struct {
+	ra         io.ReaderAt
+	identifier string
+	partitions []udfPartition // by partition reference number, in the order of the partition maps
+	fileSet    udfLongAllocation
+}
+
+// readUDFVolume finds the logical volume of the UDF file system through the anchor at sector 256
+func readUDFVolume(ra io.ReaderAt) (*udfVolume, error) {
+	anchor := make([]byte, sectorSize)
+	if _, err := ra.ReadAt(anchor, udfAnchorSector*int64(sectorSize)); err != nil {
+		return nil, fmt.Errorf("no UDF anchor volume descriptor pointer: %w", os.ErrNotExist)
+	}
+	if tag, err := unmarshalUDFTag(anchor); err != nil || tag.Identifier != udfTagAnchor || tag.Location != udfAnchorSector {
+		return nil, fmt.Errorf("no UDF anchor volume descriptor pointer: %w", os.ErrNotExist)
+	}
+
+	// the reserve sequence is a copy of the main one
+	var err error
+	for _, extent := range []udfExtent{unmarshalUDFExtent(anchor[16:24]), unmarshalUDFExtent(anchor[24:32])} {
+		var volume *udfVolume
+		if volume, err = readUDFVolumeDescriptorSequence(ra, extent); err == nil {
+			return volume, nil
+		}
+	}
+
+	return nil, fmt.Errorf("reading UDF volume descriptor sequence: %w", err)
+}
+
+// readUDFVolumeDescriptorSequence reads the partition and logical volume descriptors
+// of a volume descriptor sequence, see ECMA-167 3/8.4
+func readUDFVolumeDescriptorSequence(ra io.ReaderAt, extent udfExtent) (*udfVolume, error) {
+	var logicalVolume []byte
+	partitions := make(map[uint16]udfPartition)
+
+	buffer := make([]byte, sectorSize)
+	sector, remaining := extent.Location, extent.Length
+sequence:
+	for descriptors := 0; remaining >= sectorSize; descriptors++ {
+		if descriptors > udfMaxVolumeDescriptors {
+			return nil, fmt.Errorf("the UDF volume descriptor sequence is too long")
+		}
+
+		if _, err := ra.ReadAt(buffer, int64(sector)*int64(sectorSize)); err != nil {
+			return nil, err
+		}
+		tag, err := unmarshalUDFTag(buffer)
+		if err != nil {
+			return nil, err
+		}
+		if tag.Location != sector {
+			return nil, fmt.Errorf("UDF descriptor at sector %d is recorded for sector %d", sector, tag.Location)
+		}
+
+		switch tag.Identifier {
+		case udfTagPartition:
+			number := binary.LittleEndian.Uint16(buffer[22:24])
+			partitions[number] = udfPartition{
+				Number: number,
+				Start:  binary.LittleEndian.Uint32(buffer[188:192]),
+				Length: binary.LittleEndian.Uint32(buffer[192:196]),
+			}
+		case udfTagLogicalVolume:
+			logicalVolume = append([]byte(nil), buffer...)
+		case udfTagVolumePointer:
+			// the sequence continues elsewhere
+			next := unmarshalUDFExtent(buffer[20:28])
+			sector, remaining = next.Location, next.Length
+			continue
+		case udfTagTerminating:
+			break sequence
+		}
+		sector, remaining = sector+1, remaining-sectorSize
+	}
+
+	if logicalVolume == nil {
+		return nil, fmt.Errorf("the UDF volume has no logical volume descriptor")
+	}
+	if blockSize := binary.LittleEndian.Uint32(logicalVolume[212:216]); blockSize != sectorSize {
+		return nil, fmt.Errorf("UDF logical block size %d is not supported", blockSize)
+	}
+
+	volume := &udfVolume{
+		ra:         ra,
+		identifier: decodeUDFDString(logicalVolume[84:212]),
+		fileSet:    unmarshalUDFLongAllocation(logicalVolume[248:264]),
+	}
+
+	mapTableLength := binary.LittleEndian.Uint32(logicalVolume[264:268])
+	mapCount := binary.LittleEndian.Uint32(logicalVolume[268:272])
+	maps := logicalVolume[440:]
+	if mapTableLength > uint32(len(maps)) {
+		return nil, fmt.Errorf("UDF partition map table of %d bytes is too large", mapTableLength)
+	}
+	maps = maps[:mapTableLength]
+
+	for n := uint32(0); n < mapCount; n++ {
+		if len(maps) < 2 || int(maps[1]) > len(maps) || maps[1] < 2 {
+			return nil, fmt.Errorf("UDF partition map %d is truncated", n)
+		}
+		if maps[0] != 1 || maps[1] != 6 {
+			// virtual, sparable and metadata partitions come as type 2 maps
+			return nil, fmt.Errorf("UDF partition map of type %d is not supported", maps[0])
+		}
+
+		number := binary.LittleEndian.Uint16(maps[4:6])
+		partition, ok := partitions[number]
+		if !ok {
+			return nil, fmt.Errorf("UDF partition %d has no partition descriptor", number)
+		}
+		volume.partitions = append(volume.partitions, partition)
+		maps = maps[maps[1]:]
+	}
+
+	return volume, nil
+}
+
+// blockOffset returns the position within the image of a logical block of a partition
+func (v *udfVolume) blockOffset(partition uint16, block uint32) (int64, error) {
+	if int(partition) >= len(v.partitions) {
+		return 0, fmt.Errorf("UDF partition reference %d is out of range", partition)
+	}
+	p := v.partitions[partition]
+	if block >= p.Length {
+		return 0, fmt.Errorf("UDF logical block %d is out of range of partition %d", block, p.Number)
+	}
+	return (int64(p.Start) + int64(block)) * int64(sectorSize), nil
+}
+
+// readBlock reads the logical block holding a descriptor of the given type
+func (v *udfVolume) readBlock(partition uint16, block uint32, identifiers ...uint16) ([]byte, uint16, error) {
+	offset, err := v.blockOffset(partition, block)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	buffer := make([]byte, sectorSize)
+	if _, err := v.ra.ReadAt(buffer, offset); err != nil {
+		return nil, 0, err
+	}
+	tag, err := unmarshalUDFTag(buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if tag.Location != block {
+		return nil, 0, fmt.Errorf("UDF descriptor at block %d is recorded for block %d", block, tag.Location)
+	}
+
+	for _, identifier := range identifiers {
+		if tag.Identifier == identifier {
+			return buffer, tag.Identifier, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("unexpected UDF descriptor %d at block %d", tag.Identifier, block)
+}
+
+// rootDirectory reads the file set descriptor and the file entry of the root directory it points to
+func (v *udfVolume) rootDirectory() (*UDFFile, error) {
+	fsd, _, err := v.readBlock(v.fileSet.Partition, v.fileSet.Block, udfTagFileSet)
+	if err != nil {
+		return nil, fmt.Errorf("reading UDF file set descriptor: %w", err)
+	}
+
+	entry, err := v.readFileEntry(unmarshalUDFLongAllocation(fsd[400:416]))
+	if err != nil {
+		return nil, fmt.Errorf("reading UDF root directory: %w", err)
+	}
+	if entry.fileType != udfFileTypeDirectory {
+		return nil, fmt.Errorf("the UDF root directory is not a directory")
+	}
+
+	return &UDFFile{volume: v, entry: entry}, nil
+}
+
+// udfFileEntry holds the parts of a (extended) file entry, ECMA-167 4/14.9 and 4/14.17
+type udfFileEntry struct {
+	fileType    byte
+	icbFlags    uint16
+	uid         uint32
+	gid         uint32
+	permissions uint32
+	links       uint16
+	length      int64
+	modTime     time.Time
+
+	// the contents are either embedded in the file entry or recorded in the extents
+	embedded []byte
+	sections []fileSection
+}
+
+// readFileEntry reads the file entry found at the given ICB along with its allocation descriptors
+func (v *udfVolume) readFileEntry(icb udfLongAllocation) (*udfFileEntry, error) {
+	data, identifier, err := v.readBlock(icb.Partition, icb.Block, udfTagFileEntry, udfTagExtendedFileEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &udfFileEntry{
+		fileType:    data[27],
+		icbFlags:    binary.LittleEndian.Uint16(data[34:36]),
+		uid:         binary.LittleEndian.Uint32(data[36:40]),
+		gid:         binary.LittleEndian.Uint32(data[40:44]),
+		permissions: binary.LittleEndian.Uint32(data[44:48]),
+		links:       binary.LittleEndian.Uint16(data[48:50]),
+		length:      int64(binary.LittleEndian.Uint64(data[56:64])),
+	}
+
+	// the extended file entry has some more fields
+	headerSize, modTimeOffset := 176, 84
+	if identifier == udfTagExtendedFileEntry {
+		headerSize, modTimeOffset = 216, 92
+	}
+	entry.modTime = decodeUDFTimestamp(data[modTimeOffset : modTimeOffset+12])
+
+	extendedAttributesLength := binary.LittleEndian.Uint32(data[headerSize-8 : headerSize-4])
+	allocationLength := binary.LittleEndian.Uint32(data[headerSize-4 : headerSize])
+	if uint64(headerSize)+uint64(extendedAttributesLength)+uint64(allocationLength) > uint64(sectorSize) {
+		return nil, fmt.Errorf("UDF file entry at block %d is too large", icb.Block)
+	}
+	descriptors := data[headerSize+int(extendedAttributesLength) : headerSize+int(extendedAttributesLength)+int(allocationLength)]
+
+	if entry.length < 0 {
+		return nil, fmt.Errorf("UDF file entry at block %d has an invalid length", icb.Block)
+	}
+
+	if entry.icbFlags&7 == udfAllocationEmbedded {
+		if entry.length > int64(len(descriptors)) {
+			return nil, fmt.Errorf("UDF file entry at block %d embeds fewer bytes than its length", icb.Block)
+		}
+		entry.embedded = descriptors[:entry.length]
+		return entry, nil
+	}
+
+	if err := v.readAllocationDescriptors(entry, descriptors, icb.Partition); err != nil {
+		return nil, fmt.Errorf("UDF file entry at block %d: %w", icb.Block, err)
+	}
+	return entry, nil
+}
+
+// readAllocationDescriptors turns the allocation descriptors into the sections of the file's contents,
+// following the allocation extent descriptors they continue in
+func (v *udfVolume) readAllocationDescriptors(entry *udfFileEntry, descriptors []byte, partition uint16) error {
+	var size int
+	switch entry.icbFlags & 7 {
+	case udfAllocationShort:
+		size = 8
+	case udfAllocationLong:
+		size = 16
+	default:
+		return fmt.Errorf("allocation descriptors of type %d are not supported", entry.icbFlags&7)
+	}
+
+	var offset int64
+	for extents := 0; offset < entry.length; {
+		if len(descriptors) < size {
+			return fmt.Errorf("the extents hold fewer bytes than the length of the file")
+		}
+
+		ad := udfLongAllocation{
+			Length:    binary.LittleEndian.Uint32(descriptors[0:4]),
+			Block:     binary.LittleEndian.Uint32(descriptors[4:8]),
+			Partition: partition,
+		}
+		if size == 16 {
+			ad.Partition = binary.LittleEndian.Uint16(descriptors[8:10])
+		}
+		descriptors = descriptors[size:]
+
+		length := int64(ad.Length & udfExtentLengthMask)
+		if length == 0 {
+			return fmt.Errorf("the extents hold fewer bytes than the length of the file")
+		}
+
+		switch ad.Length >> 30 {
+		case udfExtentNext:
+			if extents++; extents > udfMaxAllocationExtents {
+				return fmt.Errorf("too many allocation extent descriptors")
+			}
+			aed, _, err := v.readBlock(ad.Partition, ad.Block, udfTagAllocationExtent)
+			if err != nil {
+				return err
+			}
+			descriptorsLength := binary.LittleEndian.Uint32(aed[20:24])
+			if descriptorsLength > sectorSize-24 {
+				return fmt.Errorf("allocation extent descriptor at block %d is too large", ad.Block)
+			}
+			descriptors = aed[24 : 24+descriptorsLength]
+			continue
+		case udfExtentRecorded:
+			start, err := v.blockOffset(ad.Partition, ad.Block)
+			if err != nil {
+				return err
+			}
+			if _, err := v.blockOffset(ad.Partition, ad.Block+uint32((length-1)/int64(sectorSize))); err != nil {
+				return err
+			}
+			entry.sections = append(entry.sections, fileSection{offset: offset, length: length, ra: io.NewSectionReader(v.ra, start, length)})
+		default:
+			// extents which aren't recorded read as zeros
+			entry.sections = append(entry.sections, fileSection{offset: offset, length: length, ra: zeroReaderAt{}})
+		}
+		offset += length
+	}
+
+	return nil
+}
+
+// zeroReaderAt reads zeros only
+type zeroReaderAt struct{}
+
+func (zeroReaderAt) ReadAt(p []byte, _ int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// UDFRootDir returns the root directory of the UDF file system recorded in the image,
+// which is found through the anchor volume descriptor pointer at sector 256.
+// If there is no UDF file system, it returns an error wrapping os.ErrNotExist.
+func (i *Image) UDFRootDir() (*UDFFile, error) {
+	volume, err := readUDFVolume(i.ra)
+	if err != nil {
+		return nil, err
+	}
+
+	return volume.rootDirectory()
+}
+
+// UDFLabel returns the identifier of the UDF logical volume
+func (i *Image) UDFLabel() (string, error) {
+	volume, err := readUDFVolume(i.ra)
+	if err != nil {
+		return "", err
+	}
+
+	return volume.identifier, nil
+}
+
+// UDFFile is a file or directory of the UDF file system of an image.
+// It offers the same methods as File and implements fs.FileInfo.
+type UDFFile struct {
+	volume   *udfVolume
+	name     string
+	entry    *udfFileEntry
+	children []*UDFFile
+}
+
+var _ os.FileInfo = &UDFFile{}
+
+// Name returns the base name of the file, which is empty for the root directory
+func (f *UDFFile) Name() string {
+	return f.name
+}
+
+// Size returns the size of the file's contents in bytes
+func (f *UDFFile) Size() int64 {
+	return f.entry.length
+}
+
+// IsDir returns true if the entry is a directory or false otherwise
+func (f *UDFFile) IsDir() bool {
+	return f.entry.fileType == udfFileTypeDirectory
+}
+
+// ModTime returns the modification time of the file
+func (f *UDFFile) ModTime() time.Time {
+	return f.entry.modTime
+}
+
+// Mode returns the type and the permissions of the file. The permissions to change
+// the attributes of the file and to delete it, which UDF records as well, are left out.
+func (f *UDFFile) Mode() os.FileMode {
+	// UDF records the permissions of other users in the lowest bits, followed by those of the group and the owner,
+	// each taking 5 bits of which the lowest 3 match those of POSIX
+	p := f.entry.permissions
+	mode := os.FileMode(p>>10&7<<6 | p>>5&7<<3 | p&7)
+
+	switch f.entry.fileType {
+	case udfFileTypeDirectory:
+		mode |= os.ModeDir
+	case udfFileTypeSymlink:
+		mode |= os.ModeSymlink
+	}
+
+	if f.entry.icbFlags&(1<<6) != 0 {
+		mode |= os.ModeSetuid
+	}
+	if f.entry.icbFlags&(1<<7) != 0 {
+		mode |= os.ModeSetgid
+	}
+	if f.entry.icbFlags&(1<<8) != 0 {
+		mode |= os.ModeSticky
+	}
+
+	return mode
+}
+
+// Sys returns the *PosixAttributes recorded in the file entry
+func (f *UDFFile) Sys() interface{} {
+	return &PosixAttributes{
+		Mode:  f.Mode(),
+		Links: uint32(f.entry.links),
+		UID:   f.entry.uid,
+		GID:   f.entry.gid,
+	}
+}
+
+// Open returns a FileReader of the file's contents.
+// If UDFFile is a directory, it returns an error wrapping ErrIsDirectory.
+func (f *UDFFile) Open() (*FileReader, error) {
+	if f.IsDir() {
+		return nil, fmt.Errorf("%s: %w", f.Name(), ErrIsDirectory)
+	}
+
+	return &FileReader{sr: f.sectionReader()}, nil
+}
+
+// Reader returns a reader that allows to read the file's data.
+// If UDFFile is a directory, reading from it fails with an error wrapping ErrIsDirectory.
+func (f *UDFFile) Reader() io.Reader {
+	fr, err := f.Open()
+	if err != nil {
+		return &errorReader{err: err}
+	}
+	return fr
+}
+
+func (f *UDFFile) sectionReader() *io.SectionReader {
+	if f.entry.embedded != nil {
+		return io.NewSectionReader(bytes.NewReader(f.entry.embedded), 0, f.entry.length)
+	}
+
+	return io.NewSectionReader(&multiExtentReaderAt{sections: f.entry.sections, size: f.entry.length}, 0, f.entry.length)
+}
+
+// Readlink returns the target of a symbolic link, which UDF records as path components, see ECMA-167 4/14.16
+func (f *UDFFile) Readlink() (string, error) {
+	if f.entry.fileType != udfFileTypeSymlink {
+		return "", fmt.Errorf("%s is not a symbolic link", f.Name())
+	}
+
+	data, err := io.ReadAll(f.sectionReader())
+	if err != nil {
+		return "", err
+	}
+
+	var components []string
+	absolute := false
+	for len(data) > 0 {
+		if len(data) < 4 || len(data) < 4+int(data[1]) {
+			return "", fmt.Errorf("the target of %s is truncated", f.Name())
+		}
+		identifier := data[4 : 4+int(data[1])]
+
+		switch data[0] {
+		case 1, 2:
+			absolute, components = true, nil
+		case 3:
+			components = append(components, "..")
+		case 4:
+			components = append(components, ".")
+		case 5:
+			components = append(components, decodeUDFString(identifier))
+		default:
+			return "", fmt.Errorf("the target of %s has a path component of unknown type %d", f.Name(), data[0])
+		}
+		data = data[4+len(identifier):]
+	}
+
+	target := strings.Join(components, "/")
+	if absolute {
+		target = path.Join("/", target)
+	}
+	return target, nil
+}
+
+// GetChildren returns the files and directories within a directory, leaving out its parent.
+// The result is cached for subsequent calls.
+func (f *UDFFile) GetChildren() ([]*UDFFile, error) {
+	if !f.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", f.Name())
+	}
+	if f.children != nil {
+		return f.children, nil
+	}
+
+	data, err := io.ReadAll(f.sectionReader())
+	if err != nil {
+		return nil, fmt.Errorf("reading UDF directory %q: %w", f.Name(), err)
+	}
+
+	children := []*UDFFile{}
+	for len(data) > 0 {
+		// file identifier descriptors, ECMA-167 4/14.4
+		if len(data) < 38 {
+			return nil, fmt.Errorf("UDF directory %q has a truncated file identifier descriptor", f.Name())
+		}
+		identifierLength := int(data[19])
+		implementationUseLength := int(binary.LittleEndian.Uint16(data[36:38]))
+		length := (38 + implementationUseLength + identifierLength + 3) &^ 3
+		if length > len(data) {
+			return nil, fmt.Errorf("UDF directory %q has a truncated file identifier descriptor", f.Name())
+		}
+
+		fid := data[:length]
+		data = data[length:]
+
+		tag, err := unmarshalUDFTag(fid)
+		if err != nil {
+			return nil, fmt.Errorf("UDF directory %q: %w", f.Name(), err)
+		}
+		if tag.Identifier != udfTagFileIdentifier {
+			return nil, fmt.Errorf("UDF directory %q holds unexpected descriptor %d", f.Name(), tag.Identifier)
+		}
+
+		characteristics := fid[18]
+		if characteristics&(udfCharacteristicParent|udfCharacteristicDeleted) != 0 {
+			continue
+		}
+
+		name := decodeUDFString(fid[38+implementationUseLength : 38+implementationUseLength+identifierLength])
+		entry, err := f.volume.readFileEntry(unmarshalUDFLongAllocation(fid[20:36]))
+		if err != nil {
+			return nil, fmt.Errorf("reading %q in UDF directory %q: %w", name, f.Name(), err)
+		}
+		children = append(children, &UDFFile{volume: f.volume, name: name, entry: entry})
+	}
+
+	f.children = children
+	return children, nil
+}
+
+// UDF revisions which can be passed to WithUDF
+const (
+	UDFRevision102 = 0x0102
+	UDFRevision201 = 0x0201
+)
+
+// The UDF file system of a bridge image occupies the sectors the ISO9660 file system leaves alone:
+// the volume recognition sequence directly follows the ISO9660 volume descriptors, followed by the
+// main and the reserve volume descriptor sequence and the logical volume integrity sequence.
+// The anchor at sector 256 precedes the partition, which covers the rest of the image up to the
+// second anchor in its last sector. The partition starts with the file set descriptor and the file
+// entries and directories of UDF, followed by everything ISO9660 records, so that the file entries
+// of UDF refer to the very extents of the ISO9660 files.
+const (
+	udfMainSequenceSector       = 32
+	udfReserveSequenceSector    = 48
+	udfSequenceSectors          = 16
+	udfIntegritySequenceSector  = 64
+	udfIntegritySequenceSectors = 2
+	udfPartitionStart           = udfAnchorSector + 1
+
+	udfFileEntrySize            = 176
+	udfMaxExtentLength          = udfExtentLengthMask &^ (sectorSize - 1)
+	udfMaxIdentifierLength      = 255
+	udfImplementationIdentifier = "*kdomanski/iso9660"
+	udfDomainIdentifier         = "*OSTA UDF Compliant"
+)
+
+// WithUDF makes the ImageWriter record a UDF file system of the given revision, UDFRevision102 or UDFRevision201,
+// alongside the ISO9660 one. The file entries of UDF refer to the extents of the ISO9660 files,
+// so that the data is only recorded once. UDF preserves the original names of up to 255 bytes,
+// POSIX attributes and symbolic links regardless of Rock Ridge. Files larger than 4GB still require
+// WithInterchangeLevel(3). UDF can neither be combined with zisofs compression nor with appending a session.
+func WithUDF(revision int) WriterOption {
+	return func(iw *ImageWriter) {
+		iw.udfRevision = revision
+	}
+}
+
+// encodeUDFString encodes OSTA compressed Unicode of at most maxLength bytes, truncating longer strings.
+// Characters take 16 bits only if any of them requires it.
+func encodeUDFString(s string, maxLength int) []byte {
+	wide := false
+	for _, r := range s {
+		if r > 0xFF {
+			wide = true
+			break
+		}
+	}
+
+	if !wide {
+		encoded := []byte{8}
+		for _, r := range s {
+			if len(encoded) == maxLength {
+				break
+			}
+			encoded = append(encoded, byte(r))
+		}
+		return encoded
+	}
+
+	encoded := []byte{16}
+	for _, r := range s {
+		units := utf16.Encode([]rune{r})
+		if len(encoded)+2*len(units) > maxLength {
+			break
+		}
+		for _, u := range units {
+			encoded = binary.BigEndian.AppendUint16(encoded, u)
+		}
+	}
+	return encoded
+}
+
+// encodeUDFDString fills a dstring field, whose last byte holds the length of the string
+func encodeUDFDString(field []byte, s string) {
+	if s == "" {
+		return
+	}
+	encoded := encodeUDFString(s, len(field)-1)
+	copy(field, encoded)
+	field[len(field)-1] = byte(len(encoded))
+}
+
+// encodeUDFTimestamp fills a timestamp field of ECMA-167 1/7.3
+func encodeUDFTimestamp(field []byte, t time.Time) {
+	_, offset := t.Zone()
+	binary.LittleEndian.PutUint16(field[0:2], 1<<12|uint16(offset/60)&0xFFF)
+	binary.LittleEndian.PutUint16(field[2:4], uint16(t.Year()))
+	field[4] = byte(t.Month())
+	field[5] = byte(t.Day())
+	field[6] = byte(t.Hour())
+	field[7] = byte(t.Minute())
+	field[8] = byte(t.Second())
+	field[9] = byte(t.Nanosecond() / 10000000)
+	field[10] = byte(t.Nanosecond() / 100000 % 100)
+	field[11] = byte(t.Nanosecond() / 1000 % 100)
+}
+
+// encodeUDFCharspec fills a charspec field with the OSTA compressed Unicode character set
+func encodeUDFCharspec(field []byte) {
+	field[0] = 0
+	copy(field[1:], "OSTA Compressed Unicode")
+}
+
+// encodeUDFRegid fills an entity identifier field of ECMA-167 1/7.4
+func encodeUDFRegid(field []byte, identifier string, suffix ...byte) {
+	copy(field[1:24], identifier)
+	copy(field[24:32], suffix)
+}
+
+// marshalUDFDescriptor completes a descriptor with its tag
+func marshalUDFDescriptor(identifier uint16, version uint16, location uint32, descriptor []byte) []byte {
+	binary.LittleEndian.PutUint16(descriptor[0:2], identifier)
+	binary.LittleEndian.PutUint16(descriptor[2:4], version)
+	binary.LittleEndian.PutUint16(descriptor[10:12], uint16(len(descriptor)-udfTagSize))
+	binary.LittleEndian.PutUint32(descriptor[12:16], location)
+	binary.LittleEndian.PutUint16(descriptor[8:10], udfCRC(descriptor[udfTagSize:]))
+
+	var checksum byte
+	for i := 0; i < udfTagSize; i++ {
+		if i != 4 {
+			checksum += descriptor[i]
+		}
+	}
+	descriptor[4] = checksum
+	return descriptor
+}
+
+// udfShortAllocationDescriptor encodes a short_ad of ECMA-167 4/14.14.1 of a recorded extent
+func udfShortAllocationDescriptor(length uint32, block uint32) []byte {
+	ad := make([]byte, 8)
+	binary.LittleEndian.PutUint32(ad[0:4], length)
+	binary.LittleEndian.PutUint32(ad[4:8], block)
+	return ad
+}
+
+// udfFileIdentifierLength returns the size of a file identifier descriptor, which is padded to 4 bytes
+func udfFileIdentifierLength(identifierLength int) uint32 {
+	return uint32(38+identifierLength+3) &^ 3
+}
+
+// udfNode is a staged file or directory recorded in the UDF file system
+type udfNode struct {
+	stagedPath string
+	identifier []byte // the original name in OSTA compressed Unicode, empty for the root directory
+	isDir      bool
+	uniqueID   uint64
+	parent     *udfNode
+	children   []*udfNode
+
+	// the block of the file entry and, for directories, those of the file identifier descriptors
+	entryBlock   uint32
+	streamBlock  uint32
+	streamLength uint32
+}
+
+// udfLayout is the UDF file system of an image being written
+type udfLayout struct {
+	revision     int
+	nodes        []*udfNode // in the order of their blocks
+	nextUniqueID uint64
+	files        uint32
+	directories  uint32
+
+	partitionLength uint32
+}
+
+// layoutUDF allocates the blocks of the file set descriptor and of the file entries and directories,
+// which have to come first in the partition
+func (wc *writeContext) layoutUDF(revision int) (*udfLayout, error) {
+	// unique IDs up to 15 are reserved, the root directory takes 0
+	layout := &udfLayout{revision: revision, nextUniqueID: 16}
+
+	// the file set descriptor and the terminating descriptor of its sequence
+	wc.allocateSectors(2)
+
+	root := &udfNode{stagedPath: wc.stagingDir, isDir: true}
+	root.parent = root
+	if err := layout.addNode(wc, root); err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+func (ul *udfLayout) addNode(wc *writeContext, node *udfNode) error {
+	node.entryBlock = wc.allocateSectors(1) - udfPartitionStart
+	ul.nodes = append(ul.nodes, node)
+
+	if !node.isDir {
+		ul.files++
+		return nil
+	}
+	ul.directories++
+
+	contents, err := os.ReadDir(node.stagedPath)
+	if err != nil {
+		return err
+	}
+
+	// the first file identifier descriptor points to the parent
+	node.streamLength = udfFileIdentifierLength(0)
+	for _, c := range contents {
+		childPath := path.Join(node.stagedPath, c.Name())
+		child := &udfNode{
+			stagedPath: childPath,
+			identifier: encodeUDFString(wc.originalName(childPath), udfMaxIdentifierLength),
+			isDir:      c.IsDir(),
+			uniqueID:   ul.nextUniqueID,
+			parent:     node,
+		}
+		ul.nextUniqueID++
+		node.children = append(node.children, child)
+		node.streamLength += udfFileIdentifierLength(len(child.identifier))
+	}
+	node.streamBlock = wc.allocateSectors(fileLengthToSectors(node.streamLength)) - udfPartitionStart
+
+	for _, child := range node.children {
+		if err := ul.addNode(wc, child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// descriptorVersion returns the version of the descriptor tags, which depends on the revision of UDF
+func (ul *udfLayout) descriptorVersion() uint16 {
+	if ul.revision >= UDFRevision201 {
+		return 3
+	}
+	return 2
+}
+
+func (ul *udfLayout) descriptor(identifier uint16, location uint32, descriptor []byte) []byte {
+	return marshalUDFDescriptor(identifier, ul.descriptorVersion(), location, descriptor)
+}
+
+// revisionSuffix is the suffix of the entity identifiers which refer to the revision of UDF
+func (ul *udfLayout) revisionSuffix() []byte {
+	return []byte{byte(ul.revision), byte(ul.revision >> 8)}
+}
+
+// writeVolumeStructures writes the sectors from the given one, which follows the ISO9660 volume descriptors,
+// up to the start of the partition. They hold the volume recognition sequence, the volume descriptor sequences,
+// the logical volume integrity sequence and the anchor at sector 256.
+func (ul *udfLayout) writeVolumeStructures(w io.Writer, firstSector uint32, volumeIdentifier string, now time.Time) error {
+	area := make([]byte, (udfPartitionStart-firstSector)*sectorSize)
+	sector := func(n uint32) []byte {
+		return area[(n-firstSector)*sectorSize : (n-firstSector+1)*sectorSize]
+	}
+
+	nsr := "NSR02"
+	if ul.revision >= UDFRevision201 {
+		nsr = "NSR03"
+	}
+	for i, identifier := range []string{udfIdentifier, nsr, "TEA01"} {
+		vsd := sector(firstSector + uint32(i))
+		copy(vsd[1:6], identifier)
+		vsd[6] = 1
+	}
+
+	for _, start := range []uint32{udfMainSequenceSector, udfReserveSequenceSector} {
+		for i, descriptor := range ul.volumeDescriptorSequence(start, volumeIdentifier, now) {
+			copy(sector(start+uint32(i)), descriptor)
+		}
+	}
+
+	copy(sector(udfIntegritySequenceSector), ul.integrityDescriptor(now))
+	copy(sector(udfIntegritySequenceSector+1), ul.descriptor(udfTagTerminating, udfIntegritySequenceSector+1, make([]byte, 512)))
+
+	copy(sector(udfAnchorSector), ul.anchor(udfAnchorSector))
+
+	_, err := w.Write(area)
+	return err
+}
+
+// volumeDescriptorSequence returns the descriptors of a volume descriptor sequence starting at the given sector
+func (ul *udfLayout) volumeDescriptorSequence(start uint32, volumeIdentifier string, now time.Time) [][]byte {
+	pvd := make([]byte, 512)
+	encodeUDFDString(pvd[24:56], volumeIdentifier)
+	binary.LittleEndian.PutUint16(pvd[56:58], 1) // volume sequence number
+	binary.LittleEndian.PutUint16(pvd[58:60], 1) // maximum volume sequence number
+	binary.LittleEndian.PutUint16(pvd[60:62], 2) // interchange level
+	binary.LittleEndian.PutUint16(pvd[62:64], 2) // maximum interchange level
+	binary.LittleEndian.PutUint32(pvd[64:68], 1) // character set list
+	binary.LittleEndian.PutUint32(pvd[68:72], 1) // maximum character set list
+	// the volume set identifier starts with a unique hexadecimal number, see UDF 2.2.2.5
+	encodeUDFDString(pvd[72:200], fmt.Sprintf("%016X", now.UnixNano()))
+	encodeUDFCharspec(pvd[200:264])
+	encodeUDFCharspec(pvd[264:328])
+	encodeUDFTimestamp(pvd[376:388], now)
+	encodeUDFRegid(pvd[388:420], udfImplementationIdentifier)
+
+	iuvd := make([]byte, 512)
+	binary.LittleEndian.PutUint32(iuvd[16:20], 1)
+	encodeUDFRegid(iuvd[20:52], "*UDF LV Info", ul.revisionSuffix()...)
+	encodeUDFCharspec(iuvd[52:116])
+	encodeUDFDString(iuvd[116:244], volumeIdentifier)
+	encodeUDFRegid(iuvd[352:384], udfImplementationIdentifier)
+
+	pd := make([]byte, 512)
+	binary.LittleEndian.PutUint32(pd[16:20], 2)
+	binary.LittleEndian.PutUint16(pd[20:22], 1) // allocated
+	nsr := "+NSR02"
+	if ul.revision >= UDFRevision201 {
+		nsr = "+NSR03"
+	}
+	encodeUDFRegid(pd[24:56], nsr)
+	binary.LittleEndian.PutUint32(pd[184:188], 1) // read-only
+	binary.LittleEndian.PutUint32(pd[188:192], udfPartitionStart)
+	binary.LittleEndian.PutUint32(pd[192:196], ul.partitionLength)
+	encodeUDFRegid(pd[196:228], udfImplementationIdentifier)
+
+	lvd := make([]byte, 446)
+	binary.LittleEndian.PutUint32(lvd[16:20], 3)
+	encodeUDFCharspec(lvd[20:84])
+	encodeUDFDString(lvd[84:212], volumeIdentifier)
+	binary.LittleEndian.PutUint32(lvd[212:216], sectorSize)
+	encodeUDFRegid(lvd[216:248], udfDomainIdentifier, ul.revisionSuffix()...)
+	binary.LittleEndian.PutUint32(lvd[248:252], sectorSize) // the file set descriptor in block 0
+	binary.LittleEndian.PutUint32(lvd[264:268], 6)
+	binary.LittleEndian.PutUint32(lvd[268:272], 1)
+	encodeUDFRegid(lvd[272:304], udfImplementationIdentifier)
+	binary.LittleEndian.PutUint32(lvd[432:436], udfIntegritySequenceSectors*sectorSize)
+	binary.LittleEndian.PutUint32(lvd[436:440], udfIntegritySequenceSector)
+	// a type 1 partition map of partition 0 on volume 1
+	copy(lvd[440:446], []byte{1, 6, 1, 0, 0, 0})
+
+	usd := make([]byte, 24)
+	binary.LittleEndian.PutUint32(usd[16:20], 4)
+
+	return [][]byte{
+		ul.descriptor(udfTagPrimaryVolume, start, pvd),
+		ul.descriptor(udfTagImplementationUse, start+1, iuvd),
+		ul.descriptor(udfTagPartition, start+2, pd),
+		ul.descriptor(udfTagLogicalVolume, start+3, lvd),
+		ul.descriptor(udfTagUnallocatedSpace, start+4, usd),
+		ul.descriptor(udfTagTerminating, start+5, make([]byte, 512)),
+	}
+}
+
+// integrityDescriptor returns the logical volume integrity descriptor, which marks the volume as closed
+func (ul *udfLayout) integrityDescriptor(now time.Time) []byte {
+	lvid := make([]byte, 134)
+	encodeUDFTimestamp(lvid[16:28], now)
+	binary.LittleEndian.PutUint32(lvid[28:32], 1) // close
+	binary.LittleEndian.PutUint64(lvid[40:48], ul.nextUniqueID)
+	binary.LittleEndian.PutUint32(lvid[72:76], 1)  // number of partitions
+	binary.LittleEndian.PutUint32(lvid[76:80], 46) // length of the implementation use
+	binary.LittleEndian.PutUint32(lvid[80:84], 0)  // free space
+	binary.LittleEndian.PutUint32(lvid[84:88], ul.partitionLength)
+	encodeUDFRegid(lvid[88:120], udfImplementationIdentifier)
+	binary.LittleEndian.PutUint32(lvid[120:124], ul.files)
+	binary.LittleEndian.PutUint32(lvid[124:128], ul.directories)
+	for _, field := range []int{128, 130, 132} {
+		binary.LittleEndian.PutUint16(lvid[field:field+2], uint16(ul.revision))
+	}
+	return ul.descriptor(udfTagIntegrity, udfIntegritySequenceSector, lvid)
+}
+
+// anchor returns the anchor volume descriptor pointer to be recorded at the given sector
+func (ul *udfLayout) anchor(location uint32) []byte {
+	avdp := make([]byte, 512)
+	binary.LittleEndian.PutUint32(avdp[16:20], udfSequenceSectors*sectorSize)
+	binary.LittleEndian.PutUint32(avdp[20:24], udfMainSequenceSector)
+	binary.LittleEndian.PutUint32(avdp[24:28], udfSequenceSectors*sectorSize)
+	binary.LittleEndian.PutUint32(avdp[28:32], udfReserveSequenceSector)
+	return ul.descriptor(udfTagAnchor, location, avdp)
+}
+
+// writeFileSet writes the beginning of the partition, which holds the file set descriptor
+// along with the file entries and the directories
+func (ul *udfLayout) writeFileSet(w io.Writer, wc *writeContext, volumeIdentifier string, now time.Time) error {
+	fsd := make([]byte, 512)
+	encodeUDFTimestamp(fsd[16:28], now)
+	binary.LittleEndian.PutUint16(fsd[28:30], 3) // interchange level
+	binary.LittleEndian.PutUint16(fsd[30:32], 3) // maximum interchange level
+	binary.LittleEndian.PutUint32(fsd[32:36], 1) // character set list
+	binary.LittleEndian.PutUint32(fsd[36:40], 1) // maximum character set list
+	encodeUDFCharspec(fsd[48:112])
+	encodeUDFDString(fsd[112:240], volumeIdentifier)
+	encodeUDFCharspec(fsd[240:304])
+	encodeUDFDString(fsd[304:336], volumeIdentifier)
+	binary.LittleEndian.PutUint32(fsd[400:404], sectorSize)
+	binary.LittleEndian.PutUint32(fsd[404:408], ul.nodes[0].entryBlock)
+	encodeUDFRegid(fsd[416:448], udfDomainIdentifier, ul.revisionSuffix()...)
+
+	sectors := [][]byte{
+		ul.descriptor(udfTagFileSet, 0, fsd),
+		ul.descriptor(udfTagTerminating, 1, make([]byte, 512)),
+	}
+	for _, data := range sectors {
+		if err := processGeneratedFile(w, data); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range ul.nodes {
+		fe, err := ul.fileEntry(wc, node)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimPrefix(node.stagedPath, wc.stagingDir), err)
+		}
+		if err := processGeneratedFile(w, fe); err != nil {
+			return err
+		}
+
+		if node.isDir {
+			if err := processGeneratedFile(w, ul.fileIdentifiers(node)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileEntry returns the file entry of a node, whose allocation descriptors point to the extents of the
+// ISO9660 file, to the file identifier descriptors of a directory or, for symbolic links, embed the target
+func (ul *udfLayout) fileEntry(wc *writeContext, node *udfNode) ([]byte, error) {
+	attrs, modTime, err := wc.posixAttributes(node.stagedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileType, flags := udfFileTypeRegular, uint16(udfAllocationShort)
+	var allocations []byte
+	var length, blocks uint64
+	switch {
+	case node.isDir:
+		fileType = udfFileTypeDirectory
+		allocations = udfShortAllocationDescriptor(node.streamLength, node.streamBlock)
+		length, blocks = uint64(node.streamLength), uint64(fileLengthToSectors(node.streamLength))
+	case attrs.Mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(node.stagedPath)
+		if err != nil {
+			return nil, err
+		}
+		fileType, flags = udfFileTypeSymlink, udfAllocationEmbedded
+		allocations = encodeUDFPathComponents(target)
+		length = uint64(len(allocations))
+	default:
+		de, ok := wc.fileEntries[node.stagedPath]
+		if !ok {
+			return nil, fmt.Errorf("the file has not been placed")
+		}
+		for _, de := range append([]*DirectoryEntry{de}, wc.extentEntries[node.stagedPath]...) {
+			// the extents of UDF are shorter than those of ISO9660
+			for location, remaining := uint32(de.ExtentLocation), de.ExtentLength; remaining > 0; {
+				extentLength := remaining
+				if extentLength > udfMaxExtentLength {
+					extentLength = udfMaxExtentLength
+				}
+				allocations = append(allocations, udfShortAllocationDescriptor(extentLength, location-udfPartitionStart)...)
+				length += uint64(extentLength)
+				blocks += uint64(fileLengthToSectors(extentLength))
+				location += extentLength / sectorSize
+				remaining -= extentLength
+			}
+		}
+	}
+
+	if len(allocations) > int(sectorSize)-udfFileEntrySize {
+		return nil, fmt.Errorf("the file entry does not fit into a logical block of UDF")
+	}
+
+	if attrs.Mode&os.ModeSetuid != 0 {
+		flags |= 1 << 6
+	}
+	if attrs.Mode&os.ModeSetgid != 0 {
+		flags |= 1 << 7
+	}
+	if attrs.Mode&os.ModeSticky != 0 {
+		flags |= 1 << 8
+	}
+
+	// a file is linked from the file identifier descriptor in its directory,
+	// a directory from those pointing to the parent in its subdirectories as well
+	links := uint16(1)
+	for _, child := range node.children {
+		if child.isDir {
+			links++
+		}
+	}
+
+	perm := uint32(attrs.Mode.Perm())
+	fe := make([]byte, udfFileEntrySize+len(allocations))
+	binary.LittleEndian.PutUint16(fe[20:22], 4) // strategy type
+	binary.LittleEndian.PutUint16(fe[24:26], 1) // maximum number of entries
+	fe[27] = fileType
+	binary.LittleEndian.PutUint16(fe[34:36], flags)
+	binary.LittleEndian.PutUint32(fe[36:40], attrs.UID)
+	binary.LittleEndian.PutUint32(fe[40:44], attrs.GID)
+	binary.LittleEndian.PutUint32(fe[44:48], perm>>6&7<<10|perm>>3&7<<5|perm&7)
+	binary.LittleEndian.PutUint16(fe[48:50], links)
+	binary.LittleEndian.PutUint64(fe[56:64], length)
+	binary.LittleEndian.PutUint64(fe[64:72], blocks)
+	encodeUDFTimestamp(fe[72:84], modTime)
+	encodeUDFTimestamp(fe[84:96], modTime)
+	encodeUDFTimestamp(fe[96:108], modTime)
+	binary.LittleEndian.PutUint32(fe[108:112], 1) // checkpoint
+	encodeUDFRegid(fe[128:160], udfImplementationIdentifier)
+	binary.LittleEndian.PutUint64(fe[160:168], node.uniqueID)
+	binary.LittleEndian.PutUint32(fe[172:176], uint32(len(allocations)))
+	copy(fe[udfFileEntrySize:], allocations)
+
+	return ul.descriptor(udfTagFileEntry, node.entryBlock, fe), nil
+}
+
+// fileIdentifiers returns the file identifier descriptors of a directory, the first of which points to its parent
+func (ul *udfLayout) fileIdentifiers(dir *udfNode) []byte {
+	stream := make([]byte, 0, dir.streamLength)
+
+	add := func(characteristics byte, identifier []byte, target *udfNode) {
+		fid := make([]byte, udfFileIdentifierLength(len(identifier)))
+		binary.LittleEndian.PutUint16(fid[16:18], 1) // file version number
+		fid[18] = characteristics
+		fid[19] = byte(len(identifier))
+		binary.LittleEndian.PutUint32(fid[20:24], sectorSize)
+		binary.LittleEndian.PutUint32(fid[24:28], target.entryBlock)
+		if ul.revision >= UDFRevision201 {
+			// the implementation use of the ICB holds the lower bits of the unique ID, see UDF 2.3.4.3
+			binary.LittleEndian.PutUint32(fid[32:36], uint32(target.uniqueID))
+		}
+		copy(fid[38:], identifier)
+
+		location := dir.streamBlock + uint32(len(stream))/sectorSize
+		stream = append(stream, ul.descriptor(udfTagFileIdentifier, location, fid)...)
+	}
+
+	add(udfCharacteristicDirectory|udfCharacteristicParent, nil, dir.parent)
+	for _, child := range dir.children {
+		var characteristics byte
+		if child.isDir {
+			characteristics = udfCharacteristicDirectory
+		}
+		add(characteristics, child.identifier, child)
+	}
+
+	return stream
+}
+
+// encodeUDFPathComponents encodes the target of a symbolic link, see ECMA-167 4/14.16
+func encodeUDFPathComponents(target string) []byte {
+	var encoded []byte
+	if strings.HasPrefix(target, "/") {
+		encoded = append(encoded, 2, 0, 0, 0)
+	}
+
+	for _, component := range strings.Split(target, "/") {
+		switch component {
+		case "":
+		case ".":
+			encoded = append(encoded, 4, 0, 0, 0)
+		case "..":
+			encoded = append(encoded, 3, 0, 0, 0)
+		default:
+			identifier := encodeUDFString(component, udfMaxIdentifierLength)
+			encoded = append(append(encoded, 5, byte(len(identifier)), 0, 0), identifier...)
+		}
+	}
+
+	return encoded
+}
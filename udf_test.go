@@ -0,0 +1,534 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// udfDescriptor completes a descriptor with the tag of UDF 1.02
+func udfDescriptor(identifier uint16, location uint32, descriptor []byte) []byte {
+	return marshalUDFDescriptor(identifier, 2, location, descriptor)
+}
+
+// udfTestString encodes OSTA compressed Unicode, using 16 bits per character only if necessary
+func udfTestString(s string) []byte {
+	for _, r := range s {
+		if r > 0xFF {
+			encoded := []byte{16}
+			for _, u := range utf16.Encode([]rune(s)) {
+				encoded = binary.BigEndian.AppendUint16(encoded, u)
+			}
+			return encoded
+		}
+	}
+
+	encoded := []byte{8}
+	for _, r := range s {
+		encoded = append(encoded, byte(r))
+	}
+	return encoded
+}
+
+func udfShortAllocation(length uint32, extentType uint32, block uint32) []byte {
+	ad := make([]byte, 8)
+	binary.LittleEndian.PutUint32(ad[0:4], extentType<<30|length)
+	binary.LittleEndian.PutUint32(ad[4:8], block)
+	return ad
+}
+
+func udfLongAllocationBytes(length uint32, block uint32) []byte {
+	ad := make([]byte, 16)
+	binary.LittleEndian.PutUint32(ad[0:4], length)
+	binary.LittleEndian.PutUint32(ad[4:8], block)
+	return ad
+}
+
+// udfTestFileEntry encodes a file entry or an extended file entry with 0755 permissions, modified at testUDFTime
+func udfTestFileEntry(location uint32, extended bool, fileType byte, flags uint16, length int, allocations []byte) []byte {
+	headerSize, modTimeOffset, identifier := 176, 84, udfTagFileEntry
+	if extended {
+		headerSize, modTimeOffset, identifier = 216, 92, udfTagExtendedFileEntry
+	}
+
+	fe := make([]byte, headerSize+len(allocations))
+	fe[27] = fileType
+	binary.LittleEndian.PutUint16(fe[34:36], flags)
+	binary.LittleEndian.PutUint32(fe[36:40], 1000)
+	binary.LittleEndian.PutUint32(fe[40:44], 100)
+	binary.LittleEndian.PutUint32(fe[44:48], 7<<10|5<<5|5)
+	binary.LittleEndian.PutUint16(fe[48:50], 1)
+	binary.LittleEndian.PutUint64(fe[56:64], uint64(length))
+
+	// 2023-04-05 06:07:08.09 at UTC+1
+	ts := fe[modTimeOffset : modTimeOffset+12]
+	binary.LittleEndian.PutUint16(ts[0:2], 1<<12|60)
+	binary.LittleEndian.PutUint16(ts[2:4], 2023)
+	copy(ts[4:], []byte{4, 5, 6, 7, 8, 9, 0, 0})
+
+	binary.LittleEndian.PutUint32(fe[headerSize-4:headerSize], uint32(len(allocations)))
+	copy(fe[headerSize:], allocations)
+	return udfDescriptor(identifier, location, fe)
+}
+
+var testUDFTime = time.Date(2023, 4, 5, 6, 7, 8, 90000000, time.FixedZone("", 3600))
+
+// udfTestFID encodes a file identifier descriptor
+func udfTestFID(characteristics byte, name string, icb uint32) []byte {
+	var identifier []byte
+	if name != "" {
+		identifier = udfTestString(name)
+	}
+
+	fid := make([]byte, (38+len(identifier)+3)&^3)
+	fid[18] = characteristics
+	fid[19] = byte(len(identifier))
+	copy(fid[20:36], udfLongAllocationBytes(sectorSize, icb))
+	copy(fid[38:], identifier)
+	return udfDescriptor(udfTagFileIdentifier, 2, fid)
+}
+
+// udfTestImage is a bridge image, whose ISO9660 and UDF file systems both hold README.TXT
+type udfTestImage struct {
+	sectors map[uint32][]byte
+	size    uint32
+}
+
+const udfTestPartitionStart = 257
+
+var udfTestReadme = []byte(strings.Repeat(loremIpsum, int(sectorSize)/len(loremIpsum)+1)[:sectorSize])
+
+func newUDFTestImage(t *testing.T) *udfTestImage {
+	img := &udfTestImage{sectors: make(map[uint32][]byte), size: udfTestPartitionStart + 12}
+	sector := func(location uint32, data []byte) {
+		img.sectors[location] = data
+	}
+	block := func(location uint32, data []byte) {
+		img.sectors[udfTestPartitionStart+location] = data
+	}
+
+	// ISO9660
+	rootDot := &DirectoryEntry{ExtentLocation: 21, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00"}
+	rootDotDot := &DirectoryEntry{ExtentLocation: 21, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+	readme := &DirectoryEntry{ExtentLocation: udfTestPartitionStart + 4, ExtentLength: sectorSize, Identifier: "README.TXT;1"}
+	sector(16, marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: int32(img.size), LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: rootDotDot},
+	}))
+	sector(17, marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	for i, identifier := range []string{"BEA01", "NSR02", "TEA01"} {
+		vsd := make([]byte, sectorSize)
+		copy(vsd[1:6], identifier)
+		vsd[6] = 1
+		sector(18+uint32(i), vsd)
+	}
+	sector(21, marshalDirectory(t, rootDot, rootDotDot, readme))
+
+	// the anchor points to the main volume descriptor sequence at 32 and to the reserve one at 48
+	anchor := make([]byte, 512)
+	binary.LittleEndian.PutUint32(anchor[16:20], 16*sectorSize)
+	binary.LittleEndian.PutUint32(anchor[20:24], 32)
+	binary.LittleEndian.PutUint32(anchor[24:28], 16*sectorSize)
+	binary.LittleEndian.PutUint32(anchor[28:32], 48)
+	sector(udfAnchorSector, udfDescriptor(udfTagAnchor, udfAnchorSector, anchor))
+
+	for _, start := range []uint32{32, 48} {
+		pd := make([]byte, 512)
+		binary.LittleEndian.PutUint32(pd[188:192], udfTestPartitionStart)
+		binary.LittleEndian.PutUint32(pd[192:196], 12)
+		sector(start, udfDescriptor(udfTagPartition, start, pd))
+
+		lvd := make([]byte, 446)
+		label := udfTestString("UDF Volume")
+		copy(lvd[84:], label)
+		lvd[211] = byte(len(label))
+		binary.LittleEndian.PutUint32(lvd[212:216], sectorSize)
+		copy(lvd[248:264], udfLongAllocationBytes(sectorSize, 0))
+		binary.LittleEndian.PutUint32(lvd[264:268], 6)
+		binary.LittleEndian.PutUint32(lvd[268:272], 1)
+		copy(lvd[440:], []byte{1, 6, 1, 0, 0, 0})
+		sector(start+1, udfDescriptor(udfTagLogicalVolume, start+1, lvd))
+
+		sector(start+2, udfDescriptor(udfTagTerminating, start+2, make([]byte, 512)))
+	}
+
+	// the file set descriptor and the root directory
+	fsd := make([]byte, 512)
+	copy(fsd[400:416], udfLongAllocationBytes(sectorSize, 1))
+	block(0, udfDescriptor(udfTagFileSet, 0, fsd))
+
+	var root []byte
+	root = append(root, udfTestFID(udfCharacteristicDirectory|udfCharacteristicParent, "", 1)...)
+	root = append(root, udfTestFID(0, "readme.txt", 3)...)
+	root = append(root, udfTestFID(udfCharacteristicDeleted, "deleted.txt", 3)...)
+	root = append(root, udfTestFID(0, "Ünïcødé 文件.txt", 8)...)
+	root = append(root, udfTestFID(udfCharacteristicDirectory, "subdir", 9)...)
+	root = append(root, udfTestFID(0, "link", 11)...)
+	block(1, udfTestFileEntry(1, false, udfFileTypeDirectory, udfAllocationLong, len(root), udfLongAllocationBytes(uint32(len(root)), 2)))
+	block(2, root)
+
+	// README.TXT is followed by a hole and a tail, whose allocation descriptors are found in an allocation extent
+	tail := []byte("the end")
+	block(3, udfTestFileEntry(3, false, udfFileTypeRegular, udfAllocationShort, 2*int(sectorSize)+len(tail), append(
+		udfShortAllocation(sectorSize, udfExtentRecorded, 4),
+		udfShortAllocation(sectorSize, udfExtentNext, 7)...,
+	)))
+	block(4, udfTestReadme)
+	block(6, tail)
+	aed := make([]byte, 24)
+	binary.LittleEndian.PutUint32(aed[20:24], 16)
+	aed = append(aed, udfShortAllocation(sectorSize, udfExtentAllocated, 5)...)
+	aed = append(aed, udfShortAllocation(uint32(len(tail)), udfExtentRecorded, 6)...)
+	block(7, udfDescriptor(udfTagAllocationExtent, 7, aed))
+
+	block(8, udfTestFileEntry(8, true, udfFileTypeRegular, udfAllocationEmbedded, 8, []byte("embedded")))
+
+	subdir := udfTestFID(udfCharacteristicDirectory|udfCharacteristicParent, "", 1)
+	block(9, udfTestFileEntry(9, false, udfFileTypeDirectory, udfAllocationShort, len(subdir), udfShortAllocation(uint32(len(subdir)), udfExtentRecorded, 10)))
+	block(10, subdir)
+
+	target := []byte{1, 0, 0, 0, 5, 4, 0, 0, 8, 'u', 's', 'r', 5, 4, 0, 0, 8, 'b', 'i', 'n'}
+	block(11, udfTestFileEntry(11, false, udfFileTypeSymlink, udfAllocationEmbedded, len(target), target))
+
+	return img
+}
+
+func (img *udfTestImage) bytes() []byte {
+	data := make([]byte, img.size*sectorSize)
+	for location, sector := range img.sectors {
+		copy(data[location*sectorSize:], sector)
+	}
+	return data
+}
+
+func TestImageReaderUDF(t *testing.T) {
+	img, err := OpenImage(bytes.NewReader(newUDFTestImage(t).bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the ISO9660 side is readable as well
+	assert.Len(t, img.volumeDescriptors, 2)
+	readme, err := img.Lookup("README.TXT")
+	if assert.NoError(t, err) {
+		content, err := io.ReadAll(readme.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, udfTestReadme, content)
+	}
+
+	label, err := img.UDFLabel()
+	assert.NoError(t, err)
+	assert.Equal(t, "UDF Volume", label)
+
+	root, err := img.UDFRootDir()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, root.IsDir())
+	assert.Equal(t, os.ModeDir|0755, root.Mode())
+
+	children, err := root.GetChildren()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var names []string
+	for _, c := range children {
+		names = append(names, c.Name())
+	}
+	assert.Equal(t, []string{"readme.txt", "Ünïcødé 文件.txt", "subdir", "link"}, names)
+
+	// a recorded extent, a hole and a tail
+	f := children[0]
+	assert.False(t, f.IsDir())
+	assert.Equal(t, os.FileMode(0755), f.Mode())
+	assert.True(t, testUDFTime.Equal(f.ModTime()))
+	assert.Equal(t, &PosixAttributes{Mode: 0755, Links: 1, UID: 1000, GID: 100}, f.Sys())
+	assert.Equal(t, int64(2*sectorSize+7), f.Size())
+	content, err := io.ReadAll(f.Reader())
+	assert.NoError(t, err)
+	expected := append(append(append([]byte{}, udfTestReadme...), make([]byte, sectorSize)...), "the end"...)
+	assert.Equal(t, expected, content)
+
+	fr, err := f.Open()
+	if assert.NoError(t, err) {
+		buf := make([]byte, 10)
+		_, err := fr.ReadAt(buf, int64(2*sectorSize-5))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("\x00\x00\x00\x00\x00the e"), buf)
+	}
+
+	// data embedded in an extended file entry
+	content, err = io.ReadAll(children[1].Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, "embedded", string(content))
+
+	subdir := children[2]
+	assert.True(t, subdir.IsDir())
+	subdirChildren, err := subdir.GetChildren()
+	assert.NoError(t, err)
+	assert.Empty(t, subdirChildren)
+	_, err = subdir.Open()
+	assert.ErrorIs(t, err, ErrIsDirectory)
+
+	link := children[3]
+	assert.Equal(t, os.ModeSymlink|0755, link.Mode())
+	target, err := link.Readlink()
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/bin", target)
+	_, err = f.Readlink()
+	assert.Error(t, err)
+}
+
+func TestImageReaderUDFOnly(t *testing.T) {
+	udfImage := newUDFTestImage(t)
+	for location := uint32(16); location < 22; location++ {
+		delete(udfImage.sectors, location)
+	}
+	for i, identifier := range []string{"BEA01", "NSR03", "TEA01"} {
+		vsd := make([]byte, sectorSize)
+		copy(vsd[1:6], identifier)
+		vsd[6] = 1
+		udfImage.sectors[16+uint32(i)] = vsd
+	}
+
+	img, err := OpenImage(bytes.NewReader(udfImage.bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, img.volumeDescriptors)
+
+	_, err = img.RootDir()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	root, err := img.UDFRootDir()
+	if assert.NoError(t, err) {
+		children, err := root.GetChildren()
+		assert.NoError(t, err)
+		assert.Len(t, children, 4)
+	}
+}
+
+func TestImageReaderUDFErrors(t *testing.T) {
+	t.Run("no UDF", func(t *testing.T) {
+		f, err := os.Open("fixtures/test.iso")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer f.Close()
+
+		img, err := OpenImage(f)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = img.UDFRootDir()
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("the reserve sequence replaces a broken main sequence", func(t *testing.T) {
+		udfImage := newUDFTestImage(t)
+		udfImage.sectors[33][300]++
+
+		img, err := OpenImage(bytes.NewReader(udfImage.bytes()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = img.UDFRootDir()
+		assert.NoError(t, err)
+
+		udfImage.sectors[49][300]++
+		img, err = OpenImage(bytes.NewReader(udfImage.bytes()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = img.UDFRootDir()
+		assert.EqualError(t, err, "reading UDF volume descriptor sequence: UDF descriptor 6 has an invalid CRC")
+	})
+
+	t.Run("file entry recorded for another block", func(t *testing.T) {
+		udfImage := newUDFTestImage(t)
+		udfImage.sectors[udfTestPartitionStart+3] = udfTestFileEntry(4, false, udfFileTypeRegular, udfAllocationShort, 0, nil)
+
+		img, err := OpenImage(bytes.NewReader(udfImage.bytes()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		root, err := img.UDFRootDir()
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = root.GetChildren()
+		assert.EqualError(t, err, `reading "readme.txt" in UDF directory "": UDF descriptor at block 3 is recorded for block 4`)
+	})
+
+	t.Run("extents shorter than the file", func(t *testing.T) {
+		udfImage := newUDFTestImage(t)
+		udfImage.sectors[udfTestPartitionStart+3] = udfTestFileEntry(3, false, udfFileTypeRegular, udfAllocationShort, 3*int(sectorSize), udfShortAllocation(sectorSize, udfExtentRecorded, 4))
+
+		img, err := OpenImage(bytes.NewReader(udfImage.bytes()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		root, err := img.UDFRootDir()
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = root.GetChildren()
+		assert.ErrorContains(t, err, "the extents hold fewer bytes than the length of the file")
+	})
+}
+
+// udfLookup resolves a slash-separated path in the UDF file system
+func udfLookup(t *testing.T, root *UDFFile, name string) *UDFFile {
+	current := root
+	for _, component := range strings.Split(name, "/") {
+		children, err := current.GetChildren()
+		if !assert.NoError(t, err, name) {
+			return nil
+		}
+		var next *UDFFile
+		for _, c := range children {
+			if c.Name() == component {
+				next = c
+			}
+		}
+		if !assert.NotNil(t, next, name) {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+func TestWriterUDF(t *testing.T) {
+	for _, revision := range []int{UDFRevision102, UDFRevision201} {
+		w, err := NewWriter(WithUDF(revision), WithRockRidge(), WithJoliet())
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() {
+			if err := w.Cleanup(); err != nil {
+				t.Fatalf("failed to cleanup writer: %v", err)
+			}
+		}()
+
+		longName := strings.Repeat("Ünïcødé 文件 ", 10) + ".txt"
+		big := []byte(strings.Repeat(loremIpsum, 2000))
+		files := map[string][]byte{
+			"readme.txt":                 []byte(loremIpsum),
+			"big.txt":                    big,
+			"empty.txt":                  nil,
+			"Some Directory/" + longName: []byte("long"),
+			"a/b/c/deep.txt":             []byte("deep"),
+		}
+		for name, data := range files {
+			assert.NoError(t, w.AddFile(bytes.NewReader(data), name))
+		}
+
+		local := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(local, "secret"), []byte("secret"), 0600))
+		assert.NoError(t, os.Symlink("../a/b", filepath.Join(local, "link")))
+		assert.NoError(t, w.AddLocalFile(filepath.Join(local, "secret"), "local/secret"))
+		assert.NoError(t, w.AddLocalFile(filepath.Join(local, "link"), "local/link"))
+
+		var buf bytes.Buffer
+		if !assert.NoError(t, w.WriteTo(&buf, "udfvol")) {
+			return
+		}
+		image := buf.Bytes()
+		// the data is recorded once for both file systems
+		assert.Less(t, len(image), len(big)+(udfPartitionStart+64)*int(sectorSize))
+		assert.Zero(t, len(image)%int(sectorSize))
+
+		img, err := OpenImage(bytes.NewReader(image))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		label, err := img.UDFLabel()
+		assert.NoError(t, err)
+		assert.Equal(t, "udfvol", label)
+
+		// the anchor in the last sector matches the one at sector 256
+		last := image[len(image)-int(sectorSize):]
+		tag, err := unmarshalUDFTag(last)
+		assert.NoError(t, err)
+		assert.Equal(t, udfTagAnchor, tag.Identifier)
+		assert.Equal(t, image[udfAnchorSector*sectorSize+16:udfAnchorSector*sectorSize+512], last[16:512])
+
+		nsr := "NSR02"
+		if revision == UDFRevision201 {
+			nsr = "NSR03"
+		}
+		assert.Equal(t, nsr, string(image[(systemAreaSectors+4)*sectorSize+1:(systemAreaSectors+4)*sectorSize+6]))
+
+		root, err := img.UDFRootDir()
+		if !assert.NoError(t, err) {
+			return
+		}
+		children, err := root.GetChildren()
+		assert.NoError(t, err)
+		assert.Len(t, children, 6)
+
+		for name, data := range files {
+			udfFile := udfLookup(t, root, name)
+			if udfFile == nil {
+				continue
+			}
+			assert.Equal(t, int64(len(data)), udfFile.Size(), name)
+			content, err := io.ReadAll(udfFile.Reader())
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(data, content), name)
+			assert.Equal(t, os.FileMode(0644), udfFile.Mode(), name)
+
+			isoFile, err := img.Lookup(name)
+			if assert.NoError(t, err, name) {
+				content, err := io.ReadAll(isoFile.Reader())
+				assert.NoError(t, err)
+				assert.True(t, bytes.Equal(data, content), name)
+			}
+		}
+
+		dir := udfLookup(t, root, "a/b")
+		if assert.NotNil(t, dir) {
+			assert.True(t, dir.IsDir())
+			assert.Equal(t, os.ModeDir|0755, dir.Mode())
+			assert.Equal(t, uint32(2), dir.Sys().(*PosixAttributes).Links)
+		}
+
+		secret := udfLookup(t, root, "local/secret")
+		if assert.NotNil(t, secret) {
+			assert.Equal(t, os.FileMode(0600), secret.Mode())
+			info, err := os.Stat(filepath.Join(local, "secret"))
+			assert.NoError(t, err)
+			// UDF records microseconds
+			assert.True(t, info.ModTime().Truncate(time.Microsecond).Equal(secret.ModTime()), "%s != %s", info.ModTime(), secret.ModTime())
+		}
+
+		link := udfLookup(t, root, "local/link")
+		if assert.NotNil(t, link) {
+			assert.Equal(t, os.ModeSymlink, link.Mode().Type())
+			target, err := link.Readlink()
+			assert.NoError(t, err)
+			assert.Equal(t, "../a/b", target)
+		}
+	}
+}
+
+func TestWriterUDFOptions(t *testing.T) {
+	_, err := NewWriter(WithUDF(0x0250))
+	assert.EqualError(t, err, "UDF revision 250 is not supported")
+
+	_, err = NewWriter(WithUDF(UDFRevision201), WithRockRidge(), WithZisofs(15))
+	assert.EqualError(t, err, "UDF cannot refer to files compressed with zisofs")
+}
@@ -59,12 +59,25 @@ func extract(f *iso9660.File, targetPath string) error {
 				return err
 			}
 		}
+	} else if f.Mode()&os.ModeSymlink != 0 {
+		target, err := f.Readlink()
+		if err != nil {
+			return err
+		}
+		if err = os.Symlink(target, targetPath); err != nil {
+			return err
+		}
 	} else { // it's a file
 		newFile, err := os.Create(targetPath)
 		if err != nil {
 			return err
 		}
 		defer newFile.Close()
+
+		if f.IsSparse() {
+			return copySparse(newFile, f.Reader(), f.Size())
+		}
+
 		if _, err = io.Copy(newFile, f.Reader()); err != nil {
 			return err
 		}
@@ -72,3 +85,40 @@ func extract(f *iso9660.File, targetPath string) error {
 
 	return nil
 }
+
+// copySparse copies the file data while seeking over blocks of zeros,
+// so that they become holes on filesystems supporting sparse files.
+func copySparse(dst *os.File, src io.Reader, size int64) error {
+	buffer := make([]byte, 2048)
+	for {
+		n, err := io.ReadFull(src, buffer)
+		if n > 0 {
+			if isZero(buffer[:n]) {
+				if _, seekErr := dst.Seek(int64(n), io.SeekCurrent); seekErr != nil {
+					return seekErr
+				}
+			} else if _, writeErr := dst.Write(buffer[:n]); writeErr != nil {
+				return writeErr
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// a trailing hole is only created by extending the file
+	return dst.Truncate(size)
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
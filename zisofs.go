@@ -0,0 +1,365 @@
+package iso9660
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Files compressed in the zisofs format start with a header holding a magic number, the uncompressed size,
+// the size of the header and the block size. It is followed by a table of little-endian offsets, one for
+// each block of the uncompressed data and one for the end of the last block. Each block is compressed
+// with zlib on its own, which allows reading the file at random. A block of zeros may be left out,
+// in which case its offset equals the offset of the next one.
+const (
+	zisofsMagic            = "\x37\xE4\x53\x96\xC9\xDB\xD6\x07"
+	zisofsAlgorithm        = "pz"
+	zisofsHeaderSize       = 16
+	zisofsPointerSize      = 4
+	zisofsMinBlockSizeLog2 = 15
+	zisofsMaxBlockSizeLog2 = 17
+)
+
+// zisofsReaderAt reads the uncompressed contents of a file compressed in the zisofs format
+type zisofsReaderAt struct {
+	ra        io.ReaderAt // the compressed contents
+	size      int64
+	blockSize int64
+	pointers  []uint32
+
+	// cacheMutex guards the most recently decompressed block, which serves sequential reads
+	cacheMutex  sync.Mutex
+	cachedBlock int64
+	cache       []byte
+}
+
+var _ io.ReaderAt = &zisofsReaderAt{}
+
+func newZisofsReaderAt(ra io.ReaderAt, compressedSize int64, zf *RockRidgeZisofsEntry) (*zisofsReaderAt, error) {
+	if zf.Algorithm != zisofsAlgorithm {
+		return nil, fmt.Errorf("unsupported zisofs algorithm %q", zf.Algorithm)
+	}
+	if zf.BlockSizeLog2 < zisofsMinBlockSizeLog2 || zf.BlockSizeLog2 > zisofsMaxBlockSizeLog2 {
+		return nil, fmt.Errorf("invalid zisofs block size 2^%d", zf.BlockSizeLog2)
+	}
+
+	header := make([]byte, zisofsHeaderSize)
+	if _, err := ra.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("reading zisofs header: %w", err)
+	}
+	if string(header[0:8]) != zisofsMagic {
+		return nil, fmt.Errorf("invalid zisofs header")
+	}
+
+	zr := &zisofsReaderAt{
+		ra:          ra,
+		size:        int64(zf.UncompressedSize),
+		blockSize:   int64(1) << zf.BlockSizeLog2,
+		cachedBlock: -1,
+	}
+
+	blocks := (zr.size + zr.blockSize - 1) / zr.blockSize
+	table := make([]byte, (blocks+1)*zisofsPointerSize)
+	if _, err := ra.ReadAt(table, int64(zf.HeaderSize)); err != nil {
+		return nil, fmt.Errorf("reading zisofs block pointers: %w", err)
+	}
+
+	zr.pointers = make([]uint32, blocks+1)
+	for i := range zr.pointers {
+		zr.pointers[i] = binary.LittleEndian.Uint32(table[i*zisofsPointerSize:])
+		if (i > 0 && zr.pointers[i] < zr.pointers[i-1]) || int64(zr.pointers[i]) > compressedSize {
+			return nil, fmt.Errorf("invalid zisofs block pointer %d", i)
+		}
+	}
+
+	return zr, nil
+}
+
+// readBlock returns the n-th block of the uncompressed contents
+func (zr *zisofsReaderAt) readBlock(n int64) ([]byte, error) {
+	zr.cacheMutex.Lock()
+	if zr.cachedBlock == n {
+		defer zr.cacheMutex.Unlock()
+		return zr.cache, nil
+	}
+	zr.cacheMutex.Unlock()
+
+	length := zr.blockSize
+	if remaining := zr.size - n*zr.blockSize; remaining < length {
+		length = remaining
+	}
+	block := make([]byte, length)
+
+	start, end := zr.pointers[n], zr.pointers[n+1]
+	if start != end {
+		compressed := make([]byte, end-start)
+		if _, err := zr.ra.ReadAt(compressed, int64(start)); err != nil {
+			return nil, fmt.Errorf("reading zisofs block %d: %w", n, err)
+		}
+
+		r, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("decompressing zisofs block %d: %w", n, err)
+		}
+		if _, err := io.ReadFull(r, block); err != nil {
+			return nil, fmt.Errorf("decompressing zisofs block %d: %w", n, err)
+		}
+	}
+
+	zr.cacheMutex.Lock()
+	zr.cachedBlock, zr.cache = n, block
+	zr.cacheMutex.Unlock()
+
+	return block, nil
+}
+
+// ReadAt implements io.ReaderAt
+func (zr *zisofsReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= zr.size {
+		return 0, io.EOF
+	}
+
+	var err error
+	if remaining := zr.size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+
+	n := 0
+	for n < len(p) {
+		blockIndex := (off + int64(n)) / zr.blockSize
+		offsetInBlock := (off + int64(n)) % zr.blockSize
+
+		block, readErr := zr.readBlock(blockIndex)
+		if readErr != nil {
+			return n, readErr
+		}
+		n += copy(p[n:], block[offsetInBlock:])
+	}
+
+	return n, err
+}
+
+// WithZisofs makes the ImageWriter compress files in the zisofs format with blocks of 2^blockSizeLog2 bytes,
+// where blockSizeLog2 is 15, 16 or 17. Linux decompresses such files transparently, as does the Image reader.
+// Files are only compressed if that saves space, boot images are never compressed.
+// Compression requires Rock Ridge, whose ZF entries mark the compressed files.
+// The Joliet directory tree refers to the same compressed data.
+func WithZisofs(blockSizeLog2 int) WriterOption {
+	return func(iw *ImageWriter) {
+		iw.zisofsBlockSizeLog2 = blockSizeLog2
+	}
+}
+
+// compressedFile is a staged file compressed in the zisofs format
+type compressedFile struct {
+	path string // the temporary file holding the compressed contents
+	size int64
+	zf   *RockRidgeZisofsEntry
+}
+
+// compressStagedFiles compresses the staged files into the given directory, as many at a time as there are CPUs
+func (wc *writeContext) compressStagedFiles(iw *ImageWriter, dir string) error {
+	// the boot images and the catalog are read by firmware, which cannot decompress them
+	excluded := map[string]bool{wc.stagedPath(iw.bootCatalogTarget()): true}
+	for _, bi := range iw.bootImages {
+		excluded[wc.stagedPath(bi.target)] = true
+	}
+
+	var candidates []string
+	err := filepath.WalkDir(wc.stagingDir, func(stagedPath string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		stagedPath = filepath.ToSlash(stagedPath)
+		if _, previous := wc.previousFiles[strings.TrimPrefix(stagedPath, wc.stagingDir+"/")]; previous || excluded[stagedPath] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// the ZF entry records the uncompressed size in 32 bits
+		if info.Size() > 0 && info.Size() <= math.MaxUint32 {
+			candidates = append(candidates, stagedPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		mutex    sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan int)
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				cf, err := compressZisofsFile(candidates[i], path.Join(dir, strconv.Itoa(i)), byte(wc.zisofsBlockSizeLog2))
+
+				mutex.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("compressing %s: %w", strings.TrimPrefix(candidates[i], wc.stagingDir), err)
+				} else if cf != nil {
+					wc.compressedFiles[candidates[i]] = cf
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for i := range candidates {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// compressZisofsFile compresses a file into another one. It returns nil if compression doesn't save any sectors.
+func compressZisofsFile(source, target string, blockSizeLog2 byte) (*compressedFile, error) {
+	src, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	size := info.Size()
+	blockSize := int64(1) << blockSizeLog2
+	blocks := (size + blockSize - 1) / blockSize
+
+	header := make([]byte, zisofsHeaderSize+(blocks+1)*zisofsPointerSize)
+	copy(header, zisofsMagic)
+	binary.LittleEndian.PutUint32(header[8:12], uint32(size))
+	header[12] = zisofsHeaderSize / 4
+	header[13] = blockSizeLog2
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	offset := int64(len(header))
+	block := make([]byte, blockSize)
+	var compressed bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := int64(0); i < blocks; i++ {
+		binary.LittleEndian.PutUint32(header[zisofsHeaderSize+i*zisofsPointerSize:], uint32(offset))
+
+		length := blockSize
+		if remaining := size - i*blockSize; remaining < length {
+			length = remaining
+		}
+		if _, err := io.ReadFull(src, block[:length]); err != nil {
+			return nil, err
+		}
+
+		if isZero(block[:length]) {
+			// blocks of zeros are left out
+			continue
+		}
+
+		compressed.Reset()
+		zw.Reset(&compressed)
+		if _, err := zw.Write(block[:length]); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		if _, err := dst.Write(compressed.Bytes()); err != nil {
+			return nil, err
+		}
+		offset += int64(compressed.Len())
+
+		if fileLengthToSectors64(offset) >= fileLengthToSectors64(size) {
+			// compression doesn't save any space, the file is closed first so that it can be removed on every platform
+			if err := dst.Close(); err != nil {
+				return nil, err
+			}
+			return nil, os.Remove(target)
+		}
+	}
+	binary.LittleEndian.PutUint32(header[zisofsHeaderSize+blocks*zisofsPointerSize:], uint32(offset))
+
+	if _, err := dst.WriteAt(header, 0); err != nil {
+		return nil, err
+	}
+	if err := dst.Close(); err != nil {
+		return nil, err
+	}
+
+	return &compressedFile{
+		path: target,
+		size: offset,
+		zf: &RockRidgeZisofsEntry{
+			Algorithm:        zisofsAlgorithm,
+			HeaderSize:       zisofsHeaderSize,
+			BlockSizeLog2:    blockSizeLog2,
+			UncompressedSize: uint32(size),
+		},
+	}, nil
+}
+
+// fileLengthToSectors64 returns the number of sectors occupied by the given number of bytes
+func fileLengthToSectors64(l int64) int64 {
+	return (l + int64(sectorSize) - 1) / int64(sectorSize)
+}
+
+// isZero returns true if all bytes are zero
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// zisofsEntry returns the ZF entry of a staged file which is recorded compressed or nil
+func (wc *writeContext) zisofsEntry(stagedPath string) *RockRidgeZisofsEntry {
+	if cf, ok := wc.compressedFiles[stagedPath]; ok {
+		return cf.zf
+	}
+
+	// files carried over from a previous session stay compressed
+	if records, ok := wc.previousFiles[strings.TrimPrefix(stagedPath, wc.stagingDir+"/")]; ok {
+		if zf, err := records[0].SystemUseEntries.GetRockRidgeZisofs(); err == nil {
+			return zf
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+//go:build !integration
+// +build !integration
+
+package iso9660
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// compressZisofs compresses data in the zisofs format, leaving out blocks of zeros
+func compressZisofs(t *testing.T, data []byte, blockSizeLog2 byte) []byte {
+	blockSize := 1 << blockSizeLog2
+	blocks := (len(data) + blockSize - 1) / blockSize
+
+	header := make([]byte, zisofsHeaderSize)
+	copy(header, zisofsMagic)
+	binary.LittleEndian.PutUint32(header[8:12], uint32(len(data)))
+	header[12] = zisofsHeaderSize / 4
+	header[13] = blockSizeLog2
+
+	pointers := make([]byte, (blocks+1)*zisofsPointerSize)
+	var compressed bytes.Buffer
+	offset := len(header) + len(pointers)
+	for i := 0; i < blocks; i++ {
+		binary.LittleEndian.PutUint32(pointers[i*zisofsPointerSize:], uint32(offset+compressed.Len()))
+
+		block := data[i*blockSize:]
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		if bytes.Count(block, []byte{0}) == len(block) {
+			continue
+		}
+
+		zw := zlib.NewWriter(&compressed)
+		_, err := zw.Write(block)
+		assert.NoError(t, err)
+		assert.NoError(t, zw.Close())
+	}
+	binary.LittleEndian.PutUint32(pointers[blocks*zisofsPointerSize:], uint32(offset+compressed.Len()))
+
+	return append(append(header, pointers...), compressed.Bytes()...)
+}
+
+// zisofsEntry encodes a ZF entry
+func zisofsEntry(size uint32, blockSizeLog2 byte) []byte {
+	payload := make([]byte, 12)
+	copy(payload, zisofsAlgorithm)
+	payload[2] = zisofsHeaderSize / 4
+	payload[3] = blockSizeLog2
+	WriteInt32LSBMSB(payload[4:12], int32(size))
+	return suEntry("ZF", payload...)
+}
+
+func TestImageReaderZisofs(t *testing.T) {
+	blockSize := 1 << 15
+	expected := []byte(strings.Repeat(loremIpsum, blockSize/len(loremIpsum)+1)[:blockSize])
+	expected = append(expected, make([]byte, blockSize)...)
+	expected = append(expected, loremIpsum...)
+	compressed := compressZisofs(t, expected, 15)
+	sectors := fileLengthToSectors(uint32(len(compressed)))
+
+	rootDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x00", SystemUse: rockRidgeRootSU()}
+	rootDotDot := &DirectoryEntry{ExtentLocation: 18, ExtentLength: sectorSize, FileFlags: dirFlagDir, Identifier: "\x01"}
+	file := &DirectoryEntry{ExtentLocation: 19, ExtentLength: uint32(len(compressed)), Identifier: "LOREM.TXT;1", SystemUse: append(rockRidgeName("lorem.txt"), zisofsEntry(uint32(len(expected)), 15)...)}
+	plain := &DirectoryEntry{ExtentLocation: 19, ExtentLength: uint32(len(compressed)), Identifier: "RAW.BIN;1", SystemUse: rockRidgeName("raw.bin")}
+
+	var image bytes.Buffer
+	image.Write(make([]byte, systemAreaSize))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{
+		Header:  volumeDescriptorHeader{Type: volumeTypePrimary, Identifier: standardIdentifierBytes, Version: 1},
+		Primary: &PrimaryVolumeDescriptorBody{VolumeSpaceSize: int32(19 + sectors), LogicalBlockSize: int16(sectorSize), RootDirectoryEntry: rootDotDot},
+	}))
+	image.Write(marshalVolumeDescriptor(t, volumeDescriptor{Header: volumeDescriptorHeader{Type: volumeTypeTerminator, Identifier: standardIdentifierBytes, Version: 1}}))
+	image.Write(marshalDirectory(t, rootDot, rootDotDot, file, plain))
+	data := make([]byte, sectors*sectorSize)
+	copy(data, compressed)
+	image.Write(data)
+
+	img, err := OpenImage(bytes.NewReader(image.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f, err := img.Lookup("lorem.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, f.IsCompressed())
+	assert.Equal(t, int64(len(expected)), f.Size())
+
+	content, err := io.ReadAll(f.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, content)
+
+	// reads crossing the blocks, including the one left out
+	fr, err := f.Open()
+	if !assert.NoError(t, err) {
+		return
+	}
+	buf := make([]byte, blockSize+20)
+	n, err := fr.ReadAt(buf, int64(blockSize-10))
+	assert.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	assert.Equal(t, expected[blockSize-10:2*blockSize+10], buf)
+
+	// the compressed contents of a file without ZF entry are read as they are
+	raw, err := img.Lookup("raw.bin")
+	if assert.NoError(t, err) {
+		assert.False(t, raw.IsCompressed())
+		content, err := io.ReadAll(raw.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, compressed, content)
+	}
+}
+
+func TestImageReaderZisofsErrors(t *testing.T) {
+	compressed := compressZisofs(t, []byte(loremIpsum), 15)
+
+	for name, tc := range map[string]struct {
+		data []byte
+		zf   RockRidgeZisofsEntry
+	}{
+		"algorithm":  {compressed, RockRidgeZisofsEntry{Algorithm: "xx", HeaderSize: 16, BlockSizeLog2: 15, UncompressedSize: uint32(len(loremIpsum))}},
+		"block size": {compressed, RockRidgeZisofsEntry{Algorithm: "pz", HeaderSize: 16, BlockSizeLog2: 12, UncompressedSize: uint32(len(loremIpsum))}},
+		"magic":      {append([]byte{0}, compressed[1:]...), RockRidgeZisofsEntry{Algorithm: "pz", HeaderSize: 16, BlockSizeLog2: 15, UncompressedSize: uint32(len(loremIpsum))}},
+		"pointers":   {compressed[:len(compressed)-10], RockRidgeZisofsEntry{Algorithm: "pz", HeaderSize: 16, BlockSizeLog2: 15, UncompressedSize: uint32(len(loremIpsum))}},
+	} {
+		_, err := newZisofsReaderAt(bytes.NewReader(tc.data), int64(len(tc.data)), &tc.zf)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestWriterZisofs(t *testing.T) {
+	w, err := NewWriter(WithRockRidge(), WithJoliet(), WithZisofs(16))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		if err := w.Cleanup(); err != nil {
+			t.Fatalf("failed to cleanup writer: %v", err)
+		}
+	}()
+
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	files := map[string][]byte{
+		"lorem.txt":      []byte(strings.Repeat(loremIpsum, 500)),
+		"dir/zeros.bin":  make([]byte, 300000),
+		"random.bin":     random,
+		"empty.txt":      nil,
+		"boot/boot.img":  []byte(strings.Repeat(loremIpsum, 10)),
+		"short/tiny.txt": []byte("tiny"),
+	}
+	for name, data := range files {
+		assert.NoError(t, w.AddFile(bytes.NewReader(data), name))
+	}
+	assert.NoError(t, w.AddBootImage("boot/boot.img", BootImageOptions{}))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, w.WriteTo(&buf, "zisofs")) {
+		return
+	}
+
+	img, err := OpenImage(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	compressed := map[string]bool{"lorem.txt": true, "dir/zeros.bin": true}
+	for name, data := range files {
+		f, err := img.Open(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		contents, err := io.ReadAll(f)
+		assert.NoError(t, err, name)
+		assert.Equal(t, len(data), len(contents), name)
+		assert.True(t, bytes.Equal(data, contents), name)
+
+		file, err := img.Lookup(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		assert.Equal(t, compressed[name], file.IsCompressed(), name)
+		assert.Equal(t, int64(len(data)), file.Size(), name)
+		if compressed[name] {
+			assert.Less(t, fileLengthToSectors(file.de.ExtentLength), fileLengthToSectors(uint32(len(data))), name)
+
+			zf, err := file.de.SystemUseEntries.GetRockRidgeZisofs()
+			assert.NoError(t, err, name)
+			assert.Equal(t, &RockRidgeZisofsEntry{Algorithm: "pz", HeaderSize: 16, BlockSizeLog2: 16, UncompressedSize: uint32(len(data))}, zf)
+		}
+	}
+
+	// the boot image is read by the firmware, which cannot decompress it
+	catalog, err := img.BootCatalog()
+	if assert.NoError(t, err) {
+		bootImage, err := io.ReadAll(catalog.Default.Reader())
+		assert.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(bootImage, files["boot/boot.img"]))
+	}
+}
+
+func TestWriterZisofsOptions(t *testing.T) {
+	_, err := NewWriter(WithRockRidge(), WithZisofs(14))
+	assert.EqualError(t, err, "zisofs block size 2^14 is not supported")
+
+	_, err = NewWriter(WithZisofs(15))
+	assert.EqualError(t, err, "zisofs compression requires Rock Ridge")
+
+	for _, blockSizeLog2 := range []int{15, 17} {
+		w, err := NewWriter(WithRockRidge(), WithZisofs(blockSizeLog2))
+		if assert.NoError(t, err) {
+			assert.NoError(t, w.Cleanup())
+		}
+	}
+}